@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ─── Download Archive ─────────────────────────────────────────────────────────
+
+// errSkipped marks a job that was deliberately not downloaded. It is reported
+// in the summary but does not count as a failure.
+var errSkipped = errors.New("skipped")
+
+// archiveEntry is one line of the archive file. Key uses yt-dlp's own
+// download-archive convention: lower-case extractor, a space, the video ID.
+type archiveEntry struct {
+	Key    string    `json:"key"`
+	Mode   string    `json:"mode"`
+	URL    string    `json:"url"`
+	Title  string    `json:"title,omitempty"`
+	Path   string    `json:"path"`
+	Format string    `json:"format,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// downloadArchive is an append-only JSON-lines file of completed downloads.
+// It is safe for concurrent use by the batch workers.
+type downloadArchive struct {
+	mu      sync.Mutex
+	path    string
+	entries []archiveEntry
+}
+
+// archive is nil when --no-archive is given.
+var archive *downloadArchive
+
+// archiveKey builds the lookup key for a job, or "" if yt-dlp gave no ID.
+func archiveKey(j *job) string {
+	if j.id == "" || j.extractor == "" {
+		return ""
+	}
+	return strings.ToLower(j.extractor) + " " + j.id
+}
+
+// defaultArchivePath follows the XDG data dir on Linux and the user config
+// dir elsewhere, e.g. ~/.local/share/streamline/archive.jsonl.
+func defaultArchivePath() (string, error) {
+	var base string
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		base = dir
+	default:
+		base = os.Getenv("XDG_DATA_HOME")
+		if base == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			base = filepath.Join(home, ".local", "share")
+		}
+	}
+	return filepath.Join(base, "streamline", "archive.jsonl"), nil
+}
+
+// openArchive loads the archive at path; a missing file is an empty archive.
+func openArchive(path string) (*downloadArchive, error) {
+	a := &downloadArchive{path: path}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		debugLog("Archive %s does not exist yet", path)
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, scannerBufSize), scannerBufSize)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var e archiveEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			debugLog("Archive %s:%d: skipping malformed line: %v", path, n, err)
+			continue
+		}
+		a.entries = append(a.entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	debugLog("Archive %s: %d entries loaded", path, len(a.entries))
+	return a, nil
+}
+
+// lookup returns the most recent entry for key in the given mode.
+func (a *downloadArchive) lookup(key, mode string) (archiveEntry, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i := len(a.entries) - 1; i >= 0; i-- {
+		if e := a.entries[i]; e.Key == key && e.Mode == mode {
+			return e, true
+		}
+	}
+	return archiveEntry{}, false
+}
+
+// add appends e to the archive file and the in-memory list.
+func (a *downloadArchive) add(e archiveEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	a.entries = append(a.entries, e)
+	return f.Close()
+}
+
+// rewrite replaces the archive with the entries kept by keep and returns the
+// number removed. The new file is written beside the old one and renamed over
+// it so an interrupted rewrite never loses history.
+func (a *downloadArchive) rewrite(keep func(archiveEntry) bool) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var kept []archiveEntry
+	for _, e := range a.entries {
+		if keep(e) {
+			kept = append(kept, e)
+		}
+	}
+	removed := len(a.entries) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	tmp := a.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range kept {
+		data, err := json.Marshal(e)
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return 0, err
+		}
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := os.Rename(tmp, a.path); err != nil {
+		return 0, err
+	}
+	a.entries = kept
+	return removed, nil
+}
+
+// checkArchive reports whether j was already downloaded in this mode.
+// It returns an errSkipped-wrapped error when the job should not run.
+func checkArchive(j *job, mode string) error {
+	key := archiveKey(j)
+	if archive == nil || key == "" {
+		return nil
+	}
+	e, ok := archive.lookup(key, mode)
+	if !ok {
+		return nil
+	}
+	debugLog("Archive hit: %s (%s) → %s", key, mode, e.Path)
+	j.status("info", fmt.Sprintf("Already downloaded on %s: %s%s%s",
+		e.Time.Local().Format("2006-01-02"), colorDim, e.Path, colorReset))
+	return fmt.Errorf("%w: already in archive (%s)", errSkipped, e.Path)
+}
+
+// recordArchive stores a completed download. Failing to write the archive
+// only warns; the file itself was downloaded fine.
+func recordArchive(j *job, mode, format, output string) {
+	key := archiveKey(j)
+	if archive == nil || key == "" {
+		return
+	}
+	if abs, err := filepath.Abs(output); err == nil {
+		output = abs
+	}
+	err := archive.add(archiveEntry{
+		Key:    key,
+		Mode:   mode,
+		URL:    j.url,
+		Title:  j.title,
+		Path:   output,
+		Format: format,
+		Time:   time.Now().UTC(),
+	})
+	if err != nil {
+		j.status("warning", fmt.Sprintf("Could not update download archive: %v", err))
+	}
+}
+
+// ─── archive Subcommand ───────────────────────────────────────────────────────
+
+func archiveUsage() {
+	fmt.Printf(`%sUsage:%s
+  streamline archive list   [--archive PATH]          Show download history
+  streamline archive remove [--archive PATH] <id...>  Forget entries by key, ID, URL or path
+  streamline archive prune  [--archive PATH]          Drop entries whose file no longer exists
+
+`, colorYellow, colorReset)
+}
+
+// runArchiveCommand implements `streamline archive list|remove|prune`.
+func runArchiveCommand(args []string) int {
+	if len(args) == 0 {
+		archiveUsage()
+		return exitUsage
+	}
+	sub := args[0]
+	if isHelp(sub) {
+		archiveUsage()
+		return exitOK
+	}
+
+	fs, cli := newFlagSet("streamline archive "+sub, groupArchive, &opts)
+	fs.Usage = archiveUsage
+	targets, err := parseArgs(fs, args[1:])
+	if err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	enableDebug(cli)
+	path := cli.archivePath
+	if *path == "" {
+		p, err := defaultArchivePath()
+		if err != nil {
+			printStatus("error", err.Error())
+			return exitFilesystem
+		}
+		*path = p
+	}
+	a, err := openArchive(*path)
+	if err != nil {
+		printStatus("error", err.Error())
+		return exitFilesystem
+	}
+
+	switch sub {
+	case "list":
+		if len(a.entries) == 0 {
+			printStatus("info", fmt.Sprintf("Archive is empty (%s)", a.path))
+			return exitOK
+		}
+		for _, e := range a.entries {
+			title := e.Title
+			if title == "" {
+				title = e.URL
+			}
+			fmt.Printf("%s%s%s  %-5s  %s%-28s%s  %s\n      %s→ %s%s\n",
+				colorDim, e.Time.Local().Format("2006-01-02 15:04"), colorReset,
+				e.Mode,
+				colorCyan, e.Key, colorReset,
+				title,
+				colorDim, e.Path, colorReset)
+		}
+		printStatus("info", fmt.Sprintf("%d entr%s in %s", len(a.entries), plural(len(a.entries), "y", "ies"), a.path))
+
+	case "remove":
+		if len(targets) == 0 {
+			archiveUsage()
+			return exitUsage
+		}
+		removed, err := a.rewrite(func(e archiveEntry) bool {
+			for _, t := range targets {
+				if e.Key == t || strings.HasSuffix(e.Key, " "+t) || e.URL == t || e.Path == t {
+					return false
+				}
+			}
+			return true
+		})
+		if err != nil {
+			printStatus("error", err.Error())
+			return exitFilesystem
+		}
+		printStatus("success", fmt.Sprintf("Removed %d entr%s", removed, plural(removed, "y", "ies")))
+
+	case "prune":
+		// Only a file known to be gone drops its entry; one that cannot be
+		// checked (permissions, an unmounted drive) keeps it.
+		unchecked := 0
+		removed, err := a.rewrite(func(e archiveEntry) bool {
+			_, err := os.Stat(e.Path)
+			switch {
+			case errors.Is(err, os.ErrNotExist):
+				return false
+			case err != nil:
+				printStatus("warning", fmt.Sprintf("Keeping %s: %v", e.Key, err))
+				unchecked++
+			}
+			return true
+		})
+		if err != nil {
+			printStatus("error", err.Error())
+			return exitFilesystem
+		}
+		printStatus("success", fmt.Sprintf("Pruned %d entr%s with missing files", removed, plural(removed, "y", "ies")))
+		if unchecked > 0 {
+			return exitFilesystem
+		}
+
+	default:
+		archiveUsage()
+		return exitUsage
+	}
+	return exitOK
+}
+
+// plural picks the singular or plural suffix for n.
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestArchivePrune(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("a path below a file reads as missing on Windows")
+	}
+	withOptions(t, func(o *options) {})
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "kept.mp3")
+	if err := os.WriteFile(kept, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := openArchive(filepath.Join(dir, "archive.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []archiveEntry{
+		{Key: "youtube kept", Mode: "audio", Path: kept},
+		{Key: "youtube gone", Mode: "audio", Path: filepath.Join(dir, "gone.mp3")},
+		// Stat fails with ENOTDIR, which says nothing about the file.
+		{Key: "youtube unchecked", Mode: "audio", Path: filepath.Join(kept, "song.mp3")},
+	}
+	for _, e := range entries {
+		if err := a.add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if code := runArchiveCommand([]string{"prune", "--archive", a.path}); code != exitFilesystem {
+		t.Errorf("archive prune = %d, want %d for the entry it could not check", code, exitFilesystem)
+	}
+	a, err = openArchive(a.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, e := range a.entries {
+		keys = append(keys, e.Key)
+	}
+	if len(keys) != 2 || keys[0] != "youtube kept" || keys[1] != "youtube unchecked" {
+		t.Errorf("after prune the archive holds %q, want the kept and unchecked entries", keys)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"sort"
+	"strings"
+)
+
+// ─── Artwork Detection ────────────────────────────────────────────────────────
+
+// Music uploads often show a square cover inside a 16:9 frame, with black
+// bars or a blurred, darkened copy of the cover filling the sides. Squaring
+// such a thumbnail around its centre keeps the bars or cuts the cover;
+// findArtwork locates the cover so --cover-crop smart squares that instead.
+
+// barLuma is the brightest a pixel of a black bar may be, allowing for
+// JPEG noise; a line is still a bar with one pixel in barOutliers brighter,
+// so a channel logo in the bar does not stop the trim.
+const (
+	barLuma     = 32
+	barOutliers = 20
+)
+
+// Edges and detail are mean absolute luma differences between neighbouring
+// pixels: across a line for an edge, along it for detail. The artwork's
+// edge must stand insetEdge times above the background before it, and the
+// background may keep at most insetDetail of the artwork's detail.
+const (
+	insetEdge    = 4.0
+	insetMinEdge = 6.0
+	insetDetail  = 0.5
+	insetMinBar  = 0.04 // narrowest background, as a share of the frame
+	insetSkew    = 0.1  // how far off centre the artwork may sit
+)
+
+// lumaGrid is the 8-bit luma of an image, which is all detection looks at.
+type lumaGrid struct {
+	w, h int
+	pix  []uint8
+}
+
+func newLumaGrid(img image.Image) lumaGrid {
+	b := img.Bounds()
+	g := lumaGrid{b.Dx(), b.Dy(), make([]uint8, b.Dx()*b.Dy())}
+	if ycc, ok := img.(*image.YCbCr); ok {
+		// JPEG: the Y plane already is the luma.
+		for y := 0; y < g.h; y++ {
+			copy(g.pix[y*g.w:(y+1)*g.w], ycc.Y[ycc.YOffset(b.Min.X, b.Min.Y+y):])
+		}
+		return g
+	}
+	for y := 0; y < g.h; y++ {
+		for x := 0; x < g.w; x++ {
+			g.pix[y*g.w+x] = color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y
+		}
+	}
+	return g
+}
+
+func (g lumaGrid) at(x, y int) int { return int(g.pix[y*g.w+x]) }
+
+// findArtwork returns the bounds of the artwork in img and what was found
+// around it, for the debug log. Black bars are trimmed first; if what is
+// left is still wider than tall (or taller than wide), a background either
+// side of a centred picture is looked for by the edge where it begins.
+func findArtwork(img image.Image) (image.Rectangle, string) {
+	g := newLumaGrid(img)
+	r := trimBars(g)
+	var found []string
+	if r != image.Rect(0, 0, g.w, g.h) {
+		found = append(found, "black bars")
+	}
+	switch w, h := r.Dx(), r.Dy(); {
+	case w*20 > h*21:
+		if lo, hi, ok := findInset(w, h, func(i, j int) int { return g.at(r.Min.X+i, r.Min.Y+j) }); ok {
+			r.Min.X, r.Max.X = r.Min.X+lo, r.Min.X+hi
+			found = append(found, "pillarbox background")
+		}
+	case h*20 > w*21:
+		if lo, hi, ok := findInset(h, w, func(i, j int) int { return g.at(r.Min.X+j, r.Min.Y+i) }); ok {
+			r.Min.Y, r.Max.Y = r.Min.Y+lo, r.Min.Y+hi
+			found = append(found, "letterbox background")
+		}
+	}
+	if len(found) == 0 {
+		found = append(found, "no bars")
+	}
+	return r.Add(img.Bounds().Min), strings.Join(found, ", ")
+}
+
+// trimBars shrinks the bounds of g past rows and columns that are black
+// bars: letterboxing above and below, pillarboxing at the sides. An image
+// that is black throughout keeps its bounds.
+func trimBars(g lumaGrid) image.Rectangle {
+	isBar := func(n int, at func(i int) int) bool {
+		bright := 0
+		for i := 0; i < n; i++ {
+			if at(i) >= barLuma {
+				bright++
+			}
+		}
+		return bright*barOutliers <= n
+	}
+	row := func(r image.Rectangle, y int) bool {
+		return isBar(r.Dx(), func(i int) int { return g.at(r.Min.X+i, y) })
+	}
+	col := func(r image.Rectangle, x int) bool {
+		return isBar(r.Dy(), func(i int) int { return g.at(x, r.Min.Y+i) })
+	}
+
+	b := image.Rect(0, 0, g.w, g.h)
+	r := b
+	for r.Min.Y < r.Max.Y && row(r, r.Min.Y) {
+		r.Min.Y++
+	}
+	for r.Max.Y > r.Min.Y && row(r, r.Max.Y-1) {
+		r.Max.Y--
+	}
+	for r.Min.X < r.Max.X && col(r, r.Min.X) {
+		r.Min.X++
+	}
+	for r.Max.X > r.Min.X && col(r, r.Max.X-1) {
+		r.Max.X--
+	}
+	if r.Empty() {
+		return b
+	}
+	return r
+}
+
+// findInset looks for a picture set on a background across n lines of m
+// pixels, at(i, j) being pixel j of line i. Walking in from each end, the
+// picture starts at the first line whose edge stands out from the
+// background passed so far. The picture must sit near the centre and the
+// background must be smooth next to it, as flat colour or a blurred copy
+// is. It returns the picture's first line and the line past its last.
+func findInset(n, m int, at func(i, j int) int) (lo, hi int, ok bool) {
+	minBar := max(2, int(float64(n)*insetMinBar))
+	if m < 16 || n < 4*minBar {
+		return 0, n, false
+	}
+	// edge[i] is the step between lines i-1 and i.
+	edge, detail := make([]float64, n), make([]float64, n)
+	for i := 0; i < n; i++ {
+		e, d := 0, 0
+		for j := 0; j < m; j++ {
+			v := at(i, j)
+			if i > 0 {
+				e += absInt(v - at(i-1, j))
+			}
+			if j > 0 {
+				d += absInt(v - at(i, j-1))
+			}
+		}
+		edge[i], detail[i] = float64(e)/float64(m), float64(d)/float64(m)
+	}
+
+	// start finds the first step that stands out, walking from line `from`
+	// by step; the background before it is every line passed.
+	start := func(from, step int) int {
+		sum := 0.0
+		for k := 1; k < n/2; k++ {
+			i := from + k*step
+			e := edge[i]
+			if step < 0 {
+				e = edge[i+1]
+			}
+			if k >= minBar && e >= insetMinEdge && e >= insetEdge*sum/float64(k-1) {
+				return i
+			}
+			sum += e
+		}
+		return -1
+	}
+	lo = start(0, 1)
+	last := start(n-1, -1)
+	if lo < 0 || last < 0 {
+		return 0, n, false
+	}
+	hi = last + 1
+	if absInt(lo-(n-hi)) > int(float64(n)*insetSkew) {
+		return 0, n, false
+	}
+
+	inside := median(detail[lo:hi])
+	background := median(append(append([]float64{}, detail[:lo]...), detail[hi:]...))
+	if background > insetDetail*inside {
+		return 0, n, false
+	}
+	return lo, hi, true
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
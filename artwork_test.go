@@ -0,0 +1,158 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// artworkLuma is a detailed, bright picture: neighbouring pixels differ a
+// lot and none is dark enough to pass for a black bar.
+func artworkLuma(x, y int) uint8 {
+	h := uint32(x)*73856093 ^ uint32(y)*19349663
+	h ^= h >> 13
+	return uint8(64 + h%192)
+}
+
+// blurLuma is a smooth gradient, as a blurred, darkened copy of the cover
+// looks once scaled up behind it.
+func blurLuma(x, y int) uint8 {
+	return uint8(50 + y/4 + x/8)
+}
+
+// framedGray draws art inside inner and background elsewhere.
+func framedGray(w, h int, inner image.Rectangle, background func(x, y int) uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var v uint8
+			if image.Pt(x, y).In(inner) {
+				v = artworkLuma(x, y)
+			} else {
+				v = background(x, y)
+			}
+			img.SetGray(x, y, color.Gray{v})
+		}
+	}
+	return img
+}
+
+func flat(v uint8) func(x, y int) uint8 { return func(int, int) uint8 { return v } }
+
+func TestFindArtwork(t *testing.T) {
+	// A coloured cover on black bars, as an RGBA image.
+	rgba := image.NewRGBA(image.Rect(0, 0, 320, 180))
+	for y := 0; y < 180; y++ {
+		for x := 70; x < 250; x++ {
+			v := artworkLuma(x, y)
+			rgba.Set(x, y, color.RGBA{v, 255 - v/2, v / 2, 255})
+		}
+	}
+	rgba.Set(10, 90, color.RGBA{255, 255, 255, 255}) // a logo pixel in the bar
+
+	// A JPEG-like image whose bounds do not start at the origin.
+	ycc := image.NewYCbCr(image.Rect(0, 0, 420, 200), image.YCbCrSubsampleRatio420)
+	for i := range ycc.Y {
+		ycc.Y[i] = 80
+	}
+	for y := 0; y < 200; y++ {
+		for x := 120; x < 300; x++ {
+			ycc.Y[ycc.YOffset(x, y)] = artworkLuma(x, y)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		img   image.Image
+		want  image.Rectangle
+		found string
+	}{
+		{"black pillarbox", rgba, image.Rect(70, 0, 250, 180), "black bars"},
+		{"black letterbox and pillarbox", framedGray(320, 240, image.Rect(70, 30, 250, 210), flat(12)),
+			image.Rect(70, 30, 250, 210), "black bars"},
+		{"flat pillarbox", framedGray(320, 180, image.Rect(70, 0, 250, 180), flat(128)),
+			image.Rect(70, 0, 250, 180), "pillarbox background"},
+		{"blurred pillarbox", framedGray(320, 180, image.Rect(70, 0, 250, 180), blurLuma),
+			image.Rect(70, 0, 250, 180), "pillarbox background"},
+		{"flat letterbox", framedGray(180, 320, image.Rect(0, 70, 180, 250), flat(200)),
+			image.Rect(0, 70, 180, 250), "letterbox background"},
+		{"black bars around a blurred pillarbox", framedGray(400, 180, image.Rect(110, 0, 290, 180), func(x, y int) uint8 {
+			if x < 40 || x >= 360 {
+				return 0
+			}
+			return blurLuma(x, y)
+		}), image.Rect(110, 0, 290, 180), "black bars, pillarbox background"},
+		{"offset bounds", ycc.SubImage(image.Rect(50, 20, 370, 200)),
+			image.Rect(120, 20, 300, 200), "pillarbox background"},
+
+		// Nothing to trim: the whole image, which cropping then centres.
+		{"no bars", framedGray(320, 180, image.Rect(0, 0, 320, 180), nil),
+			image.Rect(0, 0, 320, 180), "no bars"},
+		{"square", framedGray(200, 200, image.Rect(0, 0, 200, 200), nil),
+			image.Rect(0, 0, 200, 200), "no bars"},
+		{"all black", framedGray(320, 180, image.Rectangle{}, flat(0)),
+			image.Rect(0, 0, 320, 180), "no bars"},
+		{"detailed background", framedGray(320, 180, image.Rect(70, 0, 250, 180), func(x, y int) uint8 {
+			return artworkLuma(y, x) / 2
+		}), image.Rect(0, 0, 320, 180), "no bars"},
+		{"off-centre picture", framedGray(320, 180, image.Rect(10, 0, 190, 180), flat(128)),
+			image.Rect(0, 0, 320, 180), "no bars"},
+	}
+	for _, tt := range tests {
+		got, found := findArtwork(tt.img)
+		if got != tt.want || found != tt.found {
+			t.Errorf("%s: findArtwork() = %v, %q; want %v, %q", tt.name, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestTrimBars(t *testing.T) {
+	tests := []struct {
+		name string
+		img  *image.Gray
+		want image.Rectangle
+	}{
+		{"pillarbox", framedGray(320, 180, image.Rect(70, 0, 250, 180), flat(0)), image.Rect(70, 0, 250, 180)},
+		{"letterbox", framedGray(320, 240, image.Rect(0, 30, 320, 210), flat(barLuma-1)), image.Rect(0, 30, 320, 210)},
+		{"grey bars stay", framedGray(320, 180, image.Rect(70, 0, 250, 180), flat(barLuma)), image.Rect(0, 0, 320, 180)},
+		{"no bars", framedGray(64, 64, image.Rect(0, 0, 64, 64), nil), image.Rect(0, 0, 64, 64)},
+		{"all black", framedGray(64, 64, image.Rectangle{}, flat(0)), image.Rect(0, 0, 64, 64)},
+	}
+	for _, tt := range tests {
+		if got := trimBars(newLumaGrid(tt.img)); got != tt.want {
+			t.Errorf("%s: trimBars() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindInset(t *testing.T) {
+	lines := func(lo, hi int, background func(i, j int) uint8) func(i, j int) int {
+		return func(i, j int) int {
+			if i >= lo && i < hi {
+				return int(artworkLuma(i, j))
+			}
+			return int(background(i, j))
+		}
+	}
+	tests := []struct {
+		name   string
+		n, m   int
+		at     func(i, j int) int
+		lo, hi int
+		ok     bool
+	}{
+		{"flat", 320, 180, lines(70, 250, flat(90)), 70, 250, true},
+		{"blurred", 320, 180, lines(70, 250, blurLuma), 70, 250, true},
+		{"narrow background", 200, 180, lines(10, 190, flat(90)), 10, 190, true},
+		{"background too thin", 200, 180, lines(1, 199, flat(90)), 0, 200, false},
+		{"no background", 320, 180, lines(0, 320, flat(90)), 0, 320, false},
+		{"flat throughout", 320, 180, lines(0, 0, flat(90)), 0, 320, false},
+		{"too small", 40, 12, lines(10, 30, flat(90)), 0, 40, false},
+	}
+	for _, tt := range tests {
+		lo, hi, ok := findInset(tt.n, tt.m, tt.at)
+		if lo != tt.lo || hi != tt.hi || ok != tt.ok {
+			t.Errorf("%s: findInset() = %d, %d, %v; want %d, %d, %v", tt.name, lo, hi, ok, tt.lo, tt.hi, tt.ok)
+		}
+	}
+}
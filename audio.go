@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ─── Audio Formats ────────────────────────────────────────────────────────────
+
+// coverStyle is how a container stores cover art.
+type coverStyle int
+
+const (
+	coverNone     coverStyle = iota // no cover support (WAV)
+	coverID3                        // ID3v2 APIC frame
+	coverAttached                   // attached_pic video stream: MP4 covr atom, FLAC PICTURE block
+	coverVorbis                     // METADATA_BLOCK_PICTURE Vorbis comment (Ogg, Opus)
+)
+
+// audioFormat describes one --audio-format target.
+type audioFormat struct {
+	name     string // --audio-format value
+	codec    string // yt-dlp --audio-format value
+	ext      string // extension of the file yt-dlp writes
+	muxer    string // ffmpeg -f used when rewriting tags and cover art
+	cover    coverStyle
+	lossless bool // --audio-quality does not apply
+}
+
+var audioFormats = []audioFormat{
+	{"mp3", "mp3", "mp3", "mp3", coverID3, false},
+	{"m4a", "m4a", "m4a", "ipod", coverAttached, false},
+	{"opus", "opus", "opus", "ogg", coverVorbis, false},
+	{"flac", "flac", "flac", "flac", coverAttached, true},
+	{"ogg", "vorbis", "ogg", "ogg", coverVorbis, false},
+	{"wav", "wav", "wav", "wav", coverNone, true},
+}
+
+// audioFormatBest keeps the source stream as-is; the container, and so the
+// cover style, is only known once yt-dlp has finished.
+const audioFormatBest = "best"
+
+func findAudioFormat(name string) (audioFormat, bool) {
+	for _, f := range audioFormats {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return audioFormat{}, false
+}
+
+// audioFormatForFile picks the table entry from a downloaded file's
+// extension. Unknown containers get no cover and ffmpeg's own muxer choice.
+func audioFormatForFile(path string) audioFormat {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	for _, f := range audioFormats {
+		if f.ext == ext {
+			return f
+		}
+	}
+	return audioFormat{name: ext, ext: ext}
+}
+
+func audioFormatNames() []string {
+	names := make([]string, 0, len(audioFormats)+1)
+	for _, f := range audioFormats {
+		names = append(names, f.name)
+	}
+	return append(names, audioFormatBest)
+}
+
+// muxerArgs are the ffmpeg output options needed to keep tags intact when
+// the file is rewritten: the --id3-version tag, and MP4's opt-in for the
+// free-form STREAMLINE_* tags.
+func (f audioFormat) muxerArgs() []string {
+	switch {
+	case f.cover == coverID3:
+		return []string{"-id3v2_version", strconv.Itoa(opts.id3Version)}
+	case f.muxer == "ipod":
+		return []string{"-movflags", "use_metadata_tags"}
+	}
+	return nil
+}
+
+// ─── Audio Quality ────────────────────────────────────────────────────────────
+
+// audioEncoding is the effective result of --audio-format and
+// --audio-quality: what yt-dlp is asked to produce.
+type audioEncoding struct {
+	preset     string // named preset, "" when none was used
+	format     string // audioFormats name or audioFormatBest
+	quality    string // yt-dlp --audio-quality: "0"–"9" (VBR) or "192K" (CBR); "" for its default
+	sampleRate int    // Hz; 0 keeps the source rate
+	channels   int    // 0 keeps the source layout
+}
+
+// audioPresets are the named --audio-quality values. A preset's format
+// only applies when --audio-format is not given.
+var audioPresets = []struct {
+	name string
+	enc  audioEncoding
+}{
+	{"archive", audioEncoding{format: "flac", quality: "0"}},
+	{"mobile", audioEncoding{format: "m4a", quality: "128K", sampleRate: 44100, channels: 2}},
+	{"podcast", audioEncoding{format: "mp3", quality: "64K", sampleRate: 44100, channels: 1}},
+}
+
+// ytdlpDefaultAudioQuality is what yt-dlp uses without --audio-quality.
+const ytdlpDefaultAudioQuality = "5"
+
+var (
+	reVBRLevel   = regexp.MustCompile(`^[vV]([0-9])$`)
+	reCBRBitrate = regexp.MustCompile(`^([0-9]+)[kK]$`)
+)
+
+// parseAudioQuality turns an --audio-quality value into an encoding with
+// the format left empty unless a preset names one.
+func parseAudioQuality(s string) (audioEncoding, error) {
+	if s == "" {
+		return audioEncoding{}, nil
+	}
+	for _, p := range audioPresets {
+		if strings.EqualFold(p.name, s) {
+			enc := p.enc
+			enc.preset = p.name
+			return enc, nil
+		}
+	}
+	if m := reVBRLevel.FindStringSubmatch(s); m != nil {
+		return audioEncoding{quality: m[1]}, nil
+	}
+	if m := reCBRBitrate.FindStringSubmatch(s); m != nil {
+		if kbps, _ := strconv.Atoi(m[1]); kbps >= 8 && kbps <= 512 {
+			return audioEncoding{quality: m[1] + "K"}, nil
+		}
+	}
+	return audioEncoding{}, fmt.Errorf("unknown audio quality %q (want V0–V9, a bitrate such as 192k, or %s)",
+		s, strings.Join(audioPresetNames(), ", "))
+}
+
+func audioPresetNames() []string {
+	names := make([]string, len(audioPresets))
+	for i, p := range audioPresets {
+		names[i] = p.name
+	}
+	return names
+}
+
+// validateAudioOptions resolves --audio-format and --audio-quality into
+// opts.encoding.
+func validateAudioOptions() error {
+	enc, err := parseAudioQuality(opts.audioQuality)
+	if err != nil {
+		return err
+	}
+	if opts.audioFormat != "" {
+		enc.format = opts.audioFormat
+	}
+	if enc.format == "" {
+		enc.format = "mp3"
+	}
+
+	f, ok := findAudioFormat(enc.format)
+	if !ok && enc.format != audioFormatBest {
+		return fmt.Errorf("unknown audio format %q (want %s)", enc.format, strings.Join(audioFormatNames(), ", "))
+	}
+	if enc.format == audioFormatBest || f.lossless {
+		if enc.preset == "" && enc.quality != "" {
+			return fmt.Errorf("--audio-quality has no effect with --audio-format %s", enc.format)
+		}
+		enc.quality = ""
+	}
+	opts.encoding = enc
+	debugLog("Audio encoding: %s", enc.describe())
+	return nil
+}
+
+// ytdlpArgs are the yt-dlp options that apply the encoding.
+func (e audioEncoding) ytdlpArgs() []string {
+	codec := e.format
+	if f, ok := findAudioFormat(e.format); ok {
+		codec = f.codec
+	}
+	args := []string{"--audio-format", codec}
+	if e.quality != "" {
+		args = append(args, "--audio-quality", e.quality)
+	}
+	var pp []string
+	if e.sampleRate > 0 {
+		pp = append(pp, "-ar", strconv.Itoa(e.sampleRate))
+	}
+	if e.channels > 0 {
+		pp = append(pp, "-ac", strconv.Itoa(e.channels))
+	}
+	if len(pp) > 0 {
+		args = append(args, "--postprocessor-args", "ExtractAudio:"+strings.Join(pp, " "))
+	}
+	return args
+}
+
+// describe renders the effective settings, e.g. "mp3 CBR 64k, 44100 Hz, mono".
+func (e audioEncoding) describe() string {
+	if e.format == audioFormatBest {
+		return "source stream, not re-encoded"
+	}
+	parts := []string{e.format}
+	if f, _ := findAudioFormat(e.format); f.lossless {
+		parts[0] += " lossless"
+	} else {
+		q := e.quality
+		if q == "" {
+			q = ytdlpDefaultAudioQuality
+		}
+		if strings.HasSuffix(q, "K") {
+			parts[0] += " CBR " + strings.ToLower(q)
+		} else {
+			parts[0] += " VBR V" + q
+		}
+	}
+	if e.sampleRate > 0 {
+		parts = append(parts, fmt.Sprintf("%d Hz", e.sampleRate))
+	}
+	switch e.channels {
+	case 0:
+	case 1:
+		parts = append(parts, "mono")
+	case 2:
+		parts = append(parts, "stereo")
+	default:
+		parts = append(parts, fmt.Sprintf("%d channels", e.channels))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// findAudioFile locates the file yt-dlp produced in dir. With a fixed
+// format only that extension counts; with "best" any known audio container
+// does, and failing that anything that is not a thumbnail or side file.
+func findAudioFile(dir, format string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", classify(classFilesystem, err)
+	}
+	var fallback string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+		if format != audioFormatBest {
+			if f, _ := findAudioFormat(format); ext == f.ext {
+				return filepath.Join(dir, name), nil
+			}
+			continue
+		}
+		if f := audioFormatForFile(name); f.muxer != "" {
+			return filepath.Join(dir, name), nil
+		}
+		switch ext {
+		case "jpg", "jpeg", "png", "webp", "json", "part", "ytdl", "temp":
+		default:
+			fallback = filepath.Join(dir, name)
+		}
+	}
+	if fallback != "" {
+		return fallback, nil
+	}
+	debugLog("workDir contents follow")
+	for _, e := range entries {
+		debugLog("  %s", e.Name())
+	}
+	return "", classify(classPostprocess, fmt.Errorf("no %s file found in work directory", strings.ToUpper(format)))
+}
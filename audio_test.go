@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestAudioEncodingArgs(t *testing.T) {
+	tests := []struct {
+		enc  audioEncoding
+		want []string
+	}{
+		{audioEncoding{format: "mp3"}, []string{"--audio-format", "mp3"}},
+		{audioEncoding{format: "m4a"}, []string{"--audio-format", "m4a"}},
+		{audioEncoding{format: "opus"}, []string{"--audio-format", "opus"}},
+		{audioEncoding{format: "flac"}, []string{"--audio-format", "flac"}},
+		{audioEncoding{format: "ogg"}, []string{"--audio-format", "vorbis"}},
+		{audioEncoding{format: "wav"}, []string{"--audio-format", "wav"}},
+		{audioEncoding{format: audioFormatBest}, []string{"--audio-format", "best"}},
+
+		{audioEncoding{format: "ogg", quality: "3"}, []string{"--audio-format", "vorbis", "--audio-quality", "3"}},
+		{audioEncoding{format: "mp3", quality: "64K", sampleRate: 44100, channels: 1},
+			[]string{"--audio-format", "mp3", "--audio-quality", "64K", "--postprocessor-args", "ExtractAudio:-ar 44100 -ac 1"}},
+		{audioEncoding{format: "flac", channels: 2},
+			[]string{"--audio-format", "flac", "--postprocessor-args", "ExtractAudio:-ac 2"}},
+	}
+	for _, tt := range tests {
+		if got := tt.enc.ytdlpArgs(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v.ytdlpArgs() = %q, want %q", tt.enc, got, tt.want)
+		}
+	}
+	// yt-dlp's --audio-format choices.
+	codecs := []string{"best", "aac", "alac", "flac", "m4a", "mp3", "opus", "vorbis", "wav"}
+	for _, f := range audioFormats {
+		if !slices.Contains(codecs, f.codec) {
+			t.Errorf("--audio-format %s asks yt-dlp for %q, which it does not know", f.name, f.codec)
+		}
+	}
+}
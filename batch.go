@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ─── Batch Jobs ───────────────────────────────────────────────────────────────
+
+// job is a single URL queued for download. Each job gets its own work
+// directory so the *.mp3 / *.mp4 globs never see another item's files.
+type job struct {
+	url     string
+	index   int // 1-based position within the batch
+	total   int
+	workDir string
+
+	// Identity reported by yt-dlp; empty if the extractor gave none.
+	id        string
+	extractor string
+	title     string
+
+	// Set when the job came from a playlist, channel or set.
+	album      string
+	track      int
+	trackTotal int
+
+	// Metadata fetched before downloading; see fetchMetadata. prefetched
+	// holds yt-dlp's JSON when planning already had the full record.
+	prefetched []byte
+	info       map[string]any
+	formats    []ytdlpFormat
+	infoFile   string // the same JSON on disk, for --load-info-json
+
+	// Output path decided before downloading; see checkConflict. Empty when
+	// no early check was needed.
+	planned string // path the template predicted
+	dest    string // path chosen after applying --on-conflict
+}
+
+// result records the outcome of one job for the end-of-run summary.
+type result struct {
+	job     *job
+	output  string
+	err     error
+	elapsed time.Duration
+}
+
+// prefix returns the "[3/10] " label used on status lines in batch runs.
+// Single-URL runs keep the original unprefixed output.
+func (j *job) prefix() string {
+	if j.total <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("%s[%d/%d]%s ", colorDim, j.index, j.total, colorReset)
+}
+
+// status is printStatus scoped to a job. In JSON mode warnings and errors
+// become events carrying the job's item number and URL.
+func (j *job) status(kind, message string) {
+	if jsonOutput {
+		emitStatus(j, kind, message)
+		return
+	}
+	printStatus(kind, j.prefix()+message)
+}
+
+// fail reports a job's final error together with its class.
+func (j *job) fail(err error) {
+	class := classOf(err)
+	if jsonOutput {
+		emit(j, evError, map[string]any{
+			"message":   stripANSI(err.Error()),
+			"class":     class.String(),
+			"exit_code": class.exitCode(),
+		})
+		return
+	}
+	j.status("error", fmt.Sprintf("Failed (%s): %v", class, err))
+}
+
+// readURLs collects one URL per line from r. Blank lines and lines starting
+// with '#' or ';' are ignored so link lists can carry comments.
+func readURLs(r io.Reader) ([]string, error) {
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, scannerBufSize), scannerBufSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
+
+// collectURLs merges positional URLs with those read from the -i input.
+// An input of "-" reads from stdin.
+func collectURLs(positional []string, input string) ([]string, error) {
+	urls := append([]string(nil), positional...)
+	if input == "" {
+		return urls, nil
+	}
+
+	var r io.Reader = os.Stdin
+	if input != "-" {
+		f, err := os.Open(input)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	fromInput, err := readURLs(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", input, err)
+	}
+	debugLog("Read %d URL(s) from %s", len(fromInput), input)
+	return append(urls, fromInput...), nil
+}
+
+// planJobs expands every URL into download jobs and numbers them across the
+// whole batch. URLs that cannot be resolved are returned as failed results.
+func planJobs(ytdlpPath string, urls []string) ([]*job, []result) {
+	var (
+		jobs   []*job
+		failed []result
+	)
+	for _, url := range urls {
+		if cancelled() {
+			failed = append(failed, result{job: &job{url: url}, err: errCancelled})
+			continue
+		}
+		spinner := NewSpinner("Resolving " + url)
+		spinner.Start()
+		expanded, err := expandURL(ytdlpPath, url)
+		spinner.Stop(err == nil)
+		if err != nil {
+			j := &job{url: url}
+			j.fail(fmt.Errorf("could not resolve %s: %w", url, err))
+			failed = append(failed, result{job: j, err: err})
+			continue
+		}
+		if len(expanded) > 0 && expanded[0].album != "" {
+			printStatus("info", fmt.Sprintf("Playlist %s%s%s: %d entries",
+				colorBold, expanded[0].album, colorReset, len(expanded)))
+		}
+		jobs = append(jobs, expanded...)
+	}
+
+	for i, j := range jobs {
+		j.index, j.total = i+1, len(jobs)
+	}
+	debugLog("planJobs: %d URL(s) → %d job(s), %d failed", len(urls), len(jobs), len(failed))
+	return jobs, failed
+}
+
+// downloadFunc is the signature shared by audioDownload and videoDownload.
+type downloadFunc func(ytdlpPath, ffmpegPath string, j *job) (string, error)
+
+// runBatch downloads the jobs on a pool of workers, each job in its own work
+// directory. A failing item is recorded and the batch moves on; the caller
+// decides the exit code from the results, which keep the input order.
+func runBatch(jobs []*job, workers int, download downloadFunc, ytdlpPath, ffmpegPath, workDir string) []result {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	debugLog("runBatch: %d job(s) on %d worker(s)", len(jobs), workers)
+
+	results := make([]result, len(jobs))
+	overall := newBatchProgress(len(jobs))
+	queue := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				overall.started()
+				results[i] = runJob(jobs[i], download, ytdlpPath, ffmpegPath, workDir)
+				overall.finished(results[i].err)
+
+				// Sequential runs keep a blank line between items for readability.
+				if workers == 1 && jobs[i].total > 1 && jobs[i].index < jobs[i].total {
+					term.println("")
+				}
+			}
+		}()
+	}
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	overall.close()
+	return results
+}
+
+// runJob downloads a single job inside its own work directory.
+func runJob(j *job, download downloadFunc, ytdlpPath, ffmpegPath, workDir string) result {
+	if cancelled() {
+		return result{job: j, err: errCancelled}
+	}
+	start := time.Now()
+	emit(j, evStarted, nil)
+
+	j.workDir = filepath.Join(workDir, fmt.Sprintf("item-%04d", j.index))
+	output, err := "", os.MkdirAll(j.workDir, 0755)
+	if err == nil {
+		output, err = download(ytdlpPath, ffmpegPath, j)
+	}
+	switch {
+	case errors.Is(err, errSkipped):
+		emit(j, evSkipped, map[string]any{"reason": err.Error()})
+	case err != nil:
+		j.fail(err)
+	case opts.dryRun:
+		// Reported as a plan event; there is no file to describe.
+	default:
+		emitFinished(j, output, start)
+		runHooks(j, output)
+	}
+	debugLog("Cleaning up item work directory: %s", j.workDir)
+	os.RemoveAll(j.workDir)
+
+	return result{job: j, output: output, err: err, elapsed: time.Since(start)}
+}
+
+// batchProgress renders the "Overall" footer below the per-job rows.
+// Single-item runs show no footer.
+type batchProgress struct {
+	mu                           sync.Mutex
+	total, done, failed, running int
+	start                        time.Time
+}
+
+func newBatchProgress(total int) *batchProgress {
+	b := &batchProgress{total: total, start: time.Now()}
+	b.render()
+	return b
+}
+
+func (b *batchProgress) started() {
+	b.mu.Lock()
+	b.running++
+	b.mu.Unlock()
+	b.render()
+}
+
+func (b *batchProgress) finished(err error) {
+	b.mu.Lock()
+	b.running--
+	b.done++
+	if err != nil && !errors.Is(err, errSkipped) {
+		b.failed++
+	}
+	b.mu.Unlock()
+	b.render()
+}
+
+func (b *batchProgress) close() {
+	term.setFooter("")
+}
+
+func (b *batchProgress) render() {
+	if b.total <= 1 {
+		return
+	}
+	b.mu.Lock()
+	const width = 30
+	filled := b.done * width / b.total
+	line := fmt.Sprintf("%sOverall%s %s%s%s%s%s │ %s%d/%d done%s │ %d active │ %s%d failed%s │ %s",
+		colorBold, colorReset,
+		colorGreen, strings.Repeat("█", filled), colorDim, strings.Repeat("░", width-filled), colorReset,
+		colorCyan, b.done, b.total, colorReset,
+		b.running,
+		colorRed, b.failed, colorReset,
+		formatDuration(time.Since(b.start).Seconds()))
+	b.mu.Unlock()
+	term.setFooter(line)
+}
+
+// printSummary lists the outcome of every item. Skipped items are listed but
+// not counted as failures. Nothing is printed for a single-URL run; its own
+// output already says it all.
+func printSummary(results []result) {
+	failed, skipped := 0, 0
+	for _, r := range results {
+		switch {
+		case errors.Is(r.err, errSkipped):
+			skipped++
+		case r.err != nil:
+			failed++
+		}
+	}
+	if jsonOutput {
+		emit(nil, evSummary, map[string]any{
+			"succeeded": len(results) - failed - skipped,
+			"skipped":   skipped,
+			"failed":    failed,
+			"dry_run":   opts.dryRun,
+		})
+		return
+	}
+	if len(results) <= 1 {
+		return
+	}
+
+	fmt.Printf("\n%s┌─ Summary ───────────────────────────────────┐%s\n", colorYellow, colorReset)
+	for _, r := range results {
+		switch {
+		case errors.Is(r.err, errSkipped):
+			fmt.Printf("  %s↷%s %s  %s%v%s\n", colorYellow, colorReset, r.job.url, colorDim, r.err, colorReset)
+		case r.err != nil:
+			fmt.Printf("  %s✗%s %s  %s[%s] %v%s\n", colorRed, colorReset, r.job.url,
+				colorDim, classOf(r.err), r.err, colorReset)
+		default:
+			fmt.Printf("  %s✓%s %s  %s→ %s (%s)%s\n", colorGreen, colorReset, r.job.url,
+				colorDim, r.output, formatDuration(r.elapsed.Seconds()), colorReset)
+		}
+	}
+	fmt.Printf("%s└─────────────────────────────────────────────┘%s\n", colorYellow, colorReset)
+
+	color := colorGreen
+	if failed > 0 {
+		color = colorRed
+	}
+	succeeded := "succeeded"
+	if opts.dryRun {
+		succeeded = "to download"
+	}
+	fmt.Printf("%s%d %s, %d skipped, %d failed%s\n", color, len(results)-failed-skipped, succeeded, skipped, failed, colorReset)
+}
@@ -9,6 +9,9 @@ import (
 	"runtime"
 )
 
+// bundledBuild reports whether yt-dlp and ffmpeg are embedded in the binary.
+const bundledBuild = true
+
 //go:embed yt-dlp
 var ytDLP []byte
 
@@ -18,9 +21,12 @@ var ffmpegBin []byte
 // resolveBinaries extracts the embedded yt-dlp and ffmpeg binaries into a
 // temporary directory. Returns their paths and a cleanup function that removes
 // the temp dir on exit. Built with: go build -tags bundled
-func resolveBinaries() (ytdlpPath, ffmpegPath string, cleanup func()) {
+func resolveBinaries() (ytdlpPath, ffmpegPath string, cleanup func(), err error) {
+	cleanup = func() {}
 	tempDir, err := os.MkdirTemp("", "streamline-bins")
-	check(err)
+	if err != nil {
+		return "", "", cleanup, classify(classFilesystem, err)
+	}
 	cleanup = func() { os.RemoveAll(tempDir) }
 
 	// Windows does not honour the Unix execute bit; 0666 is sufficient there
@@ -32,8 +38,12 @@ func resolveBinaries() (ytdlpPath, ffmpegPath string, cleanup func()) {
 	ytdlpPath = filepath.Join(tempDir, exeName("yt-dlp"))
 	ffmpegPath = filepath.Join(tempDir, exeName("ffmpeg"))
 
-	check(os.WriteFile(ytdlpPath, ytDLP, perm))
-	check(os.WriteFile(ffmpegPath, ffmpegBin, perm))
+	if err := os.WriteFile(ytdlpPath, ytDLP, perm); err != nil {
+		return "", "", cleanup, classify(classFilesystem, err)
+	}
+	if err := os.WriteFile(ffmpegPath, ffmpegBin, perm); err != nil {
+		return "", "", cleanup, classify(classFilesystem, err)
+	}
 
-	return ytdlpPath, ffmpegPath, cleanup
+	return ytdlpPath, ffmpegPath, cleanup, nil
 }
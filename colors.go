@@ -31,6 +31,28 @@ func init() {
 }
 
 func isTerminal() bool {
-	fi, err := os.Stdout.Stat()
-	return err == nil && (fi.Mode()&os.ModeCharDevice) != 0
+	return isCharDevice(os.Stdout)
+}
+
+// noPrompts is set by serve, whose downloads have nobody to answer a prompt
+// even when it was started from a terminal.
+var noPrompts bool
+
+// stdinIsTerminal reports whether prompts can be answered; when it is false
+// (cron, pipes, CI, serve) video mode picks its default quality instead of
+// asking.
+func stdinIsTerminal() bool {
+	return !noPrompts && isCharDevice(os.Stdin)
+}
+
+// isCharDevice approximates isatty with the standard library. /dev/null is a
+// character device too, so it is ruled out explicitly: `< /dev/null` is the
+// usual way to say "never prompt".
+func isCharDevice(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(fi, null)
 }
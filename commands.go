@@ -0,0 +1,222 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ─── Commands ─────────────────────────────────────────────────────────────────
+
+// command is one `streamline <name>` subcommand. The table drives dispatch,
+// the command list in usage() and per-command --help.
+type command struct {
+	name    string
+	args    string // argument synopsis for the usage line
+	summary string
+	flags   flagGroup
+	run     func(cmd *command, args []string) int
+	usage   func()   // help for commands with their own sub-commands
+	subs    []string // those sub-commands, for shell completion
+}
+
+const downloadFlags = groupConfig | groupOutput | groupArchive | groupDownload
+
+// legacyFlags are what the command-less -m and -v form accepts: the flags
+// of audio and video, not those of serve or formats.
+const legacyFlags = downloadFlags | groupAudio | groupVideo | groupLegacy
+
+// commands is filled in init: the run functions refer back to the table
+// through usage(), which a package-level initializer cannot.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "audio", args: "[flags] <url>...", summary: "Download audio with metadata and cover art (-m)",
+			flags: downloadFlags | groupAudio, run: runDownload},
+		{name: "video", args: "[flags] <url>...", summary: "Download video, choosing the quality (-v)",
+			flags: downloadFlags | groupVideo, run: runDownload},
+		{name: "info", args: "[flags] <url>...", summary: "Show title, uploader, duration and size without downloading",
+			flags: groupOutput, run: runInfo},
+		{name: "formats", args: "[flags] <url>...", summary: "List the video and audio streams a URL offers",
+			flags: groupOutput | groupFormats, run: runFormats},
+		{name: "doctor", args: "[flags]", summary: "Check yt-dlp, ffmpeg and ffprobe versions, encoders and the temp dir",
+			flags: groupOutput, run: runDoctor},
+		{name: "archive", args: "list|remove|prune [flags]", summary: "Manage the download archive",
+			flags: groupArchive, subs: []string{"list", "remove", "prune"},
+			run: func(_ *command, args []string) int { return runArchiveCommand(args) }, usage: archiveUsage},
+		{name: "config", args: "show|path|profiles [flags]", summary: "Show the effective settings, config file or profiles",
+			flags: groupAll, subs: []string{"show", "path", "profiles"},
+			run: func(_ *command, args []string) int { return runConfigCommand(args) }, usage: configUsage},
+		{name: "serve", args: "[flags]", summary: "Take downloads over a local HTTP API (POST /downloads)",
+			flags: downloadFlags | groupAudio | groupVideo | groupServe, run: runServe},
+		{name: "completion", args: strings.Join(completionShells, "|"), summary: "Print a shell completion script",
+			subs: completionShells, run: runCompletion},
+		{name: "help", args: "[command]", summary: "Show help for streamline or one command",
+			run: runHelp},
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// commandUsage is the --help output of a command built on newFlagSet.
+func commandUsage(cmd *command, fs *flag.FlagSet) {
+	fmt.Printf("%sUsage:%s\n  streamline %s %s\n\n%s\n\n%sFlags:%s\n",
+		colorYellow, colorReset, cmd.name, cmd.args, cmd.summary, colorYellow, colorReset)
+	printFlags(fs)
+	fmt.Println()
+}
+
+// isHelp reports whether arg asks for help, for commands that take a
+// sub-command before any flags.
+func isHelp(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help" || arg == "help"
+}
+
+// parseCommandFlags sets up the flags of cmd, parses args and applies
+// --debug and --output-format. ok is false when the command should return
+// code straight away.
+func parseCommandFlags(cmd *command, args []string) (positional []string, cli *cliFlags, code int, ok bool) {
+	fs, cli := newFlagSet("streamline "+cmd.name, cmd.flags, &opts)
+	fs.Usage = func() { commandUsage(cmd, fs) }
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return nil, nil, exitOK, false
+		}
+		return nil, nil, exitUsage, false
+	}
+	enableDebug(cli)
+	if err := parseOutputFormat(*cli.outFormat); err != nil {
+		printStatus("error", err.Error())
+		return nil, nil, exitUsage, false
+	}
+	if jsonOutput {
+		term.setQuiet()
+	}
+	return positional, cli, exitOK, true
+}
+
+func runHelp(_ *command, args []string) int {
+	if len(args) == 0 {
+		usage()
+		return exitOK
+	}
+	cmd := findCommand(args[0])
+	switch {
+	case cmd == nil:
+		printStatus("error", fmt.Sprintf("Unknown command %q", args[0]))
+		return exitUsage
+	case cmd.usage != nil:
+		cmd.usage()
+	default:
+		fs, _ := newFlagSet("", cmd.flags, new(options))
+		commandUsage(cmd, fs)
+	}
+	return exitOK
+}
+
+// ─── info and formats ─────────────────────────────────────────────────────────
+
+func runInfo(cmd *command, args []string) int {
+	urls, _, code, ok := parseCommandFlags(cmd, args)
+	if !ok {
+		return code
+	}
+	if len(urls) == 0 {
+		runHelp(nil, []string{cmd.name})
+		return exitUsage
+	}
+	return inspectURLs(urls, func(j *job) {
+		j.status("info", fmt.Sprintf("URL: %s%s%s", colorBlue, j.url, colorReset))
+		emitMetadata(j, "video")
+		showMetadata(j, false)
+	})
+}
+
+func runFormats(cmd *command, args []string) int {
+	urls, cli, code, ok := parseCommandFlags(cmd, args)
+	if !ok {
+		return code
+	}
+	if len(urls) == 0 {
+		runHelp(nil, []string{cmd.name})
+		return exitUsage
+	}
+	key := *cli.sort
+	if key != "" && !strings.Contains("|"+sortKeys(videoSorts)+"|"+sortKeys(audioSorts)+"|", "|"+key+"|") {
+		printStatus("error", fmt.Sprintf("Unknown sort key %q", key))
+		return exitUsage
+	}
+
+	return inspectURLs(urls, func(j *job) {
+		video, audio := splitFormats(j.formats)
+		sortFormats(video, videoSorts, "res")
+		sortFormats(audio, audioSorts, "rate")
+		sortFormats(video, videoSorts, key)
+		sortFormats(audio, audioSorts, key)
+		emit(j, evFormats, map[string]any{"title": j.title, "video": video, "audio": audio})
+		if jsonOutput {
+			return
+		}
+		term.hold(func() {
+			fmt.Printf("\n%s%s%s\n", colorBold, j.title, colorReset)
+			fmt.Printf("%s── Video streams ──%s\n", colorYellow, colorReset)
+			printVideoTable(os.Stdout, video)
+			fmt.Printf("%s── Audio streams ──%s\n", colorYellow, colorReset)
+			printAudioTable(os.Stdout, audio)
+		})
+	})
+}
+
+// inspectURLs fetches the metadata of every URL (playlists expand to their
+// entries) and hands each job to show. Nothing is downloaded.
+func inspectURLs(urls []string, show func(j *job)) int {
+	ytdlpPath, _, cleanup, err := resolveBinaries()
+	atCleanup(cleanup)
+	if err != nil {
+		printStatus("error", err.Error())
+		return classOf(err).exitCode()
+	}
+	workDir, err := os.MkdirTemp("", "streamline-work")
+	if err != nil {
+		printStatus("error", err.Error())
+		return exitFilesystem
+	}
+	atCleanup(func() { os.RemoveAll(workDir) })
+
+	jobs, results := planJobs(ytdlpPath, urls)
+	for _, j := range jobs {
+		if cancelled() {
+			results = append(results, result{job: j, err: errCancelled})
+			continue
+		}
+		j.workDir = filepath.Join(workDir, fmt.Sprintf("item-%04d", j.index))
+		err := os.MkdirAll(j.workDir, 0o755)
+		if err == nil {
+			err = fetchMetadata(ytdlpPath, j)
+		}
+		if err != nil {
+			j.fail(err)
+		} else {
+			show(j)
+		}
+		results = append(results, result{job: j, err: err})
+		if j.index < j.total {
+			term.println("")
+		}
+	}
+	if cancelled() {
+		return exitCancelled
+	}
+	return batchExitCode(results)
+}
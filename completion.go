@@ -0,0 +1,555 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ─── Shell Completion ─────────────────────────────────────────────────────────
+
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// complFlag is a flag as the completion scripts offer it.
+type complFlag struct {
+	name   string // as typed: "-m", "--jobs"
+	help   string
+	arg    string   // value placeholder; empty for switches
+	values []string // fixed choices for the value
+	kind   string   // "file", "dir" or "profile" for values that are not choices
+	repeat bool
+}
+
+// complCommand is a command with its sub-commands and flags. The
+// command-less form (-m/-v) has an empty name.
+type complCommand struct {
+	name, summary string
+	subs          []string
+	flags         []complFlag
+	urls          bool // takes URLs as arguments
+}
+
+// flagChoices are the values of flags that take one of a fixed set.
+var flagChoices = map[string]func() []string{
+	"audio-format":    audioFormatNames,
+	"audio-quality":   audioPresetNames,
+	"quality":         videoPresetNames,
+	"default-quality": videoPresetNames,
+	"on-conflict":     func() []string { return conflictPolicies },
+	"output-format":   func() []string { return []string{"text", "json"} },
+	"id3-version":     func() []string { return []string{"3", "4"} },
+	"remastered":      func() []string { return remasteredModes },
+	"cover-crop":      func() []string { return coverCropModes },
+	"cover-format":    func() []string { return coverFormats },
+	"prefer-codec": func() []string {
+		codecs := make([]string, 0, len(videoCodecs))
+		for c := range videoCodecs {
+			codecs = append(codecs, c)
+		}
+		sort.Strings(codecs)
+		return codecs
+	},
+	"sort": func() []string {
+		var keys []string
+		for _, k := range strings.Split(sortKeys(videoSorts)+"|"+sortKeys(audioSorts), "|") {
+			if !containsString(keys, k) {
+				keys = append(keys, k)
+			}
+		}
+		return keys
+	},
+}
+
+// flagKinds says how to complete the value of flags without choices.
+var flagKinds = map[string]string{
+	"i":               "file",
+	"archive":         "file",
+	"config":          "file",
+	"metadata-source": "file",
+	"cover-file":      "file",
+	"dir":             "dir",
+	"profile":         "profile",
+}
+
+// completionModel describes the command-less form followed by every
+// command, straight from the command table and the flag sets, so the
+// scripts never fall behind the flags.
+func completionModel() []complCommand {
+	model := []complCommand{{flags: complFlags(legacyFlags), urls: true}}
+	names := make([]string, len(commands))
+	for i, cmd := range commands {
+		names[i] = cmd.name
+	}
+	for _, cmd := range commands {
+		c := complCommand{
+			name:    cmd.name,
+			summary: cmd.summary,
+			subs:    cmd.subs,
+			flags:   complFlags(cmd.flags),
+			urls:    strings.Contains(cmd.args, "<url>"),
+		}
+		if cmd.name == "help" {
+			c.subs = names
+		}
+		model = append(model, c)
+	}
+	return model
+}
+
+func complFlags(groups flagGroup) []complFlag {
+	fs, _ := newFlagSet("", groups, new(options))
+	var list []complFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		arg, help := flag.UnquoteUsage(f)
+		c := complFlag{name: "--" + f.Name, help: help, arg: arg, kind: flagKinds[f.Name]}
+		if len(f.Name) == 1 {
+			c.name = "-" + f.Name
+		}
+		if choices := flagChoices[f.Name]; choices != nil {
+			c.values = choices()
+		}
+		_, c.repeat = f.Value.(*stringList)
+		list = append(list, c)
+	})
+	return list
+}
+
+// allFlags lists every flag of the model once, in the order first seen.
+// A flag takes the same kind of value in every command.
+func allFlags(model []complCommand) []complFlag {
+	var list []complFlag
+	seen := map[string]bool{}
+	for _, c := range model {
+		for _, f := range c.flags {
+			if !seen[f.name] {
+				seen[f.name] = true
+				list = append(list, f)
+			}
+		}
+	}
+	return list
+}
+
+// valueFlags names the flags that take a value, so the scripts can skip
+// that value when they look for the command.
+func valueFlags(model []complCommand) []string {
+	var names []string
+	for _, f := range allFlags(model) {
+		if f.arg != "" {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func runCompletion(cmd *command, args []string) int {
+	shells, _, code, ok := parseCommandFlags(cmd, args)
+	if !ok {
+		return code
+	}
+	if len(shells) != 1 {
+		runHelp(nil, []string{cmd.name})
+		return exitUsage
+	}
+	model := completionModel()
+	switch shells[0] {
+	case "bash":
+		writeBashCompletion(os.Stdout, model)
+	case "zsh":
+		writeZshCompletion(os.Stdout, model)
+	case "fish":
+		writeFishCompletion(os.Stdout, model)
+	case "powershell":
+		writePowerShellCompletion(os.Stdout, model)
+	default:
+		printStatus("error", fmt.Sprintf("Unknown shell %q (want %s)", shells[0], strings.Join(completionShells, ", ")))
+		return exitUsage
+	}
+	return exitOK
+}
+
+// ─── bash ─────────────────────────────────────────────────────────────────────
+
+func writeBashCompletion(w io.Writer, model []complCommand) {
+	fmt.Fprint(w, `# bash completion for streamline
+# Load with: source <(streamline completion bash)
+
+_streamline() {
+    local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+    local cmd= sub= skip= word i
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        word=${COMP_WORDS[i]}
+        if [[ -n $skip ]]; then
+            skip=
+        elif [[ $word == -* ]]; then
+`)
+	fmt.Fprintf(w, "            [[ \" %s \" == *\" $word \"* ]] && skip=1\n", strings.Join(valueFlags(model), " "))
+	fmt.Fprint(w, `        elif [[ $i == 1 ]]; then
+            cmd=$word
+        elif [[ -z $sub ]]; then
+            sub=$word
+        fi
+    done
+
+    case $prev in
+`)
+	// Flags whose values complete the same way share a case.
+	var order []string
+	groups := map[string][]string{}
+	for _, f := range allFlags(model) {
+		if f.arg == "" {
+			continue
+		}
+		var action string
+		switch {
+		case f.values != nil:
+			action = fmt.Sprintf(`COMPREPLY=($(compgen -W "%s" -- "$cur"))`, strings.Join(f.values, " "))
+		case f.kind == "file":
+			action = `COMPREPLY=($(compgen -f -- "$cur"))`
+		case f.kind == "dir":
+			action = `COMPREPLY=($(compgen -d -- "$cur"))`
+		case f.kind == "profile":
+			action = `COMPREPLY=($(compgen -W "$("${COMP_WORDS[0]}" config profiles 2>/dev/null)" -- "$cur"))`
+		}
+		if _, ok := groups[action]; !ok {
+			order = append(order, action)
+		}
+		groups[action] = append(groups[action], f.name)
+	}
+	for _, action := range order {
+		fmt.Fprintf(w, "    %s)\n", strings.Join(groups[action], "|"))
+		if action != "" {
+			fmt.Fprintf(w, "        %s\n", action)
+		}
+		fmt.Fprint(w, "        return ;;\n")
+	}
+	fmt.Fprint(w, `    esac
+
+    local flags= subs=
+    case $cmd in
+`)
+	flagNames := func(c complCommand) string {
+		names := make([]string, len(c.flags))
+		for i, f := range c.flags {
+			names[i] = f.name
+		}
+		return strings.Join(names, " ")
+	}
+	var commandNames []string
+	for _, c := range model[1:] {
+		commandNames = append(commandNames, c.name)
+		fmt.Fprintf(w, "    %s)\n        flags=\"%s\"\n", c.name, flagNames(c))
+		if c.subs != nil {
+			fmt.Fprintf(w, "        subs=\"%s\"\n", strings.Join(c.subs, " "))
+		}
+		fmt.Fprint(w, "        ;;\n")
+	}
+	// The command-less form; a command can only be the first word.
+	fmt.Fprintf(w, "    *)\n        flags=\"%s\"\n", flagNames(model[0]))
+	fmt.Fprintf(w, "        [[ $COMP_CWORD == 1 ]] && subs=\"%s\"\n        ;;\n    esac\n", strings.Join(commandNames, " "))
+	fmt.Fprint(w, `
+    if [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+    elif [[ -n $subs && -z $sub ]]; then
+        COMPREPLY=($(compgen -W "$subs" -- "$cur"))
+    fi
+}
+
+complete -o default -F _streamline streamline
+`)
+}
+
+// ─── zsh ──────────────────────────────────────────────────────────────────────
+
+// zshQuote escapes s for a single-quoted _arguments spec.
+func zshQuote(s string) string {
+	return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`).Replace(s)
+}
+
+func zshFlagSpec(f complFlag) string {
+	spec := fmt.Sprintf("%s[%s]", f.name, zshQuote(f.help))
+	if f.repeat {
+		spec = "*" + spec
+	}
+	if f.arg != "" {
+		action := " "
+		switch {
+		case f.values != nil:
+			action = "(" + strings.Join(f.values, " ") + ")"
+		case f.kind == "file":
+			action = "_files"
+		case f.kind == "dir":
+			action = "_files -/"
+		case f.kind == "profile":
+			action = "_streamline_profiles"
+		}
+		spec += ":" + zshQuote(f.arg) + ":" + action
+	}
+	return "'" + spec + "'"
+}
+
+func writeZshCompletion(w io.Writer, model []complCommand) {
+	fmt.Fprint(w, `#compdef streamline
+# zsh completion for streamline
+# Load with: source <(streamline completion zsh), or save it as _streamline
+# in a directory on $fpath.
+
+_streamline_profiles() {
+    local -a profiles
+    profiles=(${(f)"$($_streamline_bin config profiles 2>/dev/null)"})
+    compadd -a profiles
+}
+
+_streamline() {
+    local _streamline_bin=$words[1]
+    local -a commands
+    commands=(
+`)
+	for _, c := range model[1:] {
+		fmt.Fprintf(w, "        '%s:%s'\n", c.name, strings.ReplaceAll(c.summary, "'", `'\''`))
+	}
+	fmt.Fprint(w, `    )
+    if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then
+        _describe -t commands 'streamline command' commands
+        return
+    fi
+
+    case $words[2] in
+`)
+	args := func(c complCommand) {
+		for _, f := range c.flags {
+			fmt.Fprintf(w, " \\\n            %s", zshFlagSpec(f))
+		}
+		switch {
+		case c.subs != nil:
+			fmt.Fprintf(w, " \\\n            '1:%s:(%s)'", c.name+" argument", strings.Join(c.subs, " "))
+		case c.urls:
+			fmt.Fprint(w, " \\\n            '*:url:_urls'")
+		}
+		fmt.Fprint(w, "\n        ;;\n")
+	}
+	for _, c := range model[1:] {
+		fmt.Fprintf(w, "    %s)\n        shift words\n        (( CURRENT-- ))\n        _arguments -S :", c.name)
+		args(c)
+	}
+	fmt.Fprint(w, "    *)\n        _arguments -S :")
+	args(model[0])
+	fmt.Fprint(w, `    esac
+}
+
+if [[ $zsh_eval_context[-1] == loadautofunc ]]; then
+    _streamline "$@"
+else
+    compdef _streamline streamline
+fi
+`)
+}
+
+// ─── fish ─────────────────────────────────────────────────────────────────────
+
+// fishQuote single-quotes s for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func writeFishCompletion(w io.Writer, model []complCommand) {
+	var commandNames []string
+	for _, c := range model[1:] {
+		commandNames = append(commandNames, c.name)
+	}
+	fmt.Fprintf(w, `# fish completion for streamline
+# Load with: streamline completion fish | source
+
+# __streamline_words prints the words before the cursor that are not flags
+# or flag values: the command, then its sub-command or URLs. A command is
+# only recognised as the first word.
+function __streamline_words
+    set -l words (commandline -opc)
+    set -e words[1]
+    set -l skip 0
+    for w in $words
+        if test $skip = 1
+            set skip 0
+        else if contains -- $w %s
+            set skip 1
+        else if not string match -q -- '-*' $w
+            echo $w
+        end
+    end
+end
+
+function __streamline_using -a cmd
+    set -l words (commandline -opc)
+    test "$words[2]" = "$cmd"
+end
+
+function __streamline_needs_command
+    test (count (commandline -opc)) -eq 1
+end
+
+function __streamline_needs_sub -a cmd
+    __streamline_using $cmd; and test (count (__streamline_words)) -eq 1
+end
+
+function __streamline_no_command
+    set -l words (commandline -opc)
+    not contains -- "$words[2]" %s
+end
+
+function __streamline_profiles
+    set -l bin (commandline -opc)[1]
+    $bin config profiles 2>/dev/null
+end
+
+complete -c streamline -f
+`, strings.Join(valueFlags(model), " "), strings.Join(commandNames, " "))
+
+	flags := func(cond string, c complCommand) {
+		for _, f := range c.flags {
+			line := "complete -c streamline -n " + fishQuote(cond)
+			if len(f.name) == 2 {
+				line += " -s " + f.name[1:]
+			} else {
+				line += " -l " + f.name[2:]
+			}
+			if f.arg != "" {
+				switch {
+				case f.values != nil:
+					line += " -x -a " + fishQuote(strings.Join(f.values, " "))
+				case f.kind == "file":
+					line += " -r -F"
+				case f.kind == "dir":
+					line += " -x -a '(__fish_complete_directories)'"
+				case f.kind == "profile":
+					line += " -x -a '(__streamline_profiles)'"
+				default:
+					line += " -x"
+				}
+			}
+			fmt.Fprintln(w, line+" -d "+fishQuote(f.help))
+		}
+	}
+
+	fmt.Fprintln(w, "\n# Commands")
+	for _, c := range model[1:] {
+		fmt.Fprintf(w, "complete -c streamline -n __streamline_needs_command -a %s -d %s\n", c.name, fishQuote(c.summary))
+	}
+	fmt.Fprintln(w, "\n# streamline -m|-v <url>")
+	flags("__streamline_no_command", model[0])
+	for _, c := range model[1:] {
+		fmt.Fprintf(w, "\n# streamline %s\n", c.name)
+		if c.subs != nil {
+			fmt.Fprintf(w, "complete -c streamline -n %s -a %s\n",
+				fishQuote("__streamline_needs_sub "+c.name), fishQuote(strings.Join(c.subs, " ")))
+		}
+		flags("__streamline_using "+c.name, c)
+	}
+}
+
+// ─── PowerShell ───────────────────────────────────────────────────────────────
+
+// psQuote single-quotes s for PowerShell.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func psList(list []string) string {
+	quoted := make([]string, len(list))
+	for i, s := range list {
+		quoted[i] = psQuote(s)
+	}
+	return "@(" + strings.Join(quoted, ", ") + ")"
+}
+
+func writePowerShellCompletion(w io.Writer, model []complCommand) {
+	fmt.Fprint(w, `# PowerShell completion for streamline
+# Load with: streamline completion powershell | Out-String | Invoke-Expression
+
+Register-ArgumentCompleter -Native -CommandName streamline, streamline.exe -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $commands = [ordered]@{
+`)
+	for _, c := range model[1:] {
+		fmt.Fprintf(w, "        %s = %s\n", psQuote(c.name), psQuote(c.summary))
+	}
+	fmt.Fprint(w, "    }\n    $subs = @{\n")
+	for _, c := range model[1:] {
+		if c.subs != nil {
+			fmt.Fprintf(w, "        %s = %s\n", psQuote(c.name), psList(c.subs))
+		}
+	}
+	fmt.Fprint(w, "    }\n    $flags = @{\n")
+	for _, c := range model {
+		fmt.Fprintf(w, "        %s = [ordered]@{\n", psQuote(c.name))
+		for _, f := range c.flags {
+			fmt.Fprintf(w, "            %s = %s\n", psQuote(f.name), psQuote(f.help))
+		}
+		fmt.Fprint(w, "        }\n")
+	}
+	fmt.Fprint(w, "    }\n    $values = @{\n")
+	for _, f := range allFlags(model) {
+		if f.values != nil {
+			fmt.Fprintf(w, "        %s = %s\n", psQuote(f.name), psList(f.values))
+		}
+	}
+	fmt.Fprintf(w, "    }\n    $takesValue = %s\n", psList(valueFlags(model)))
+	fmt.Fprint(w, `
+    $exe = $commandAst.CommandElements[0].ToString()
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 |
+        Where-Object { $_.Extent.EndOffset -lt $cursorPosition } | ForEach-Object { $_.ToString() })
+    # A command is only recognised as the first word.
+    $command = ''
+    if ($words.Count -gt 0 -and $commands.Contains($words[0])) {
+        $command = $words[0]
+    }
+    $sub = ''
+    $prev = ''
+    $skip = $false
+    foreach ($w in $words) {
+        if ($skip) {
+            $skip = $false
+        } elseif ($takesValue -contains $w) {
+            $skip = $true
+            $prev = $w
+        } elseif ($w -ne $command -and -not $w.StartsWith('-') -and -not $sub) {
+            $sub = $w
+        }
+    }
+
+    $complete = {
+        param($text, $tip)
+        if ($text -like "$wordToComplete*") {
+            [System.Management.Automation.CompletionResult]::new($text, $text, 'ParameterValue', $tip)
+        }
+    }
+    if ($skip) {
+        # Completing the value of $prev; anything else falls back to paths.
+        if ($prev -eq '--profile') {
+            & $exe config profiles 2>$null | ForEach-Object { & $complete $_ $_ }
+        } elseif ($values.ContainsKey($prev)) {
+            $values[$prev] | ForEach-Object { & $complete $_ $_ }
+        }
+    } elseif ($wordToComplete.StartsWith('-')) {
+        $list = $flags[$command]
+        $list.Keys | ForEach-Object { & $complete $_ $list[$_] }
+    } elseif ($words.Count -eq 0) {
+        $commands.Keys | ForEach-Object { & $complete $_ $commands[$_] }
+    } elseif (-not $sub -and $subs.ContainsKey($command)) {
+        $subs[$command] | ForEach-Object { & $complete $_ $_ }
+    }
+}
+`)
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ─── Configuration File ───────────────────────────────────────────────────────
+
+// config is a parsed config.toml: settings applied to every run, plus named
+// profiles selected with --profile. Keys are the long flag names ("jobs",
+// "audio-format"; underscores work too), so every flag is configurable
+// without a second list to keep in sync.
+//
+//	jobs = 2
+//	dir = "~/Downloads"
+//
+//	[profile.podcast]
+//	mode = "audio"
+//	audio-quality = "podcast"
+//	exec = ["notify-send 'Downloaded' \"$STREAMLINE_TITLE\""]
+type config struct {
+	path     string
+	global   []configEntry
+	profiles map[string][]configEntry
+	names    []string // profile names in file order
+}
+
+type configEntry struct {
+	key    string
+	values []string // flag.Set input; arrays give one per element
+	line   int
+}
+
+// notConfigurable are flags that only make sense for a single invocation,
+// or are spelled differently in the file (-o is "output", -m/-v are "mode").
+var notConfigurable = map[string]bool{
+	"about": true, "i": true, "config": true, "profile": true,
+	"o": true, "m": true, "v": true, "verbose": true,
+}
+
+// configKey maps a flag name to the key that sets it in the config file.
+func configKey(flagName string) string {
+	switch flagName {
+	case "o":
+		return "output"
+	case "m", "v":
+		return "mode"
+	case "verbose":
+		return "debug"
+	}
+	return flagName
+}
+
+// defaultConfigPath is streamline/config.toml in the user config directory:
+// $XDG_CONFIG_HOME or ~/.config on Linux, ~/Library/Application Support on
+// macOS and %AppData% on Windows.
+func defaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "streamline", "config.toml"), nil
+}
+
+// loadConfig reads the config file at path, or at the default location when
+// path is empty. Only an explicitly named file has to exist.
+func loadConfig(path string) (*config, error) {
+	explicit := path != ""
+	if !explicit {
+		var err error
+		if path, err = defaultConfigPath(); err != nil {
+			return nil, err
+		}
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		debugLog("No config file at %s", path)
+		return &config{path: path, profiles: map[string][]configEntry{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfig(string(data), path)
+	if err != nil {
+		return nil, err
+	}
+	debugLog("Config %s: %d setting(s), %d profile(s)", path, len(cfg.global), len(cfg.names))
+	return cfg, nil
+}
+
+// applyConfig fills in every flag not given on the command line: global
+// settings first, then the chosen profile on top of them. Settings for flags
+// another command has are left alone. It returns where each setting came
+// from, for `config show`.
+func applyConfig(fs *flag.FlagSet, cfg *config, profile string) (map[string]string, error) {
+	entries := map[string]configEntry{}
+	sources := map[string]string{}
+	for _, e := range cfg.global {
+		entries[e.key], sources[e.key] = e, "config"
+	}
+	if profile != "" {
+		list, ok := cfg.profiles[profile]
+		if !ok {
+			if len(cfg.names) == 0 {
+				return nil, fmt.Errorf("unknown profile %q: %s defines no profiles", profile, cfg.path)
+			}
+			return nil, fmt.Errorf("unknown profile %q (have %s)", profile, strings.Join(cfg.names, ", "))
+		}
+		for _, e := range list {
+			entries[e.key], sources[e.key] = e, "profile "+profile
+		}
+	}
+
+	onCommandLine := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { onCommandLine[configKey(f.Name)] = true })
+
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		e := entries[key]
+		errorf := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", cfg.path, e.line, fmt.Sprintf(format, args...))
+		}
+
+		if key == "mode" {
+			if len(e.values) != 1 {
+				return nil, errorf("mode takes a single value, not an array")
+			}
+			if onCommandLine[key] || fs.Lookup("m") == nil {
+				continue
+			}
+			switch e.values[0] {
+			case "audio":
+				fs.Set("m", "true")
+			case "video":
+				fs.Set("v", "true")
+			default:
+				return nil, errorf("mode must be \"audio\" or \"video\", not %q", e.values[0])
+			}
+			continue
+		}
+
+		f := fs.Lookup(key)
+		if notConfigurable[key] || f == nil && !isSetting(key) {
+			return nil, errorf("unknown setting %q", key)
+		}
+		if f == nil {
+			continue
+		}
+		if _, isList := f.Value.(*stringList); len(e.values) != 1 && !isList {
+			return nil, errorf("%s takes a single value, not an array", key)
+		}
+		if onCommandLine[key] {
+			continue
+		}
+		for _, v := range e.values {
+			if err := fs.Set(key, expandHome(v)); err != nil {
+				return nil, errorf("%s: %v", key, err)
+			}
+		}
+	}
+	for key := range onCommandLine {
+		sources[key] = "command line"
+	}
+	return sources, nil
+}
+
+// expandHome replaces a leading "~/" with the home directory, which the
+// shell would have done for the same value on the command line.
+func expandHome(s string) string {
+	if !strings.HasPrefix(s, "~/") && !strings.HasPrefix(s, `~\`) {
+		return s
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return s
+	}
+	return filepath.Join(home, s[2:])
+}
+
+// ─── config Subcommand ────────────────────────────────────────────────────────
+
+func configUsage() {
+	fmt.Printf(`%sUsage:%s
+  streamline config show [--profile NAME] [--config PATH] [flags]   Print the effective settings
+  streamline config path                                            Print the config file location
+  streamline config profiles                                        List the profile names
+
+`, colorYellow, colorReset)
+}
+
+// runConfigCommand implements `streamline config show|path|profiles`. show accepts
+// the download flags too, so the effect of a command line can be previewed.
+func runConfigCommand(args []string) int {
+	if len(args) == 0 {
+		configUsage()
+		return exitUsage
+	}
+	if isHelp(args[0]) {
+		configUsage()
+		return exitOK
+	}
+	fs, cli := newFlagSet("streamline config "+args[0], groupAll, &opts)
+	fs.Usage = configUsage
+	if _, err := parseArgs(fs, args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	enableDebug(cli)
+	cfg, err := loadConfig(*cli.configPath)
+	if err != nil {
+		printStatus("error", err.Error())
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "path":
+		fmt.Println(cfg.path)
+	case "profiles":
+		for _, name := range cfg.names {
+			fmt.Println(name)
+		}
+	case "show":
+		sources, err := applyConfig(fs, cfg, *cli.profile)
+		if err != nil {
+			printStatus("error", err.Error())
+			return exitUsage
+		}
+		showConfig(fs, cfg, *cli.profile, sources)
+	default:
+		configUsage()
+		return exitUsage
+	}
+	return exitOK
+}
+
+// showConfig prints the merged settings as config.toml lines, each with a
+// comment naming where its value came from.
+func showConfig(fs *flag.FlagSet, cfg *config, profile string, sources map[string]string) {
+	header := cfg.path
+	if _, err := os.Stat(cfg.path); err != nil {
+		header += " (not found)"
+	}
+	if profile != "" {
+		header += fmt.Sprintf(", profile %q", profile)
+	}
+	fmt.Printf("%s# %s%s\n", colorDim, header, colorReset)
+
+	mode := ""
+	if fs.Lookup("m").Value.String() == "true" {
+		mode = "audio"
+	} else if fs.Lookup("v").Value.String() == "true" {
+		mode = "video"
+	}
+	rows := [][2]string{{"mode", strconv.Quote(mode)}}
+	fs.VisitAll(func(f *flag.Flag) {
+		if !notConfigurable[f.Name] {
+			rows = append(rows, [2]string{f.Name, tomlValue(f.Value.(flag.Getter).Get())})
+		}
+	})
+
+	// Comments line up, except behind the odd very long value.
+	width := 0
+	for _, r := range rows {
+		if n := len(r[0]) + len(r[1]); n > width && n <= 40 {
+			width = n
+		}
+	}
+	for _, r := range rows {
+		source := sources[r[0]]
+		if source == "" {
+			source = "default"
+		}
+		pad := strings.Repeat(" ", max(0, width-len(r[0])-len(r[1])))
+		fmt.Printf("%s%s%s = %s%s  %s# %s%s\n", colorGreen, r[0], colorReset, r[1], pad, colorDim, source, colorReset)
+	}
+	if len(cfg.names) > 0 {
+		fmt.Printf("%s# profiles: %s%s\n", colorDim, strings.Join(cfg.names, ", "), colorReset)
+	}
+}
+
+// tomlValue renders a flag value as a config.toml value.
+func tomlValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = strconv.Quote(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+	return fmt.Sprint(v)
+}
+
+// ─── TOML Subset ──────────────────────────────────────────────────────────────
+
+// parseConfig reads the part of TOML a flat settings file needs: comments,
+// key = value pairs, [profile.NAME] tables, basic and literal strings,
+// integers, floats, booleans and (possibly multi-line) arrays of those.
+// Values are kept as the strings flag.Set parses.
+func parseConfig(src, path string) (*config, error) {
+	cfg := &config{path: path, profiles: map[string][]configEntry{}}
+	p := &configParser{src: src, path: path, line: 1}
+	profile := ""
+	seen := map[string]bool{}
+
+	for {
+		p.skip(true)
+		if p.pos >= len(p.src) {
+			return cfg, nil
+		}
+
+		if p.peek() == '[' {
+			p.pos++
+			name, err := p.tableName()
+			if err != nil {
+				return nil, err
+			}
+			if len(name) != 2 || (name[0] != "profile" && name[0] != "profiles") {
+				return nil, p.errorf("unknown table [%s]; profiles are written [profile.NAME]", strings.Join(name, "."))
+			}
+			profile = name[1]
+			if _, dup := cfg.profiles[profile]; dup {
+				return nil, p.errorf("profile %q is defined twice", profile)
+			}
+			cfg.profiles[profile] = nil
+			cfg.names = append(cfg.names, profile)
+			if err := p.endOfLine(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		line := p.line
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		key = strings.ReplaceAll(key, "_", "-")
+		p.skip(false)
+		if p.peek() != '=' {
+			return nil, p.errorf("expected \"=\" after %q", key)
+		}
+		p.pos++
+		p.skip(false)
+		values, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+
+		if seen[profile+"."+key] {
+			return nil, fmt.Errorf("%s:%d: %q is set twice", path, line, key)
+		}
+		seen[profile+"."+key] = true
+		e := configEntry{key: key, values: values, line: line}
+		if profile == "" {
+			cfg.global = append(cfg.global, e)
+		} else {
+			cfg.profiles[profile] = append(cfg.profiles[profile], e)
+		}
+	}
+}
+
+type configParser struct {
+	src  string
+	pos  int
+	path string
+	line int
+}
+
+func (p *configParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", p.path, p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *configParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+// rest is the remainder of the current line, for error messages.
+func (p *configParser) rest() string {
+	end := strings.IndexByte(p.src[p.pos:], '\n')
+	if end < 0 {
+		return p.src[p.pos:]
+	}
+	return strings.TrimSpace(p.src[p.pos : p.pos+end])
+}
+
+// skip passes over blanks and comments, and over line breaks if newlines is
+// set.
+func (p *configParser) skip(newlines bool) {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+			p.line++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine allows only a comment between a value and the next line.
+func (p *configParser) endOfLine() error {
+	p.skip(false)
+	if p.pos < len(p.src) && p.src[p.pos] != '\n' {
+		return p.errorf("unexpected %q", p.rest())
+	}
+	return nil
+}
+
+// tableName reads the dotted name of a [table] header after the "[".
+func (p *configParser) tableName() ([]string, error) {
+	var parts []string
+	for {
+		p.skip(false)
+		part, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+		p.skip(false)
+		switch p.peek() {
+		case '.':
+			p.pos++
+		case ']':
+			p.pos++
+			return parts, nil
+		default:
+			return nil, p.errorf("malformed table header")
+		}
+	}
+}
+
+// key reads a bare (A-Za-z0-9_-) or quoted key.
+func (p *configParser) key() (string, error) {
+	if c := p.peek(); c == '"' || c == '\'' {
+		return p.str()
+	}
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			break
+		}
+		p.pos++
+	}
+	if start == p.pos {
+		return "", p.errorf("expected a key, found %q", p.rest())
+	}
+	return p.src[start:p.pos], nil
+}
+
+// value reads a scalar or an array of scalars.
+func (p *configParser) value() ([]string, error) {
+	if p.peek() != '[' {
+		v, err := p.scalar()
+		return []string{v}, err
+	}
+	p.pos++
+	values := []string{}
+	for {
+		p.skip(true)
+		if p.peek() == ']' {
+			p.pos++
+			return values, nil
+		}
+		v, err := p.scalar()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		p.skip(true)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected \",\" or \"]\" in array")
+		}
+	}
+}
+
+// scalar reads a string, boolean or number.
+func (p *configParser) scalar() (string, error) {
+	switch p.peek() {
+	case '"', '\'':
+		return p.str()
+	case '[':
+		return "", p.errorf("nested arrays are not supported")
+	}
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(" \t\r\n,]#", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	word := p.src[start:p.pos]
+	if word == "true" || word == "false" {
+		return word, nil
+	}
+	number := strings.ReplaceAll(word, "_", "")
+	if _, err := strconv.ParseInt(number, 0, 64); err == nil {
+		return number, nil
+	}
+	if _, err := strconv.ParseFloat(number, 64); err == nil && word != "" {
+		return number, nil
+	}
+	return "", p.errorf("invalid value %q (strings need quotes)", word)
+}
+
+// str reads a "basic" string with escapes or a 'literal' one without.
+func (p *configParser) str() (string, error) {
+	quote := p.src[p.pos]
+	start := p.pos
+	for p.pos++; p.pos < len(p.src) && p.src[p.pos] != '\n'; p.pos++ {
+		switch c := p.src[p.pos]; {
+		case c == '\\' && quote == '"':
+			p.pos++
+		case c == quote:
+			p.pos++
+			raw := p.src[start:p.pos]
+			if quote == '\'' {
+				return raw[1 : len(raw)-1], nil
+			}
+			s, err := strconv.Unquote(raw)
+			if err != nil {
+				return "", p.errorf("invalid string %s", raw)
+			}
+			return s, nil
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	type entries = map[string][]string
+	tests := []struct {
+		name     string
+		src      string
+		global   entries
+		profiles map[string]entries
+	}{
+		{
+			name:   "scalars",
+			src:    "jobs = 2\ndir = \"~/Downloads\"\ndry_run = true\nmatch-threshold = 0.9\nbig = 1_000\n",
+			global: entries{"jobs": {"2"}, "dir": {"~/Downloads"}, "dry-run": {"true"}, "match-threshold": {"0.9"}, "big": {"1000"}},
+		},
+		{
+			name:   "comments and blank lines",
+			src:    "# settings\n\n  jobs = 3   # parallel\r\n\n",
+			global: entries{"jobs": {"3"}},
+		},
+		{
+			name:   "basic and literal strings",
+			src:    `a = "tab\there \"quoted\" \u00e9"` + "\n" + `b = 'C:\music\{title}'` + "\n" + `"quoted-key" = "x # not a comment"`,
+			global: entries{"a": {"tab\there \"quoted\" é"}, "b": {`C:\music\{title}`}, "quoted-key": {"x # not a comment"}},
+		},
+		{
+			name:   "arrays",
+			src:    "exec = [\"notify-send 'Downloaded' \\\"$STREAMLINE_TITLE\\\"\", 'echo done']\nempty = []\n",
+			global: entries{"exec": {`notify-send 'Downloaded' "$STREAMLINE_TITLE"`, "echo done"}, "empty": {}},
+		},
+		{
+			name: "README title-rule example",
+			src: "title-rule = [\n" +
+				"  '\\s*\\(Live\\)$',                              # delete\n" +
+				"  '^(?P<title>.+?) by (?P<artist>.+)$',         # \"Song by Artist\"\n" +
+				"]\n",
+			global: entries{"title-rule": {`\s*\(Live\)$`, `^(?P<title>.+?) by (?P<artist>.+)$`}},
+		},
+		{
+			name: "profiles",
+			src: "jobs = 2\n\n[profile.podcast]\nmode = \"audio\"\ncover-size = 300\n\n" +
+				"[ profiles . \"hd video\" ]  # quoted name\njobs = 4\n",
+			global: entries{"jobs": {"2"}},
+			profiles: map[string]entries{
+				"podcast":  {"mode": {"audio"}, "cover-size": {"300"}},
+				"hd video": {"jobs": {"4"}},
+			},
+		},
+		{
+			name:     "empty profile",
+			src:      "[profile.empty]\n",
+			profiles: map[string]entries{"empty": {}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfig(tt.src, "test.toml")
+			if err != nil {
+				t.Fatalf("parseConfig: %v", err)
+			}
+			collect := func(list []configEntry) entries {
+				m := entries{}
+				for _, e := range list {
+					m[e.key] = e.values
+				}
+				return m
+			}
+			want := tt.global
+			if want == nil {
+				want = entries{}
+			}
+			if got := collect(cfg.global); !reflect.DeepEqual(got, want) {
+				t.Errorf("global = %q, want %q", got, want)
+			}
+			if len(cfg.profiles) != len(tt.profiles) {
+				t.Errorf("profiles = %v, want %v", cfg.names, tt.profiles)
+			}
+			for name, want := range tt.profiles {
+				if got := collect(cfg.profiles[name]); !reflect.DeepEqual(got, want) {
+					t.Errorf("profile %q = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseConfigOrderAndLines(t *testing.T) {
+	cfg, err := parseConfig("[profile.b]\nx = 1\n\n[profile.a]\ny = [\n 1,\n 2,\n]\nz = 3\n", "test.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.names, []string{"b", "a"}) {
+		t.Errorf("names = %v, want file order [b a]", cfg.names)
+	}
+	if got := cfg.profiles["a"]; len(got) != 2 || got[0].line != 5 || got[1].line != 9 {
+		t.Errorf("entries of a = %+v, want y on line 5 and z on line 9", got)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"jobs 2", `test.toml:1: expected "=" after "jobs"`},
+		{"= 2", `test.toml:1: expected a key, found "= 2"`},
+		{"dir = ~/Downloads", `test.toml:1: invalid value "~/Downloads" (strings need quotes)`},
+		{"dir = ", `test.toml:1: invalid value "" (strings need quotes)`},
+		{"a = \"open", `test.toml:1: unterminated string`},
+		{"a = 'open\n'", `test.toml:1: unterminated string`},
+		{`a = "bad \q"`, `test.toml:1: invalid string "bad \q"`},
+		{"a = 1 2", `test.toml:1: unexpected "2"`},
+		{"a = [1 2]", `test.toml:1: expected "," or "]" in array`},
+		{"a = [[1]]", `test.toml:1: nested arrays are not supported`},
+		{"title-rule = [\n  'a',\n  'b'\n", `test.toml:4: expected "," or "]" in array`},
+		{"\n\n[settings]", `test.toml:3: unknown table [settings]; profiles are written [profile.NAME]`},
+		{"[profile.a.b]", `test.toml:1: unknown table [profile.a.b]; profiles are written [profile.NAME]`},
+		{"[profile.a", `test.toml:1: malformed table header`},
+		{"[profile.a] jobs = 1", `test.toml:1: unexpected "jobs = 1"`},
+		{"[profile.a]\n[profile.a]", `test.toml:2: profile "a" is defined twice`},
+		{"jobs = 1\njobs = 2", `test.toml:2: "jobs" is set twice`},
+		{"dry_run = true\ndry-run = false", `test.toml:2: "dry-run" is set twice`},
+	}
+	for _, tt := range tests {
+		_, err := parseConfig(tt.src, "test.toml")
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("parseConfig(%q) error = %v, want %s", tt.src, err, tt.want)
+		}
+	}
+
+	// The same key in the global section and a profile is an override, not
+	// a duplicate.
+	if _, err := parseConfig("jobs = 1\n[profile.p]\njobs = 2\n", "test.toml"); err != nil {
+		t.Errorf("override in profile: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ─── Output Conflicts ─────────────────────────────────────────────────────────
+
+// --on-conflict policies for an output path that already exists.
+const (
+	conflictRename    = "rename"    // add " (2)", " (3)", ... before the extension
+	conflictSkip      = "skip"      // leave the existing file, do not download
+	conflictOverwrite = "overwrite" // replace the existing file
+	conflictAsk       = "ask"       // prompt for one of the above
+)
+
+var conflictPolicies = []string{conflictRename, conflictSkip, conflictOverwrite, conflictAsk}
+
+func validateConflictPolicy() error {
+	for _, p := range conflictPolicies {
+		if opts.onConflict == p {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown --on-conflict policy %q (want %s)", opts.onConflict, strings.Join(conflictPolicies, ", "))
+}
+
+// claims holds output paths already promised to a job in this run, so
+// parallel jobs with the same title cannot pick the same free name.
+var claims = struct {
+	mu    sync.Mutex
+	paths map[string]bool
+}{paths: map[string]bool{}}
+
+// resolveConflict applies the --on-conflict policy to path and returns where
+// the file should go. A skip is returned as an errSkipped-wrapped error.
+func resolveConflict(j *job, path string) (string, error) {
+	claims.mu.Lock()
+	defer claims.mu.Unlock()
+
+	taken := func(p string) bool {
+		if claims.paths[p] {
+			return true
+		}
+		_, err := os.Lstat(p)
+		return err == nil
+	}
+	if !taken(path) {
+		claims.paths[path] = true
+		return path, nil
+	}
+
+	policy := opts.onConflict
+	if policy == conflictAsk {
+		policy = askConflict(j, path)
+	}
+	debugLog("Output %s exists; policy %s", path, policy)
+
+	switch policy {
+	case conflictSkip:
+		j.status("info", fmt.Sprintf("Output already exists: %s%s%s", colorDim, path, colorReset))
+		return "", fmt.Errorf("%w: output already exists (%s)", errSkipped, path)
+	case conflictOverwrite:
+		j.status("warning", fmt.Sprintf("Overwriting existing file: %s", path))
+		claims.paths[path] = true
+		return path, nil
+	}
+
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", stem, n, ext)
+		if !taken(candidate) {
+			j.status("info", fmt.Sprintf("Output exists; saving as %s", filepath.Base(candidate)))
+			claims.paths[candidate] = true
+			return candidate, nil
+		}
+	}
+}
+
+// askConflict prompts for a policy. Without a terminal to answer, the file
+// is skipped: that neither loses data nor wastes bandwidth.
+func askConflict(j *job, path string) string {
+	if !stdinIsTerminal() {
+		j.status("warning", "Output exists and stdin is not a terminal; skipping")
+		return conflictSkip
+	}
+	policy := conflictSkip
+	term.hold(func() {
+		w := promptWriter()
+		fmt.Fprintf(w, "%s%s%s already exists.\n", colorYellow, path, colorReset)
+		for {
+			fmt.Fprintf(w, "%s%s[s]kip, [o]verwrite or [r]ename?%s ", j.prefix(), colorCyan, colorReset)
+			answer, err := readLine()
+			if err != nil {
+				break
+			}
+			switch strings.ToLower(answer) {
+			case "s", "skip":
+				policy = conflictSkip
+			case "o", "overwrite":
+				policy = conflictOverwrite
+			case "r", "rename":
+				policy = conflictRename
+			default:
+				continue
+			}
+			break
+		}
+		fmt.Fprintln(w)
+	})
+	return policy
+}
+
+// checkConflict resolves the output path before downloading, so a file that
+// will be skipped costs no bandwidth. It is only needed for skip and ask:
+// rename and overwrite never stop a download and are applied in
+// placeOutput, once the real file name is known. ext is the extension the
+// file is expected to get.
+func checkConflict(j *job, ext string) error {
+	if opts.onConflict != conflictSkip && opts.onConflict != conflictAsk {
+		return nil
+	}
+	j.planned = renderOutputPath(opts.output, opts.dir, outputFields(j, j.title+"."+ext))
+	debugLog("checkConflict: predicted output %s", j.planned)
+	var err error
+	j.dest, err = resolveConflict(j, j.planned)
+	return err
+}
+
+// predictAudioExt guesses the extension of the extracted audio. With
+// --audio-format best yt-dlp names the file after the codec of the best
+// audio stream, not after its container.
+func predictAudioExt(j *job) string {
+	if f, ok := findAudioFormat(opts.encoding.format); ok {
+		return f.ext
+	}
+	best := bestAudioFormat(j.formats)
+	if best == nil {
+		return infoString(j.info, "ext")
+	}
+	for prefix, ext := range map[string]string{"opus": "opus", "mp4a": "m4a", "vorbis": "ogg", "mp3": "mp3", "flac": "flac"} {
+		if strings.HasPrefix(best.ACodec, prefix) {
+			return ext
+		}
+	}
+	return best.Ext
+}
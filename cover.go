@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ─── Cover Art ────────────────────────────────────────────────────────────────
+
+// --cover-crop modes: how a thumbnail that is not square becomes one.
+const (
+	coverCropCenter = "center" // keep the centred square
+	coverCropSmart  = "smart"  // find the artwork inside any bars, then as center
+	coverCropPad    = "pad"    // fit the whole image, padding with black
+	coverCropNone   = "none"   // keep the aspect ratio, fitting the square
+)
+
+var coverCropModes = []string{coverCropCenter, coverCropSmart, coverCropPad, coverCropNone}
+
+// coverFormats are the --cover-format choices; every tag format can carry
+// either.
+var coverFormats = []string{"jpeg", "png"}
+
+// --cover-quality is ffmpeg's JPEG scale, lower being better. To meet
+// --cover-max-size, quality is given up down to coverFloorQuality before
+// the image is made smaller.
+const (
+	coverBestQuality  = 2
+	coverWorstQuality = 31
+	coverFloorQuality = 15
+)
+
+// coverSteps describe each crop mode in the embedding status line.
+var coverSteps = map[string]string{
+	coverCropCenter: "Cropping cover to square",
+	coverCropSmart:  "Cropping cover to its artwork",
+	coverCropPad:    "Padding cover to square",
+	coverCropNone:   "Scaling cover",
+}
+
+// validateCoverOptions checks the --cover-* flags, resolving
+// --cover-max-size into opts.coverMaxBytes and --cover-file to an absolute
+// path.
+func validateCoverOptions() error {
+	if opts.coverSize < 16 || opts.coverSize > 4096 {
+		return errors.New("--cover-size must be between 16 and 4096")
+	}
+	if !containsString(coverCropModes, opts.coverCrop) {
+		return fmt.Errorf("unknown --cover-crop mode %q (want %s)", opts.coverCrop, strings.Join(coverCropModes, ", "))
+	}
+	if !containsString(coverFormats, opts.coverFormat) {
+		return fmt.Errorf("unknown --cover-format %q (want %s)", opts.coverFormat, strings.Join(coverFormats, ", "))
+	}
+	if opts.coverQuality < coverBestQuality || opts.coverQuality > coverWorstQuality {
+		return fmt.Errorf("--cover-quality must be between %d (best) and %d", coverBestQuality, coverWorstQuality)
+	}
+	opts.coverMaxBytes = 0
+	if opts.coverMaxSize != "" {
+		if opts.coverMaxBytes = int64(parseSize(strings.ToUpper(opts.coverMaxSize))); opts.coverMaxBytes <= 0 {
+			return fmt.Errorf("bad --cover-max-size %q (want a size such as 200K or 1M)", opts.coverMaxSize)
+		}
+	}
+	if opts.coverFile != "" {
+		if _, err := os.Stat(opts.coverFile); err != nil {
+			return fmt.Errorf("--cover-file: %w", err)
+		}
+		abs, err := filepath.Abs(opts.coverFile)
+		if err != nil {
+			return fmt.Errorf("--cover-file: %w", err)
+		}
+		opts.coverFile = abs
+	}
+	return nil
+}
+
+// prepareCover turns src into the cover image every container then embeds
+// as-is: squared as --cover-crop says, scaled to --cover-size and encoded
+// as --cover-format. Over --cover-max-size, it is re-encoded at a lower
+// JPEG quality and then at three quarters of the size until it fits.
+func prepareCover(j *job, ffmpegPath, src string) ([]byte, error) {
+	codec, ext := []string{"-c:v", "mjpeg"}, ".jpg"
+	if opts.coverFormat == "png" {
+		codec, ext = []string{"-c:v", "png"}, ".png"
+	}
+	cover := filepath.Join(j.workDir, "streamline-cover"+ext)
+	defer os.Remove(cover)
+
+	trim := ""
+	if opts.coverCrop == coverCropSmart {
+		trim = artworkCrop(src)
+	}
+	side, quality := opts.coverSize, opts.coverQuality
+	for {
+		debugLog("prepareCover: %s → %s (%d px, crop %s, q:v %d)", src, cover, side, opts.coverCrop, quality)
+		args := append([]string{"-i", src, "-vf", trim + coverScale(side)}, codec...)
+		if opts.coverFormat == "jpeg" {
+			args = append(args, "-q:v", strconv.Itoa(quality))
+		}
+		args = append(args, "-frames:v", "1", "-y", "-loglevel", "error", cover)
+		if err := runCommand(newCommand(ffmpegPath, args...)); err != nil {
+			return nil, classify(classPostprocess, fmt.Errorf("preparing album art: %w", err))
+		}
+		data, err := os.ReadFile(cover)
+		if err != nil {
+			return nil, classify(classFilesystem, err)
+		}
+		if opts.coverMaxBytes == 0 || int64(len(data)) <= opts.coverMaxBytes {
+			if side != opts.coverSize || quality != opts.coverQuality {
+				j.status("info", fmt.Sprintf("Album art reduced to %d×%d, %d KB to fit --cover-max-size", side, side, (len(data)+1023)/1024))
+			}
+			return data, nil
+		}
+		switch {
+		case opts.coverFormat == "jpeg" && quality < coverFloorQuality:
+			quality = min(quality+3, coverFloorQuality)
+		case side*3/4 >= 16:
+			side = side * 3 / 4
+		default:
+			return nil, classify(classPostprocess, fmt.Errorf("album art does not fit in --cover-max-size %s", opts.coverMaxSize))
+		}
+	}
+}
+
+// coverScale is the filter chain that squares the image as --cover-crop
+// says and scales it to side pixels; with none, the image only fits inside
+// the square.
+func coverScale(side int) string {
+	box := fmt.Sprintf("scale=%d:%d", side, side)
+	switch opts.coverCrop {
+	case coverCropPad:
+		return fmt.Sprintf("%s:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2", box, side, side)
+	case coverCropNone:
+		return box + ":force_original_aspect_ratio=decrease"
+	}
+	return "crop=min(iw\\,ih):min(iw\\,ih)," + box
+}
+
+// artworkCrop returns a crop filter, comma included, that cuts the bars
+// around the artwork in src, or "" when there are none or src cannot be
+// decoded here.
+func artworkCrop(src string) string {
+	f, err := os.Open(src)
+	if err != nil {
+		debugLog("artworkCrop: %v", err)
+		return ""
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		debugLog("artworkCrop: %s: %v", src, err)
+		return ""
+	}
+	b := img.Bounds()
+	r, found := findArtwork(img)
+	debugLog("artworkCrop: artwork %v in %v (%s)", r, b, found)
+	if r == b {
+		return ""
+	}
+	return fmt.Sprintf("crop=%d:%d:%d:%d,", r.Dx(), r.Dy(), r.Min.X-b.Min.X, r.Min.Y-b.Min.Y)
+}
+
+// coverMIME tells a PNG cover from a JPEG one by its signature.
+func coverMIME(img []byte) string {
+	if bytes.HasPrefix(img, []byte("\x89PNG\r\n\x1a\n")) {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// embedCover adds the cover made from src, the thumbnail or --cover-file,
+// to tags as the front cover and writes them into audioFile, in the way
+// format's container expects.
+func embedCover(j *job, ffmpegPath, audioFile string, format audioFormat, src string, tags *audioTags) error {
+	if format.cover == coverNone {
+		j.status("warning", fmt.Sprintf("%s files cannot carry cover art; skipping", strings.ToUpper(format.ext)))
+		return writeTags(j, ffmpegPath, audioFile, format, tags)
+	}
+
+	j.status("info", coverSteps[opts.coverCrop]+" and embedding...")
+	emit(j, evPostprocess, map[string]any{"step": "embed_cover"})
+	debugLog("embedCover: audio=%s cover=%s style=%d", audioFile, src, format.cover)
+
+	spinner := NewSpinner(j.prefix() + fmt.Sprintf("Embedding album art (%d×%d %s)...", opts.coverSize, opts.coverSize, strings.ToUpper(opts.coverFormat)))
+	spinner.Start()
+	err := embedCoverFile(j, ffmpegPath, audioFile, format, src, tags)
+	spinner.Stop(err == nil)
+	if err != nil {
+		debugLog("embedCover error: %v", err)
+		return err
+	}
+	j.status("success", "Album art embedded successfully")
+	return nil
+}
+
+func embedCoverFile(j *job, ffmpegPath, audioFile string, format audioFormat, src string, tags *audioTags) error {
+	data, err := prepareCover(j, ffmpegPath, src)
+	if err != nil {
+		return err
+	}
+	withCover := *tags
+	withCover.cover = data
+	return writeTags(j, ffmpegPath, audioFile, format, &withCover)
+}
+
+// flacPictureBlock builds the body of a FLAC PICTURE metadata block, the
+// format Vorbis comments also use for cover art. Picture type 3 is the
+// front cover; all integers are big-endian.
+func flacPictureBlock(img []byte, mime string) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(img))
+	if err != nil {
+		return nil, fmt.Errorf("reading cover image: %w", err)
+	}
+	const description = "Cover (front)"
+	var b bytes.Buffer
+	for _, v := range []any{
+		uint32(3),
+		uint32(len(mime)), []byte(mime),
+		uint32(len(description)), []byte(description),
+		uint32(cfg.Width), uint32(cfg.Height),
+		uint32(24), // colour depth
+		uint32(0),  // palette size, 0 for non-indexed images
+		uint32(len(img)), img,
+	} {
+		binary.Write(&b, binary.BigEndian, v)
+	}
+	return b.Bytes(), nil
+}
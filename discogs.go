@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ─── Discogs ──────────────────────────────────────────────────────────────────
+
+// discogsRelease is a <release> of the Discogs XML data dump
+// (discogs_YYYYMMDD_releases.xml.gz).
+type discogsRelease struct {
+	ID       string          `xml:"id,attr"`
+	Artists  []discogsArtist `xml:"artists>artist"`
+	Title    string          `xml:"title"`
+	Released string          `xml:"released"` // "1999-03-00" or "1999"
+	Tracks   []struct {
+		Position string          `xml:"position"` // "3", "A1", "2-5"
+		Title    string          `xml:"title"`
+		Duration string          `xml:"duration"` // "4:45"
+		Artists  []discogsArtist `xml:"artists>artist"`
+	} `xml:"tracklist>track"`
+}
+
+type discogsArtist struct {
+	Name string `xml:"name"`
+	ANV  string `xml:"anv"`  // name variation as credited on the release
+	Join string `xml:"join"` // joining word before the next artist
+}
+
+var (
+	// reDiscogsSuffix is the number Discogs adds to tell apart artists of
+	// the same name: "Nirvana (2)".
+	reDiscogsSuffix = regexp.MustCompile(`\s+\(\d+\)$`)
+	// reDiscogsPosition is a disc-track position: "2-5", "CD2.5".
+	reDiscogsPosition = regexp.MustCompile(`^(?:CD)?(\d+)[-.](\d+)$`)
+)
+
+// discogsName joins artists as the release credits them.
+func discogsName(artists []discogsArtist) string {
+	var b strings.Builder
+	for i, a := range artists {
+		name := a.ANV
+		if name == "" {
+			name = reDiscogsSuffix.ReplaceAllString(a.Name, "")
+		}
+		b.WriteString(name)
+		if i < len(artists)-1 {
+			switch join := strings.TrimSpace(a.Join); join {
+			case "", ",":
+				b.WriteString(", ")
+			default:
+				b.WriteString(" " + join + " ")
+			}
+		}
+	}
+	return b.String()
+}
+
+// discogsDate turns Discogs' zero-padded dates into "1999-03" or "1999".
+func discogsDate(s string) string {
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "-00"), "-00")
+	if len(s) < 4 || s[:4] == "0000" {
+		return ""
+	}
+	return s
+}
+
+// discogsDuration parses "4:45" or "1:02:03" into seconds.
+func discogsDuration(s string) float64 {
+	var secs float64
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		secs = secs*60 + float64(n)
+	}
+	return secs
+}
+
+// matches lists the tracks of the release. Tracks are numbered in
+// tracklist order unless the position names a disc; headings and index
+// tracks have no position and are skipped.
+func (r discogsRelease) matches() []trackMatch {
+	var list []trackMatch
+	albumArtist := discogsName(r.Artists)
+	number, total := 0, 0
+	for _, t := range r.Tracks {
+		if t.Position != "" {
+			total++
+		}
+	}
+	for _, t := range r.Tracks {
+		if t.Position == "" {
+			continue
+		}
+		number++
+		m := trackMatch{
+			id: r.ID, title: t.Title, artist: albumArtist, albumArtist: albumArtist, album: r.Title,
+			date: discogsDate(r.Released), duration: discogsDuration(t.Duration),
+			track: number, trackTotal: total,
+		}
+		if len(t.Artists) > 0 {
+			m.artist = discogsName(t.Artists)
+		}
+		if p := reDiscogsPosition.FindStringSubmatch(t.Position); p != nil {
+			// The total is per release; Discogs does not give one per disc.
+			m.disc, _ = strconv.Atoi(p[1])
+			m.track, _ = strconv.Atoi(p[2])
+			m.trackTotal = 0
+		}
+		list = append(list, m)
+	}
+	return list
+}
+
+// discogsDump searches a Discogs XML releases dump, indexed on the first
+// search.
+type discogsDump struct {
+	path  string
+	index dumpIndex
+}
+
+func (d *discogsDump) name() string { return "Discogs dump" }
+
+func (d *discogsDump) search(q trackQuery) ([]trackMatch, error) {
+	if err := d.index.load(d.name(), d.path, d.read); err != nil {
+		return nil, err
+	}
+	return d.index.lookup(q), nil
+}
+
+// read decodes the dump release by release, passing every track to add.
+func (d *discogsDump) read(add func(trackMatch)) error {
+	r, err := openDump(d.path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", d.path, err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "release" {
+			continue
+		}
+		var rel discogsRelease
+		if err := dec.DecodeElement(&rel, &start); err != nil {
+			return fmt.Errorf("%s: %w", d.path, err)
+		}
+		for _, m := range rel.matches() {
+			add(m)
+		}
+	}
+}
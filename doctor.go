@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ─── doctor ───────────────────────────────────────────────────────────────────
+
+// Oldest versions the doctor accepts. yt-dlp has to follow site changes, so
+// an old release (typically a stale distro package) fails part way through
+// a download with an extractor error. ffmpeg before 4.0 is long out of
+// upstream support.
+const (
+	minYtdlpVersion  = "2023.11.16"
+	minFFmpegVersion = "4.0"
+)
+
+// doctorEncoders are the ffmpeg encoders streamline relies on. A missing
+// required one breaks the default audio download.
+var doctorEncoders = []struct {
+	name, purpose string
+	required      bool
+}{
+	{"libmp3lame", "MP3 audio (the default --audio-format)", true},
+	{"libopus", "--audio-format opus", false},
+	{"mjpeg", "cover art", true},
+	{"png", "--cover-format png", false},
+}
+
+// doctorCheck is one line of the report. Status is ok, warning or error.
+type doctorCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Version string `json:"version,omitempty"`
+	Build   string `json:"build,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+var reToolVersion = regexp.MustCompile(`^n?([0-9]+(?:\.[0-9]+)+)`)
+
+// runDoctor reports where yt-dlp, ffmpeg and ffprobe come from, whether
+// they are recent enough, which encoders ffmpeg has and whether the temp
+// dir is writable. It exits with exitDependency if any check fails.
+func runDoctor(cmd *command, args []string) int {
+	if _, _, code, ok := parseCommandFlags(cmd, args); !ok {
+		return code
+	}
+
+	build := doctorCheck{Name: "build", Status: "ok", Version: "system", Detail: "yt-dlp and ffmpeg from PATH"}
+	if bundledBuild {
+		build.Version, build.Detail = "bundled", "embedded yt-dlp and ffmpeg"
+	}
+	checks := []doctorCheck{build}
+
+	ytdlpPath, ffmpegPath, err := doctorPaths()
+	if err != nil {
+		checks = append(checks, doctorCheck{Name: "binaries", Status: "error", Detail: err.Error()})
+	} else {
+		checks = append(checks,
+			checkYtdlp(ytdlpPath),
+			checkFFmpeg("ffmpeg", ffmpegPath, "https://ffmpeg.org/download.html"),
+			checkFFmpeg("ffprobe", findFFprobe(ffmpegPath), ""))
+		checks = append(checks, checkEncoders(ffmpegPath)...)
+	}
+	checks = append(checks, checkTempDir())
+
+	failed, warned := 0, 0
+	for _, c := range checks {
+		switch c.Status {
+		case "error":
+			failed++
+		case "warning":
+			warned++
+		}
+	}
+	emit(nil, evDoctor, map[string]any{"build": build.Version, "checks": checks, "ok": failed == 0})
+	if !jsonOutput {
+		printDoctorReport(checks)
+		switch {
+		case failed > 0:
+			printStatus("error", fmt.Sprintf("%d check(s) failed", failed))
+		case warned > 0:
+			printStatus("warning", fmt.Sprintf("All required checks passed, %d warning(s)", warned))
+		default:
+			printStatus("success", "All checks passed")
+		}
+	}
+	if failed > 0 {
+		return exitDependency
+	}
+	return exitOK
+}
+
+// doctorPaths finds yt-dlp and ffmpeg as a download would, except that a
+// missing one leaves its path empty so the report still covers the other.
+func doctorPaths() (ytdlpPath, ffmpegPath string, err error) {
+	if bundledBuild {
+		ytdlpPath, ffmpegPath, cleanup, err := resolveBinaries()
+		atCleanup(cleanup)
+		return ytdlpPath, ffmpegPath, err
+	}
+	ytdlpPath, _ = exec.LookPath(exeName("yt-dlp"))
+	ffmpegPath, _ = exec.LookPath(exeName("ffmpeg"))
+	return ytdlpPath, ffmpegPath, nil
+}
+
+// findFFprobe looks next to ffmpeg first: downloads put ffmpeg's directory
+// at the front of yt-dlp's PATH, so that is the ffprobe yt-dlp runs.
+func findFFprobe(ffmpegPath string) string {
+	if ffmpegPath != "" {
+		path := filepath.Join(filepath.Dir(ffmpegPath), exeName("ffprobe"))
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	path, _ := exec.LookPath(exeName("ffprobe"))
+	return path
+}
+
+func checkYtdlp(path string) doctorCheck {
+	c := doctorCheck{Name: "yt-dlp", Path: path}
+	if path == "" {
+		c.Status, c.Detail = "error", "not found on PATH; see https://github.com/yt-dlp/yt-dlp"
+		return c
+	}
+	out, err := outputCommand(newCommand(path, "--version"))
+	if err != nil {
+		c.Status, c.Detail = "error", "does not run: "+err.Error()
+		return c
+	}
+	c.Version = firstLine(out)
+	// Without a URL, --verbose prints the build details and then fails.
+	out, _ = combinedOutputCommand(newCommand(path, "--verbose", "--ignore-config"))
+	for _, line := range strings.Split(string(out), "\n") {
+		if build, ok := strings.CutPrefix(strings.TrimSpace(line), "[debug] yt-dlp version "); ok {
+			c.Build = build
+		}
+	}
+	c.Status, c.Detail = versionStatus(c.Version, minYtdlpVersion)
+	return c
+}
+
+// checkFFmpeg checks ffmpeg or ffprobe, which share a version banner:
+// "ffmpeg version 6.1.1-3ubuntu5 Copyright ...", then "built with ...".
+// Without an install URL a missing tool is only a warning.
+func checkFFmpeg(name, path, installURL string) doctorCheck {
+	c := doctorCheck{Name: name, Path: path}
+	if path == "" {
+		if installURL == "" {
+			c.Status, c.Detail = "warning", "not found; yt-dlp falls back to ffmpeg to inspect downloads"
+		} else {
+			c.Status, c.Detail = "error", "not found on PATH; see "+installURL
+		}
+		return c
+	}
+	out, err := outputCommand(newCommand(path, "-version"))
+	if err != nil {
+		c.Status, c.Detail = "error", "does not run: "+err.Error()
+		return c
+	}
+	if f := strings.Fields(firstLine(out)); len(f) >= 3 && f[1] == "version" {
+		c.Version = f[2]
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if build, ok := strings.CutPrefix(strings.TrimSpace(line), "built with "); ok {
+			c.Build = build
+		}
+	}
+	c.Status, c.Detail = versionStatus(c.Version, minFFmpegVersion)
+	return c
+}
+
+// checkEncoders parses `ffmpeg -encoders`, whose list follows a "------"
+// line: " A....D libmp3lame   libmp3lame MP3 (MPEG audio layer 3)".
+func checkEncoders(ffmpegPath string) []doctorCheck {
+	if ffmpegPath == "" {
+		return nil
+	}
+	out, err := outputCommand(newCommand(ffmpegPath, "-hide_banner", "-encoders"))
+	if err != nil {
+		return []doctorCheck{{Name: "encoders", Status: "error", Detail: "ffmpeg -encoders failed: " + err.Error()}}
+	}
+	have := map[string]bool{}
+	listed := false
+	for _, line := range strings.Split(string(out), "\n") {
+		if f := strings.Fields(line); listed && len(f) >= 2 {
+			have[f[1]] = true
+		} else if strings.HasPrefix(strings.TrimSpace(line), "---") {
+			listed = true
+		}
+	}
+
+	var checks []doctorCheck
+	for _, e := range doctorEncoders {
+		c := doctorCheck{Name: e.name, Status: "ok", Detail: e.purpose}
+		if !have[e.name] {
+			c.Status, c.Detail = "warning", "missing: "+e.purpose+" will fail"
+			if e.required {
+				c.Status = "error"
+			}
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+// checkTempDir writes a file where work directories are created.
+func checkTempDir() doctorCheck {
+	c := doctorCheck{Name: "temp dir", Status: "ok", Path: os.TempDir(), Detail: "writable"}
+	dir, err := os.MkdirTemp("", "streamline-doctor")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "probe"), []byte("ok"), 0o644)
+		os.RemoveAll(dir)
+	}
+	if err != nil {
+		c.Status, c.Detail = "error", err.Error()
+	}
+	return c
+}
+
+// versionStatus compares a tool's version with the minimum. Development
+// builds ("N-112233-gabc" from ffmpeg git) carry no comparable number.
+func versionStatus(version, min string) (status, detail string) {
+	m := reToolVersion.FindStringSubmatch(version)
+	if m == nil {
+		return "warning", "version not recognised; need " + min + " or newer"
+	}
+	if compareVersions(m[1], min) < 0 {
+		return "error", "older than " + min + "; please update"
+	}
+	return "ok", ""
+}
+
+// compareVersions compares dotted numeric versions ("2024.08.06", "6.1.1").
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func firstLine(out []byte) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(line)
+}
+
+func printDoctorReport(checks []doctorCheck) {
+	icons := map[string]string{
+		"ok":      colorGreen + "✓" + colorReset,
+		"warning": colorYellow + "⚠" + colorReset,
+		"error":   colorRed + "✗" + colorReset,
+	}
+	fmt.Printf("%s  %-10s %-16s %s%s\n", colorBold, "CHECK", "VERSION", "DETAILS", colorReset)
+	for _, c := range checks {
+		var details []string
+		if c.Path != "" {
+			details = append(details, c.Path)
+		}
+		if c.Detail != "" {
+			details = append(details, c.Detail)
+		}
+		if c.Build != "" {
+			details = append(details, colorDim+"("+c.Build+")"+colorReset)
+		}
+		fmt.Printf("%s %-10s %-16s %s\n", icons[c.Status], c.Name, shorten(orDash(c.Version), 16), strings.Join(details, "  "))
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// ─── Dry Run ──────────────────────────────────────────────────────────────────
+
+// dryRunPlan is what a download would do under --dry-run.
+type dryRunPlan struct {
+	mode   string
+	format string // yt-dlp format spec
+	label  string // human description of format / encoding
+	path   string
+	tags   map[string]string
+}
+
+// planOutput computes where a download would be saved without touching the
+// filesystem. rename, overwrite and skip are applied as in a real run (skip
+// returns errSkipped); ask only warns, since there is nothing to decide yet.
+func planOutput(j *job, ext string) (string, error) {
+	path := renderOutputPath(opts.output, opts.dir, outputFields(j, j.title+"."+ext))
+	if opts.onConflict != conflictAsk {
+		return resolveConflict(j, path)
+	}
+	if _, err := os.Lstat(path); err == nil {
+		j.status("warning", fmt.Sprintf("Output exists; a real run would ask what to do: %s", path))
+	}
+	return path, nil
+}
+
+// plannedTags lists the tags an audio file would be written with, under
+// ffmpeg's generic names; the cover is not known until the download. An
+// ambiguous --metadata-source match is listed rather than asked about.
+func plannedTags(j *job) map[string]string {
+	t := buildTags(j)
+	matchTags(j, t, false)
+	tags := map[string]string{}
+	for _, f := range t.fields() {
+		tags[f.name] = f.value
+	}
+	return tags
+}
+
+// reportPlan prints a dry-run plan, or emits it as a "plan" event. The
+// format itself was already shown by the download function.
+func reportPlan(j *job, p dryRunPlan) {
+	debugLog("dry run: %+v", p)
+	fields := map[string]any{
+		"mode":   p.mode,
+		"format": p.format,
+		"label":  p.label,
+		"path":   p.path,
+	}
+	if len(p.tags) > 0 {
+		fields["tags"] = p.tags
+	}
+	if size := estimateSize(j, p.mode == "audio"); size > 0 {
+		fields["size_estimate"] = int64(size)
+	}
+	emit(j, evPlan, fields)
+
+	keys := make([]string, 0, len(p.tags))
+	for k := range p.tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		j.status("info", fmt.Sprintf("Tag: %s=%s", k, p.tags[k]))
+	}
+	j.status("success", fmt.Sprintf("Would save to: %s%s%s", colorBold, p.path, colorReset))
+}
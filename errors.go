@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// ─── Error Classes & Exit Codes ───────────────────────────────────────────────
+
+// errorClass groups failures by what a caller (a cron job, a wrapper script)
+// would do about them. Each class maps to a documented exit code.
+type errorClass int
+
+const (
+	classGeneric     errorClass = iota // anything not classified below
+	classUsage                         // bad flags or arguments
+	classDependency                    // yt-dlp / ffmpeg missing or unusable
+	classNetwork                       // DNS, connection, timeout, 5xx
+	classUnavailable                   // removed, private, members-only, 404
+	classGeoBlocked                    // not available in this country
+	classPostprocess                   // ffmpeg conversion, tagging, cover art
+	classFilesystem                    // cannot read input or write output
+	classCancelled                     // interrupted by the user
+)
+
+// Exit codes, also listed in the README.
+const (
+	exitOK          = 0
+	exitGeneric     = 1
+	exitUsage       = 2
+	exitDependency  = 3
+	exitNetwork     = 4
+	exitUnavailable = 5
+	exitGeoBlocked  = 6
+	exitPostprocess = 7
+	exitFilesystem  = 8
+	exitCancelled   = 130 // 128 + SIGINT, as shells report it
+)
+
+func (c errorClass) String() string {
+	switch c {
+	case classUsage:
+		return "usage"
+	case classDependency:
+		return "dependency"
+	case classNetwork:
+		return "network"
+	case classUnavailable:
+		return "unavailable"
+	case classGeoBlocked:
+		return "geo_blocked"
+	case classPostprocess:
+		return "postprocess"
+	case classFilesystem:
+		return "filesystem"
+	case classCancelled:
+		return "cancelled"
+	}
+	return "generic"
+}
+
+func (c errorClass) exitCode() int {
+	switch c {
+	case classUsage:
+		return exitUsage
+	case classDependency:
+		return exitDependency
+	case classNetwork:
+		return exitNetwork
+	case classUnavailable:
+		return exitUnavailable
+	case classGeoBlocked:
+		return exitGeoBlocked
+	case classPostprocess:
+		return exitPostprocess
+	case classFilesystem:
+		return exitFilesystem
+	case classCancelled:
+		return exitCancelled
+	}
+	return exitGeneric
+}
+
+// classedError attaches an errorClass to an underlying error.
+type classedError struct {
+	class errorClass
+	err   error
+}
+
+func (e *classedError) Error() string { return e.err.Error() }
+func (e *classedError) Unwrap() error { return e.err }
+
+// classify wraps err with class. nil stays nil, and an error that already
+// carries a class keeps it: the innermost classification is the most precise.
+func classify(class errorClass, err error) error {
+	if err == nil {
+		return nil
+	}
+	var ce *classedError
+	if errors.As(err, &ce) {
+		return err
+	}
+	return &classedError{class: class, err: err}
+}
+
+// classOf returns the class of err. Unclassified path errors count as
+// filesystem failures.
+func classOf(err error) errorClass {
+	var ce *classedError
+	if errors.As(err, &ce) {
+		return ce.class
+	}
+	var pe *fs.PathError
+	var le *os.LinkError
+	if errors.As(err, &pe) || errors.As(err, &le) {
+		return classFilesystem
+	}
+	return classGeneric
+}
+
+// ytdlpPatterns maps fragments of yt-dlp ERROR lines to a class. Order
+// matters: geo messages also contain "not available", so they come first,
+// and a missing ffmpeg is a dependency problem, not a failed conversion.
+var ytdlpPatterns = []struct {
+	class     errorClass
+	fragments []string
+}{
+	{classGeoBlocked, []string{
+		"not available in your country", "geo restrict", "geo-restrict",
+		"available in your country", "blocked it in your country",
+	}},
+	{classUnavailable, []string{
+		"video unavailable", "private video", "this video is private",
+		"has been removed", "been terminated", "members-only", "join this channel",
+		"sign in to confirm your age", "is not available", "does not exist",
+		"http error 404", "http error 410", "unsupported url",
+	}},
+	{classNetwork, []string{
+		"unable to download webpage", "unable to download json", "unable to connect",
+		"timed out", "connection refused", "connection reset", "network is unreachable",
+		"temporary failure in name resolution", "name or service not known",
+		"getaddrinfo failed", "urlopen error", "ssl:", "http error 5",
+		"http error 429", "remote end closed connection", "incomplete read",
+	}},
+	{classDependency, []string{
+		"ffmpeg not found", "ffprobe not found", "ffmpeg/avconv not found",
+		"ffmpeg is not installed", "ffprobe is not installed",
+	}},
+	{classPostprocess, []string{
+		"postprocessing", "conversion failed", "error opening output file",
+	}},
+}
+
+// classifyYTDLP derives the class of a yt-dlp failure from its ERROR text.
+func classifyYTDLP(message string) errorClass {
+	lower := strings.ToLower(message)
+	for _, p := range ytdlpPatterns {
+		for _, f := range p.fragments {
+			if strings.Contains(lower, f) {
+				return p.class
+			}
+		}
+	}
+	return classGeneric
+}
+
+// ytdlpError turns yt-dlp's last ERROR line into a classified error. The
+// "ERROR:" marker is dropped but "[extractor] id:" is kept; it names the site.
+func ytdlpError(message string, fallback error) error {
+	message = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(message), "ERROR:"))
+	if message == "" {
+		return classify(classGeneric, fallback)
+	}
+	return classify(classifyYTDLP(message), errors.New(message))
+}
+
+// batchExitCode picks the exit code for a finished batch: 0 if nothing
+// failed, the shared class's code if every failure has the same class,
+// otherwise the generic code. A cancellation always wins.
+func batchExitCode(results []result) int {
+	code := exitOK
+	for _, r := range results {
+		if r.err == nil || errors.Is(r.err, errSkipped) {
+			continue
+		}
+		c := classOf(r.err).exitCode()
+		switch {
+		case c == exitCancelled:
+			return exitCancelled
+		case code == exitOK:
+			code = c
+		case code != c:
+			code = exitGeneric
+		}
+	}
+	return code
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestClassifyYTDLP(t *testing.T) {
+	tests := []struct {
+		message string
+		want    errorClass
+	}{
+		{"[youtube] abc: Video unavailable", classUnavailable},
+		{"[youtube] abc: The uploader has not made this video available in your country", classGeoBlocked},
+		{"[youtube] abc: Unable to download webpage: HTTP Error 503", classNetwork},
+		{"ffmpeg not found. Please install or provide the path using --ffmpeg-location", classDependency},
+		{"Postprocessing: ffprobe and ffmpeg not found. Please install or provide the path using --ffmpeg-location", classDependency},
+		{"You have requested merging of multiple formats but ffmpeg is not installed. Aborting due to --abort-on-error", classDependency},
+		{"Postprocessing: Conversion failed!", classPostprocess},
+		{"Postprocessing: Error opening output files: Invalid argument", classPostprocess},
+		{"Unable to rename file: [Errno 2] No such file or directory", classGeneric},
+	}
+	for _, tt := range tests {
+		if got := classifyYTDLP(tt.message); got != tt.want {
+			t.Errorf("classifyYTDLP(%q) = %v, want %v", tt.message, got, tt.want)
+		}
+	}
+}
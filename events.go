@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ─── JSON Event Stream ────────────────────────────────────────────────────────
+
+// jsonOutput is enabled by --output-format json. stdout then carries one JSON
+// object per line (NDJSON) and all human-oriented output is suppressed.
+var jsonOutput bool
+
+// Event names. Each event carries "event" and "time"; events tied to a job
+// also carry "item", "total" and "url".
+const (
+	evStarted     = "started"     // job picked up by a worker
+	evMetadata    = "metadata"    // id, title, extractor, album, track
+	evDestination = "destination" // path yt-dlp is writing to
+	evProgress    = "progress"    // bytes, total_bytes, percent, speed, eta
+	evPostprocess = "postprocess" // step: merge, extract_audio, metadata, match, embed_cover, tags, move, exec
+	evWarning     = "warning"     // message
+	evError       = "error"       // message
+	evSkipped     = "skipped"     // reason
+	evFinished    = "finished"    // path, size, duration
+	evPlan        = "plan"        // --dry-run: mode, format, label, path, tags
+	evFormats     = "formats"     // formats command: title, video, audio
+	evDoctor      = "doctor"      // doctor command: build, checks, ok
+	evSummary     = "summary"     // succeeded, skipped, failed
+)
+
+// emit writes one event line. It is a no-op unless jsonOutput is set, so call
+// sites can emit unconditionally next to their human-readable output.
+func emit(j *job, name string, fields map[string]any) {
+	if !jsonOutput {
+		return
+	}
+	ev := make(map[string]any, len(fields)+5)
+	for k, v := range fields {
+		ev[k] = v
+	}
+	ev["event"] = name
+	ev["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	if j != nil {
+		ev["url"] = j.url
+		if j.index > 0 {
+			ev["item"] = j.index
+			ev["total"] = j.total
+		}
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		debugLog("emit %s: %v", name, err)
+		return
+	}
+	term.writeLine(os.Stdout, string(data))
+}
+
+// emitStatus maps a printStatus-style message onto warning/error events.
+// info and success messages have dedicated events or are purely cosmetic.
+func emitStatus(j *job, status, message string) {
+	switch status {
+	case "warning":
+		emit(j, evWarning, map[string]any{"message": stripANSI(message)})
+	case "error":
+		emit(j, evError, map[string]any{"message": stripANSI(message)})
+	}
+}
+
+// emitMetadata reports what is known about a job before it downloads,
+// including what fetchMetadata found.
+func emitMetadata(j *job, mode string) {
+	fields := map[string]any{"mode": mode}
+	for k, v := range map[string]string{"id": j.id, "extractor": j.extractor, "title": j.title, "album": j.album} {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+	if j.track > 0 {
+		fields["track"] = j.track
+		fields["track_total"] = j.trackTotal
+	}
+	for _, k := range []string{"uploader", "channel", "duration", "upload_date", "view_count", "webpage_url"} {
+		if v, ok := j.info[k]; ok && v != nil {
+			fields[k] = v
+		}
+	}
+	if size := estimateSize(j, mode == "audio"); size > 0 {
+		fields["size_estimate"] = int64(size)
+	}
+	emit(j, evMetadata, fields)
+}
+
+// emitProgress reports download progress, taking speed and ETA from the
+// yt-dlp line itself rather than the ProgressBar's own estimate.
+func emitProgress(j *job, line string, bytes, total, percent float64) {
+	if !jsonOutput {
+		return
+	}
+	fields := map[string]any{
+		"bytes":       int64(bytes),
+		"total_bytes": int64(total),
+		"percent":     percent,
+	}
+	if m := reSpeedETA.FindStringSubmatch(line); len(m) >= 3 {
+		fields["speed"] = int64(parseSize(m[1]))
+		if m[2] != "" {
+			fields["eta"] = parseClock(m[2])
+		}
+	}
+	emit(j, evProgress, fields)
+}
+
+// parseClock converts yt-dlp's "MM:SS" / "HH:MM:SS" to seconds.
+func parseClock(s string) int {
+	secs := 0
+	for _, part := range strings.Split(s, ":") {
+		n, _ := strconv.Atoi(part)
+		secs = secs*60 + n
+	}
+	return secs
+}
+
+// emitFinished reports the final output file of a job.
+func emitFinished(j *job, path string, started time.Time) {
+	fields := map[string]any{
+		"path":     path,
+		"duration": time.Since(started).Seconds(),
+	}
+	if fi, err := os.Stat(path); err == nil {
+		fields["size"] = fi.Size()
+	}
+	emit(j, evFinished, fields)
+}
+
+// stripANSI removes colour codes so event messages are plain text.
+func stripANSI(s string) string {
+	if colorReset == "" {
+		return s
+	}
+	return reANSI.ReplaceAllString(s, "")
+}
+
+// parseOutputFormat validates --output-format.
+func parseOutputFormat(s string) error {
+	switch s {
+	case "text", "":
+		jsonOutput = false
+	case "json":
+		jsonOutput = true
+	default:
+		return fmt.Errorf("unknown output format %q (want text or json)", s)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ─── Finalizing Output ────────────────────────────────────────────────────────
+
+// finalizeFile moves a finished download from the work directory to dst so
+// that dst is either absent or complete, even on NFS or after a crash.
+//
+// On the same filesystem the data is synced and the file renamed. Across
+// filesystems it is copied to a hidden temp file next to dst, synced, given
+// the source's permissions and mtime, checked for size, and only then
+// renamed over dst. Either way the destination directory is synced so the
+// rename itself survives a power cut.
+func finalizeFile(src, dst string) error {
+	debugLog("finalizeFile: %s → %s", src, dst)
+	if err := syncFile(src); err != nil {
+		return classify(classFilesystem, err)
+	}
+	err := os.Rename(src, dst)
+	if err == nil {
+		syncDir(filepath.Dir(dst))
+		return nil
+	}
+	debugLog("os.Rename failed (%v); copying via temp file", err)
+
+	if err := copyAtomic(src, dst); err != nil {
+		return classify(classFilesystem, err)
+	}
+	if err := os.Remove(src); err != nil {
+		debugLog("removing %s after copy: %v", src, err)
+	}
+	return nil
+}
+
+// copyAtomic copies src over dst through a hidden temp file in dst's
+// directory. The temp file is removed on any failure, and on a forced exit.
+func copyAtomic(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(dst)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(dst)+".*.part")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	atCleanup(func() { os.Remove(tmpName) })
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	if _, err = io.Copy(tmp, in); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(info.Mode().Perm()); err != nil {
+		debugLog("chmod %s: %v", tmpName, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chtimes(tmpName, info.ModTime(), info.ModTime()); err != nil {
+		debugLog("chtimes %s: %v", tmpName, err)
+	}
+
+	copied, err := os.Stat(tmpName)
+	if err != nil {
+		return err
+	}
+	if copied.Size() != info.Size() {
+		return fmt.Errorf("copy of %s is %d bytes, expected %d", filepath.Base(src), copied.Size(), info.Size())
+	}
+	if err = os.Rename(tmpName, dst); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncFile flushes a file's data to stable storage. It opens the file for
+// writing because Windows refuses to flush a read-only handle.
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// syncDir flushes a directory entry change. Some platforms (Windows, some
+// network filesystems) cannot sync directories; that is only logged.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		debugLog("syncDir %s: %v", dir, err)
+		return
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		debugLog("syncDir %s: %v", dir, err)
+	}
+}
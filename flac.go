@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ─── Vorbis Comments ──────────────────────────────────────────────────────────
+
+// vorbisAliases are other names players use for the fields streamline
+// writes. They are removed along with the field so a file never carries
+// two differing album artists or track totals.
+var vorbisAliases = map[string][]string{
+	"ALBUMARTIST":            {"ALBUM ARTIST", "ALBUM_ARTIST"},
+	"TRACKTOTAL":             {"TOTALTRACKS"},
+	"DISCTOTAL":              {"TOTALDISCS"},
+	"METADATA_BLOCK_PICTURE": {"COVERART", "COVERARTMIME"},
+}
+
+// vorbisFields maps tags onto Vorbis comment names. The cover is left to
+// the caller: FLAC stores it in a PICTURE block, Ogg in a comment.
+func vorbisFields(t *audioTags) []tagField {
+	var list []tagField
+	add := func(name, value string) {
+		if value != "" {
+			list = append(list, tagField{name, value})
+		}
+	}
+	add("TITLE", t.title)
+	add("ARTIST", t.artist)
+	add("ALBUMARTIST", t.albumArtist)
+	add("ALBUM", t.album)
+	if t.track > 0 {
+		add("TRACKNUMBER", strconv.Itoa(t.track))
+		if t.trackTotal > 0 {
+			add("TRACKTOTAL", strconv.Itoa(t.trackTotal))
+		}
+	}
+	if t.disc > 0 {
+		add("DISCNUMBER", strconv.Itoa(t.disc))
+		if t.discTotal > 0 {
+			add("DISCTOTAL", strconv.Itoa(t.discTotal))
+		}
+	}
+	add("DATE", t.date)
+	add("ORIGINALDATE", t.originalDate)
+	add("GENRE", t.genre)
+	add("COMMENT", t.comment)
+	return append(list, t.custom...)
+}
+
+// mergeVorbis replaces the comments named in fields (and their aliases)
+// with fields, keeping every other comment in order.
+func mergeVorbis(existing []string, fields []tagField) []string {
+	replaced := map[string]bool{}
+	for _, f := range fields {
+		name := strings.ToUpper(f.name)
+		replaced[name] = true
+		for _, alias := range vorbisAliases[name] {
+			replaced[alias] = true
+		}
+	}
+	var merged []string
+	for _, c := range existing {
+		name, _, _ := strings.Cut(c, "=")
+		if !replaced[strings.ToUpper(name)] {
+			merged = append(merged, c)
+		}
+	}
+	for _, f := range fields {
+		merged = append(merged, f.name+"="+f.value)
+	}
+	return merged
+}
+
+// parseVorbisComment decodes a comment header body: a vendor string and a
+// list of "NAME=value" comments, all length-prefixed little-endian. rest
+// is whatever follows the list (Vorbis' framing bit, Opus' extra data).
+func parseVorbisComment(b []byte) (vendor string, comments []string, rest []byte, err error) {
+	next := func() (string, bool) {
+		if len(b) < 4 {
+			return "", false
+		}
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return "", false
+		}
+		s := string(b[4 : 4+n])
+		b = b[4+n:]
+		return s, true
+	}
+	vendor, ok := next()
+	if !ok || len(b) < 4 {
+		return "", nil, nil, errors.New("truncated Vorbis comment header")
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	for i := uint32(0); i < count; i++ {
+		c, ok := next()
+		if !ok {
+			return "", nil, nil, errors.New("truncated Vorbis comment")
+		}
+		comments = append(comments, c)
+	}
+	return vendor, comments, b, nil
+}
+
+func encodeVorbisComment(vendor string, comments []string) []byte {
+	size := 8 + len(vendor)
+	for _, c := range comments {
+		size += 4 + len(c)
+	}
+	b := make([]byte, 0, size)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(vendor)))
+	b = append(b, vendor...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(comments)))
+	for _, c := range comments {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(c)))
+		b = append(b, c...)
+	}
+	return b
+}
+
+// pictureComment is the METADATA_BLOCK_PICTURE comment Ogg files use for
+// cover art: a base64 FLAC PICTURE block.
+func pictureComment(cover []byte) (tagField, error) {
+	block, err := flacPictureBlock(cover, coverMIME(cover))
+	if err != nil {
+		return tagField{}, err
+	}
+	return tagField{"METADATA_BLOCK_PICTURE", base64.StdEncoding.EncodeToString(block)}, nil
+}
+
+// ─── FLAC ─────────────────────────────────────────────────────────────────────
+
+// FLAC metadata block types.
+const (
+	flacStreamInfo    = 0
+	flacPadding       = 1
+	flacVorbisComment = 4
+	flacPicture       = 6
+)
+
+// flacPaddingSize is left after the tags so later edits by other tools do
+// not have to rewrite the file.
+const flacPaddingSize = 4096
+
+type flacBlock struct {
+	kind byte
+	body []byte
+}
+
+// writeFLACTags rewrites the metadata blocks in front of the audio frames:
+// the VORBIS_COMMENT block is merged with tags, a front-cover PICTURE
+// replaces any existing one, and old padding is replaced by fresh padding.
+// STREAMINFO stays first, as the format requires.
+func writeFLACTags(r *os.File, w io.Writer, t *audioTags) error {
+	br := bufio.NewReader(r)
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != "fLaC" {
+		return errors.New("not a FLAC file")
+	}
+
+	var (
+		blocks   []flacBlock
+		vendor   = "streamline"
+		comments []string
+	)
+	for last := false; !last; {
+		var head [4]byte
+		if _, err := io.ReadFull(br, head[:]); err != nil {
+			return fmt.Errorf("reading FLAC metadata: %w", err)
+		}
+		last = head[0]&0x80 != 0
+		kind := head[0] & 0x7f
+		body := make([]byte, int(head[1])<<16|int(head[2])<<8|int(head[3]))
+		if _, err := io.ReadFull(br, body); err != nil {
+			return fmt.Errorf("reading FLAC metadata: %w", err)
+		}
+		switch {
+		case kind == flacVorbisComment:
+			var err error
+			if vendor, comments, _, err = parseVorbisComment(body); err != nil {
+				return err
+			}
+		case kind == flacPadding:
+		case kind == flacPicture && t.cover != nil && len(body) >= 4 && binary.BigEndian.Uint32(body) == 3:
+		default:
+			blocks = append(blocks, flacBlock{kind, body})
+		}
+	}
+	if len(blocks) == 0 || blocks[0].kind != flacStreamInfo {
+		return errors.New("FLAC file does not start with STREAMINFO")
+	}
+
+	blocks = append(blocks, flacBlock{flacVorbisComment, encodeVorbisComment(vendor, mergeVorbis(comments, vorbisFields(t)))})
+	if t.cover != nil {
+		picture, err := flacPictureBlock(t.cover, coverMIME(t.cover))
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, flacBlock{flacPicture, picture})
+	}
+	blocks = append(blocks, flacBlock{flacPadding, make([]byte, flacPaddingSize)})
+
+	if _, err := w.Write(magic); err != nil {
+		return err
+	}
+	for i, b := range blocks {
+		if len(b.body) >= 1<<24 {
+			return fmt.Errorf("FLAC metadata block of %d bytes is too large", len(b.body))
+		}
+		kind := b.kind
+		if i == len(blocks)-1 {
+			kind |= 0x80
+		}
+		n := len(b.body)
+		if _, err := w.Write([]byte{kind, byte(n >> 16), byte(n >> 8), byte(n)}); err != nil {
+			return err
+		}
+		if _, err := w.Write(b.body); err != nil {
+			return err
+		}
+	}
+	_, err := io.Copy(w, br)
+	return err
+}
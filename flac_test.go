@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// rawFLAC lays out a FLAC file: the magic, the blocks with the last-block
+// flag on the final one, then audio.
+func rawFLAC(blocks []flacBlock, audio []byte) []byte {
+	b := []byte("fLaC")
+	for i, block := range blocks {
+		kind := block.kind
+		if i == len(blocks)-1 {
+			kind |= 0x80
+		}
+		n := len(block.body)
+		b = append(b, kind, byte(n>>16), byte(n>>8), byte(n))
+		b = append(b, block.body...)
+	}
+	return append(b, audio...)
+}
+
+// readTestFLAC splits a written file into its metadata blocks and audio.
+// The metadata ends at the block with the last-block flag, so a misplaced
+// flag shows up as missing blocks or as blocks read into the audio.
+func readTestFLAC(t *testing.T, b []byte) (blocks []flacBlock, audio []byte) {
+	t.Helper()
+	if !bytes.HasPrefix(b, []byte("fLaC")) {
+		t.Fatalf("output does not start with fLaC")
+	}
+	b = b[4:]
+	for last := false; !last; {
+		if len(b) < 4 {
+			t.Fatalf("metadata runs past the end of the file")
+		}
+		last = b[0]&0x80 != 0
+		n := int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+		if len(b) < 4+n {
+			t.Fatalf("block of type %d runs past the end of the file", b[0]&0x7f)
+		}
+		blocks = append(blocks, flacBlock{b[0] & 0x7f, b[4 : 4+n]})
+		b = b[4+n:]
+	}
+	return blocks, b
+}
+
+// flacPictureType is the picture type a PICTURE block starts with.
+func flacPictureType(b flacBlock) uint32 {
+	return binary.BigEndian.Uint32(b.body)
+}
+
+func TestWriteFLACTags(t *testing.T) {
+	const flacApplication = 2
+	streamInfo := flacBlock{flacStreamInfo, bytes.Repeat([]byte{0x11}, 34)}
+	application := flacBlock{flacApplication, []byte("ABCDapplication data")}
+	oldCover, err := flacPictureBlock(testCover(t, 8), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backCover := bytes.Clone(oldCover)
+	binary.BigEndian.PutUint32(backCover, 4)
+	comments := flacBlock{flacVorbisComment, encodeVorbisComment("reference libFLAC 1.4.3",
+		[]string{"TITLE=Old title", "LYRICS=la la", "ALBUM ARTIST=Someone", "TotalTracks=9"})}
+	audio := []byte("\xff\xf8AUDIO FRAMES")
+	in := rawFLAC([]flacBlock{
+		streamInfo,
+		{flacPadding, make([]byte, 100)},
+		comments,
+		{flacPicture, oldCover},
+		application,
+		{flacPicture, backCover},
+	}, audio)
+
+	cover := testCover(t, 0)
+	newCover, err := flacPictureBlock(cover, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		cover []byte
+		want  []flacBlock // the PADDING block is only checked for its size
+	}{
+		{"new cover", cover, []flacBlock{streamInfo, application, {flacPicture, backCover},
+			{flacVorbisComment, nil}, {flacPicture, newCover}, {flacPadding, nil}}},
+		{"no cover", nil, []flacBlock{streamInfo, {flacPicture, oldCover}, application, {flacPicture, backCover},
+			{flacVorbisComment, nil}, {flacPadding, nil}}},
+	}
+	for _, tt := range tests {
+		tags := &audioTags{title: "Song", albumArtist: "Artist", track: 2, trackTotal: 10, cover: tt.cover}
+		blocks, gotAudio := readTestFLAC(t, rewrite(t, writeFLACTags, in, tags))
+		if !bytes.Equal(gotAudio, audio) {
+			t.Errorf("%s: audio = %q, want %q", tt.name, gotAudio, audio)
+		}
+		var kinds, wantKinds []byte
+		for _, b := range blocks {
+			kinds = append(kinds, b.kind)
+		}
+		for _, b := range tt.want {
+			wantKinds = append(wantKinds, b.kind)
+		}
+		if !bytes.Equal(kinds, wantKinds) {
+			t.Errorf("%s: block types = %v, want %v", tt.name, kinds, wantKinds)
+			continue
+		}
+		for i, b := range blocks {
+			switch want := tt.want[i]; {
+			case b.kind == flacPadding:
+				if len(b.body) != flacPaddingSize {
+					t.Errorf("%s: %d bytes of padding, want %d", tt.name, len(b.body), flacPaddingSize)
+				}
+			case b.kind == flacVorbisComment:
+				vendor, got, _, err := parseVorbisComment(b.body)
+				if err != nil {
+					t.Fatalf("%s: %v", tt.name, err)
+				}
+				want := []string{"LYRICS=la la", "TITLE=Song", "ALBUMARTIST=Artist", "TRACKNUMBER=2", "TRACKTOTAL=10"}
+				if vendor != "reference libFLAC 1.4.3" || !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: comments = %q %q, want %q kept and %q", tt.name, vendor, got, "reference libFLAC 1.4.3", want)
+				}
+			case !bytes.Equal(b.body, want.body):
+				t.Errorf("%s: block %d (type %d) changed", tt.name, i, b.kind)
+			}
+		}
+		front := 0
+		for _, b := range blocks {
+			if b.kind == flacPicture && flacPictureType(b) == 3 {
+				front++
+			}
+		}
+		if front != 1 {
+			t.Errorf("%s: %d front covers, want 1", tt.name, front)
+		}
+	}
+}
+
+func TestWriteFLACTagsErrors(t *testing.T) {
+	audio := []byte("\xff\xf8AUDIO")
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{"not FLAC", []byte("ID3\x04 not a FLAC file")},
+		{"no STREAMINFO", rawFLAC([]flacBlock{{flacVorbisComment, encodeVorbisComment("x", nil)}}, audio)},
+		{"truncated block", []byte("fLaC\x80\x00\x00\x22short")},
+	}
+	for _, tt := range tests {
+		if _, err := runWriter(t, writeFLACTags, tt.in, &audioTags{title: "Song"}); err == nil {
+			t.Errorf("%s: writeFLACTags succeeded", tt.name)
+		}
+	}
+}
+
+func TestMergeVorbis(t *testing.T) {
+	existing := []string{"title=Old", "ALBUM ARTIST=Old", "COVERART=abc", "REPLAYGAIN_TRACK_GAIN=-6 dB", "Artist=Old"}
+	fields := []tagField{{"TITLE", "New"}, {"ALBUMARTIST", "Band"}, {"METADATA_BLOCK_PICTURE", "xyz"}}
+	want := []string{"REPLAYGAIN_TRACK_GAIN=-6 dB", "Artist=Old", "TITLE=New", "ALBUMARTIST=Band", "METADATA_BLOCK_PICTURE=xyz"}
+	if got := mergeVorbis(existing, fields); !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeVorbis() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// ─── Flags ────────────────────────────────────────────────────────────────────
+
+// flagGroup selects which flags a command accepts. Every command gets
+// groupGlobal.
+type flagGroup int
+
+const (
+	groupGlobal   flagGroup = 1 << iota // --debug, --verbose
+	groupConfig                         // --profile, --config
+	groupOutput                         // --output-format
+	groupArchive                        // --archive
+	groupDownload                       // batch input, naming, conflicts, hooks
+	groupAudio                          // audio format, quality and cover
+	groupVideo                          // video format selection
+	groupLegacy                         // -m, -v, --about: the command-less form
+	groupFormats                        // --sort for the formats table
+	groupServe                          // --listen for the serve command
+
+	groupAll = groupGlobal | groupConfig | groupOutput | groupArchive |
+		groupDownload | groupAudio | groupVideo | groupLegacy | groupFormats | groupServe
+)
+
+// cliFlags are the flags that steer the run as a whole rather than each
+// download; the latter are bound straight to an options value. Flags outside
+// the command's groups keep their zero value.
+type cliFlags struct {
+	audioMode, videoMode, about, noArchive *bool
+	debug, verbose                         *bool
+	input, archivePath, outFormat          *string
+	workers                                *int
+	profile, configPath                    *string
+	sort                                   *string
+	listen                                 *string
+}
+
+// newFlagSet declares the flags of the given groups, binding download
+// settings to o. The config file sets the same flags by name, so a flag
+// added here is configurable too. Usage strings put the value placeholder
+// in backquotes, as flag.UnquoteUsage expects.
+func newFlagSet(name string, groups flagGroup, o *options) (*flag.FlagSet, *cliFlags) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = usage
+	c := &cliFlags{
+		audioMode: new(bool), videoMode: new(bool), about: new(bool), noArchive: new(bool),
+		input: new(string), archivePath: new(string), outFormat: new(string),
+		workers: new(int), profile: new(string), configPath: new(string), sort: new(string),
+		listen: new(string),
+	}
+	*c.workers = 1
+	*o = options{output: defaultOutputTemplate, onConflict: conflictRename, defaultQuality: "best", coverSize: 500, coverCrop: coverCropSmart, coverFormat: "jpeg", coverQuality: coverBestQuality, id3Version: 3, remastered: remasteredKeep, matchThreshold: defaultMatchThreshold}
+
+	c.debug = fs.Bool("debug", false, "Enable verbose debug/diagnostic output")
+	c.verbose = fs.Bool("verbose", false, "Alias for --debug")
+	if groups&groupLegacy != 0 {
+		c.audioMode = fs.Bool("m", false, "Music/audio mode (audio + metadata + cover art)")
+		c.videoMode = fs.Bool("v", false, "Video mode (quality selection)")
+		c.about = fs.Bool("about", false, "Author information")
+	}
+	if groups&groupConfig != 0 {
+		c.profile = fs.String("profile", "", "Apply a [profile.`NAME`] section of the config file")
+		c.configPath = fs.String("config", "", "Config file `PATH` (default: see streamline config path)")
+	}
+	if groups&groupOutput != 0 {
+		c.outFormat = fs.String("output-format", "text", "Output `F`: text or json (NDJSON event stream on stdout)")
+	}
+	if groups&groupArchive != 0 {
+		c.archivePath = fs.String("archive", "", "Download archive file `P` (default: user data dir)")
+	}
+	if groups&groupDownload != 0 {
+		c.input = fs.String("i", "", "Read URLs from `file`, one per line (\"-\" for stdin)")
+		c.workers = fs.Int("jobs", 1, "Download `N` items in parallel")
+		c.noArchive = fs.Bool("no-archive", false, "Do not skip or record already-downloaded items")
+		fs.StringVar(&o.output, "o", defaultOutputTemplate, "File name template `T`")
+		fs.StringVar(&o.output, "output", defaultOutputTemplate, "File name template `T`")
+		fs.StringVar(&o.dir, "dir", "", "Save downloads under `D` (default: current directory)")
+		fs.StringVar(&o.onConflict, "on-conflict", conflictRename, "Existing output `P`: rename, skip, overwrite, ask")
+		fs.BoolVar(&o.dryRun, "dry-run", false, "Show what would be downloaded and where, then stop")
+		fs.Var(&o.exec, "exec", "Run `CMD` after each download ($STREAMLINE_PATH); repeatable")
+	}
+	if groups&groupAudio != 0 {
+		fs.StringVar(&o.audioFormat, "audio-format", "", "Audio format `F`: mp3 (default), m4a, opus, flac, ogg, wav, or best (no re-encode)")
+		fs.StringVar(&o.audioQuality, "audio-quality", "", "Encoder quality `Q`: V0–V9, a bitrate (128k, 320k) or archive, mobile, podcast")
+		fs.IntVar(&o.coverSize, "cover-size", 500, "Cover art size in pixels `N`")
+		fs.StringVar(&o.coverCrop, "cover-crop", coverCropSmart, "Square the cover by `M`: smart (find the artwork inside bars), center, pad or none")
+		fs.StringVar(&o.coverFormat, "cover-format", "jpeg", "Cover art format `F`: jpeg or png")
+		fs.IntVar(&o.coverQuality, "cover-quality", coverBestQuality, "Cover JPEG quality `N`: 2 (best) to 31 (smallest)")
+		fs.StringVar(&o.coverMaxSize, "cover-max-size", "", "Shrink cover art to at most `SIZE` (e.g. 200K)")
+		fs.StringVar(&o.coverFile, "cover-file", "", "Embed the image at `PATH` instead of the thumbnail")
+		fs.IntVar(&o.id3Version, "id3-version", 3, "ID3v2 `version` of MP3 tags: 3 (widest support) or 4")
+		fs.BoolVar(&o.rawTitle, "raw-title", false, "Tag the upload title as-is instead of splitting artist and song")
+		fs.StringVar(&o.remastered, "remastered", remasteredKeep, "Remaster notes in titles `M`: keep or strip")
+		fs.Var(&o.titleRules, "title-rule", "Title `REGEX`: named groups artist/title split, others delete; repeatable")
+		fs.StringVar(&o.metadataSource, "metadata-source", "", "Match tags against a MusicBrainz/Discogs dump or MusicBrainz API `SRC`")
+		fs.Float64Var(&o.matchThreshold, "match-threshold", defaultMatchThreshold, "Confidence `N` (0–1) above which a match retags without asking")
+	}
+	if groups&groupVideo != 0 {
+		fs.StringVar(&o.quality, "quality", "", "Video preset `Q`: best, 1080p, 720p, 480p, 360p")
+		fs.StringVar(&o.format, "format", "", "Raw yt-dlp format `SPEC` (e.g. 137+140)")
+		fs.IntVar(&o.maxHeight, "max-height", 0, "Cap video height at `N` pixels")
+		fs.StringVar(&o.preferCodec, "prefer-codec", "", "Prefer codec `C`: avc, hevc, vp9 or av1")
+		fs.StringVar(&o.defaultQuality, "default-quality", "best", "Preset `Q` used when stdin is not a terminal")
+	}
+	if groups&groupFormats != 0 {
+		c.sort = fs.String("sort", "", "Sort by `KEY`: "+sortKeys(videoSorts)+" for video, "+sortKeys(audioSorts)+" for audio")
+	}
+	if groups&groupServe != 0 {
+		c.listen = fs.String("listen", defaultListen, "Serve the HTTP API on `ADDR` (host:port)")
+	}
+	return fs, c
+}
+
+// flagAliases maps a short flag to the long one it duplicates; help lists
+// them together.
+var flagAliases = map[string]string{"o": "output"}
+
+// isSetting reports whether any command has a flag called name, so a config
+// file written for video does not break the audio command.
+func isSetting(name string) bool {
+	fs, _ := newFlagSet("", groupAll, new(options))
+	return fs.Lookup(name) != nil
+}
+
+// parseArgs parses flags wherever they appear among the arguments, so
+// `streamline audio <url> --jobs 2` works; "--" ends flag parsing. It
+// returns the positional arguments in order.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// enableDebug turns on debug logging if --debug or --verbose was given.
+func enableDebug(c *cliFlags) {
+	if !*c.debug && !*c.verbose {
+		return
+	}
+	debugMode = true
+	printStatus("info", fmt.Sprintf("%sDebug mode enabled – verbose output is ON%s", colorYellow, colorReset))
+	debugLog("Streamline starting up (GOOS=%s GOARCH=%s)", runtime.GOOS, runtime.GOARCH)
+	debugLog("Args: %v", os.Args[1:])
+}
+
+// printFlags lists fs's flags in the usage() column layout.
+func printFlags(fs *flag.FlagSet) {
+	short := map[string]string{}
+	for s, long := range flagAliases {
+		short[long] = s
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if flagAliases[f.Name] != "" && fs.Lookup(flagAliases[f.Name]) != nil {
+			return
+		}
+		arg, help := flag.UnquoteUsage(f)
+		label := "--" + f.Name
+		if len(f.Name) == 1 {
+			label = "-" + f.Name
+		}
+		if s := short[f.Name]; s != "" {
+			label = "-" + s + ", " + label
+		}
+		if arg != "" && arg != "value" {
+			label += " " + arg
+		}
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" && !strings.Contains(help, "(default") {
+			if _, isString := f.Value.(flag.Getter).Get().(string); isString {
+				help += fmt.Sprintf(" (default %q)", f.DefValue)
+			} else {
+				help += fmt.Sprintf(" (default %s)", f.DefValue)
+			}
+		}
+		fmt.Printf("  %s%-18s%s %s\n", colorGreen, label, colorReset, help)
+	})
+}
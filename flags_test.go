@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestLegacyFlags(t *testing.T) {
+	fs, _ := newFlagSet("streamline", legacyFlags, new(options))
+	for _, name := range []string{"m", "v", "about", "audio-format", "quality", "jobs", "archive", "profile"} {
+		if fs.Lookup(name) == nil {
+			t.Errorf("-m/-v form lacks --%s", name)
+		}
+	}
+	for _, name := range []string{"listen", "sort"} {
+		if fs.Lookup(name) != nil {
+			t.Errorf("-m/-v form accepts --%s", name)
+		}
+	}
+}
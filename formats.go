@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ─── Format Catalogue ─────────────────────────────────────────────────────────
+
+// ytdlpFormat is one entry of the "formats" array in yt-dlp's JSON
+// output. Sizes are float64 because some extractors report them as floats.
+type ytdlpFormat struct {
+	ID             string  `json:"format_id"`
+	Ext            string  `json:"ext"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	FPS            float64 `json:"fps"`
+	VCodec         string  `json:"vcodec"`
+	ACodec         string  `json:"acodec"`
+	TBR            float64 `json:"tbr"`
+	ABR            float64 `json:"abr"`
+	DynamicRange   string  `json:"dynamic_range"`
+	Filesize       float64 `json:"filesize"`
+	FilesizeApprox float64 `json:"filesize_approx"`
+	Language       string  `json:"language"`
+	Note           string  `json:"format_note"`
+}
+
+func (f *ytdlpFormat) hasVideo() bool {
+	return f.VCodec != "none" && (f.VCodec != "" || f.Height > 0)
+}
+
+func (f *ytdlpFormat) hasAudio() bool {
+	return f.ACodec != "none" && f.ACodec != ""
+}
+
+// size returns the exact size if known, otherwise yt-dlp's estimate.
+func (f *ytdlpFormat) size() (bytes float64, approx bool) {
+	if f.Filesize > 0 {
+		return f.Filesize, false
+	}
+	return f.FilesizeApprox, f.FilesizeApprox > 0
+}
+
+func (f *ytdlpFormat) bitrate() float64 {
+	if f.hasVideo() || f.ABR == 0 {
+		return f.TBR
+	}
+	return f.ABR
+}
+
+// splitFormats separates streams with a picture from audio-only streams.
+// Storyboards and other entries with neither are dropped.
+func splitFormats(formats []ytdlpFormat) (video, audio []ytdlpFormat) {
+	for _, f := range formats {
+		switch {
+		case f.hasVideo():
+			video = append(video, f)
+		case f.hasAudio():
+			audio = append(audio, f)
+		}
+	}
+	return video, audio
+}
+
+// ─── Sorting ──────────────────────────────────────────────────────────────────
+
+// formatSort is a sort key the picker accepts. Numeric keys sort highest
+// first; text keys alphabetically.
+type formatSort struct {
+	key  string
+	less func(a, b *ytdlpFormat) bool
+}
+
+func bySize(a, b *ytdlpFormat) bool {
+	sa, _ := a.size()
+	sb, _ := b.size()
+	return sa > sb
+}
+
+func byBitrate(a, b *ytdlpFormat) bool { return a.bitrate() > b.bitrate() }
+
+var videoSorts = []formatSort{
+	{"res", func(a, b *ytdlpFormat) bool {
+		if a.Height != b.Height {
+			return a.Height > b.Height
+		}
+		if a.FPS != b.FPS {
+			return a.FPS > b.FPS
+		}
+		return a.TBR > b.TBR
+	}},
+	{"fps", func(a, b *ytdlpFormat) bool { return a.FPS > b.FPS }},
+	{"size", bySize},
+	{"rate", byBitrate},
+	{"codec", func(a, b *ytdlpFormat) bool { return a.VCodec < b.VCodec }},
+}
+
+var audioSorts = []formatSort{
+	{"rate", byBitrate},
+	{"size", bySize},
+	{"lang", func(a, b *ytdlpFormat) bool { return a.Language < b.Language }},
+	{"codec", func(a, b *ytdlpFormat) bool { return a.ACodec < b.ACodec }},
+}
+
+func sortKeys(sorts []formatSort) string {
+	keys := make([]string, len(sorts))
+	for i, s := range sorts {
+		keys[i] = s.key
+	}
+	return strings.Join(keys, "|")
+}
+
+func sortFormats(list []ytdlpFormat, sorts []formatSort, key string) bool {
+	for _, s := range sorts {
+		if s.key == key {
+			sort.SliceStable(list, func(i, k int) bool { return s.less(&list[i], &list[k]) })
+			return true
+		}
+	}
+	return false
+}
+
+// ─── Tables ───────────────────────────────────────────────────────────────────
+
+func formatSize(f *ytdlpFormat) string {
+	bytes, approx := f.size()
+	if bytes == 0 {
+		return "-"
+	}
+	const mib = 1024 * 1024
+	s := fmt.Sprintf("%.1f MiB", bytes/mib)
+	if bytes >= 1024*mib {
+		s = fmt.Sprintf("%.2f GiB", bytes/(1024*mib))
+	}
+	if approx {
+		s = "~" + s
+	}
+	return s
+}
+
+func formatRate(kbps float64) string {
+	if kbps == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0fk", kbps)
+}
+
+// shorten cuts s to n runes so one long codec string cannot skew a table.
+func shorten(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func printVideoTable(w io.Writer, list []ytdlpFormat) {
+	fmt.Fprintf(w, "%s%3s  %-8s %-5s %-10s %4s  %-12s %-6s %7s %12s  %s%s\n", colorBold,
+		"#", "ID", "EXT", "RESOLUTION", "FPS", "VCODEC", "HDR", "BITRATE", "SIZE", "AUDIO", colorReset)
+	for i := range list {
+		f := &list[i]
+		res := "-"
+		if f.Height > 0 {
+			res = fmt.Sprintf("%dx%d", f.Width, f.Height)
+		}
+		fps := "-"
+		if f.FPS > 0 {
+			fps = strconv.FormatFloat(f.FPS, 'f', -1, 64)
+		}
+		audio := "-"
+		if f.hasAudio() {
+			audio = shorten(f.ACodec, 12)
+		}
+		fmt.Fprintf(w, "%s%3d%s  %-8s %-5s %-10s %4s  %-12s %-6s %7s %12s  %s\n",
+			colorGreen, i+1, colorReset,
+			shorten(f.ID, 8), shorten(f.Ext, 5), res, fps, shorten(orDash(f.VCodec), 12),
+			shorten(orDash(f.DynamicRange), 6), formatRate(f.TBR), formatSize(f), audio)
+	}
+}
+
+func printAudioTable(w io.Writer, list []ytdlpFormat) {
+	fmt.Fprintf(w, "%s%3s  %-8s %-5s %-12s %7s %-6s %12s%s\n", colorBold,
+		"#", "ID", "EXT", "ACODEC", "BITRATE", "LANG", "SIZE", colorReset)
+	for i := range list {
+		f := &list[i]
+		fmt.Fprintf(w, "%s%3d%s  %-8s %-5s %-12s %7s %-6s %12s\n",
+			colorGreen, i+1, colorReset,
+			shorten(f.ID, 8), shorten(f.Ext, 5), shorten(f.ACodec, 12),
+			formatRate(f.bitrate()), shorten(orDash(f.Language), 6), formatSize(f))
+	}
+}
+
+// ─── Picker ───────────────────────────────────────────────────────────────────
+
+// pickFormatSpec lets the user choose a video and an audio stream from the
+// catalogue and builds the yt-dlp spec ("137+140", or a single ID when one
+// side is skipped). It must run inside term.hold.
+func pickFormatSpec(j *job, formats []ytdlpFormat) (string, error) {
+	w := promptWriter()
+	video, audio := splitFormats(formats)
+	if len(video)+len(audio) == 0 {
+		return "", classify(classUnavailable, fmt.Errorf("yt-dlp reported no downloadable formats"))
+	}
+
+	v := pickFormat(w, j, "Video streams", video, videoSorts, printVideoTable, "audio only")
+	a := pickFormat(w, j, "Audio streams", audio, audioSorts, printAudioTable, "no separate audio")
+
+	var ids []string
+	for _, f := range []*ytdlpFormat{v, a} {
+		if f != nil {
+			ids = append(ids, f.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return "", classify(classUsage, fmt.Errorf("no video or audio stream selected"))
+	}
+	return strings.Join(ids, "+"), nil
+}
+
+// pickFormat shows one table and loops until the user enters a row number,
+// a format ID, 0 for none, or a sort key (which redraws the table). It
+// returns nil for none.
+func pickFormat(w io.Writer, j *job, title string, list []ytdlpFormat, sorts []formatSort,
+	render func(io.Writer, []ytdlpFormat), none string) *ytdlpFormat {
+	if len(list) == 0 {
+		return nil
+	}
+	sortFormats(list, sorts, sorts[0].key)
+	for {
+		fmt.Fprintf(w, "\n%s── %s ──%s\n", colorYellow, title, colorReset)
+		render(w, list)
+		fmt.Fprintf(w, "\n%s%sPick 1-%d, 0 for %s, or sort by %s:%s ",
+			j.prefix(), colorCyan, len(list), none, sortKeys(sorts), colorReset)
+
+		answer, err := readLine()
+		if err != nil {
+			return nil
+		}
+		if n, err := strconv.Atoi(answer); err == nil {
+			switch {
+			case n == 0:
+				return nil
+			case n > 0 && n <= len(list):
+				return &list[n-1]
+			}
+		}
+		for i := range list {
+			if list[i].ID == answer {
+				return &list[i]
+			}
+		}
+		if !sortFormats(list, sorts, strings.ToLower(answer)) {
+			fmt.Fprintf(w, "%sNot a row, format ID or sort key: %q%s\n", colorRed, answer, colorReset)
+		}
+	}
+}
+
+// ─── Validation ───────────────────────────────────────────────────────────────
+
+// formatSelectors are the yt-dlp keywords that may stand in for a format ID.
+var formatSelectors = map[string]bool{
+	"best": true, "worst": true, "bestvideo": true, "worstvideo": true,
+	"bestaudio": true, "worstaudio": true, "b": true, "w": true,
+	"bv": true, "wv": true, "ba": true, "wa": true, "mergeall": true, "all": true,
+}
+
+// formatIDs returns, per "/"-separated alternative of spec, the literal
+// format IDs it names. Selectors, filters ("[height<=720]") and groups are
+// left to yt-dlp. ok is false when spec names no literal IDs at all.
+func formatIDs(spec string) (alts [][]string, ok bool) {
+	if strings.ContainsAny(spec, "(),") {
+		return nil, false
+	}
+	for _, alt := range strings.Split(spec, "/") {
+		var ids []string
+		for _, part := range strings.Split(alt, "+") {
+			part = strings.TrimSpace(part)
+			if part == "" || strings.Contains(part, "[") {
+				continue
+			}
+			if formatSelectors[strings.TrimRight(part, "*")] {
+				continue
+			}
+			ids = append(ids, part)
+			ok = true
+		}
+		alts = append(alts, ids)
+	}
+	return alts, ok
+}
+
+// checkFormatIDs rejects a spec whose literal format IDs are not offered for
+// the video, so a typo fails before anything is downloaded. A spec with
+// several alternatives passes as long as one of them is fully available.
+func checkFormatIDs(j *job, spec string) error {
+	alts, ok := formatIDs(spec)
+	if !ok {
+		return nil
+	}
+	formats := j.formats
+	known := make(map[string]bool, len(formats))
+	for _, f := range formats {
+		known[f.ID] = true
+	}
+
+	var missing []string
+	for _, ids := range alts {
+		var altMissing []string
+		for _, id := range ids {
+			if !known[id] {
+				altMissing = append(altMissing, id)
+			}
+		}
+		if len(altMissing) == 0 {
+			return nil
+		}
+		missing = append(missing, altMissing...)
+	}
+	available := make([]string, 0, len(formats))
+	for _, f := range formats {
+		available = append(available, f.ID)
+	}
+	return classify(classUsage, fmt.Errorf("format %s not offered for this video (available: %s)",
+		strings.Join(missing, ", "), strings.Join(available, ", ")))
+}
+
+// readLine reads one answer from stdin. It reads a byte at a time, as
+// fmt.Scanln does, so input typed ahead is left for later prompts. It fails
+// only when stdin ends before anything was typed.
+func readLine() (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(b)
+		if n == 0 || err != nil {
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+			break
+		}
+		if b[0] == '\n' {
+			break
+		}
+		line = append(line, b[0])
+	}
+	return strings.TrimSpace(string(line)), nil
+}
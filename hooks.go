@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ─── Post-download Hooks ──────────────────────────────────────────────────────
+
+// runHooks runs each --exec command through the platform shell once a file
+// is in place. The command finds the file in $STREAMLINE_PATH, along with
+// STREAMLINE_URL, STREAMLINE_TITLE and STREAMLINE_ID. A failing hook is
+// reported but does not fail the download: the file is already saved and
+// recorded in the archive.
+func runHooks(j *job, path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	for _, hook := range opts.exec {
+		debugLog("runHooks: %s (STREAMLINE_PATH=%s)", hook, path)
+		emit(j, evPostprocess, map[string]any{"step": "exec", "command": hook})
+		cmd := shellCommand(hook)
+		cmd.Env = append(os.Environ(),
+			"STREAMLINE_PATH="+path,
+			"STREAMLINE_URL="+j.url,
+			"STREAMLINE_TITLE="+j.title,
+			"STREAMLINE_ID="+j.id)
+		out, err := combinedOutputCommand(cmd)
+		if len(out) > 0 {
+			debugLog("hook output:\n%s", out)
+		}
+		if err != nil {
+			msg := err.Error()
+			if len(out) > 0 {
+				msg = lastLine(string(out))
+			}
+			j.status("warning", fmt.Sprintf("Hook %q failed: %s", hook, msg))
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ─── ID3v2 (MP3) ──────────────────────────────────────────────────────────────
+
+// ID3 text encodings, the first byte of text, comment and picture frames.
+const (
+	id3Latin1  = 0
+	id3UTF16   = 1 // with byte order mark
+	id3UTF16BE = 2 // ID3v2.4 only
+	id3UTF8    = 3 // ID3v2.4 only
+)
+
+// id3PaddingSize is left after the frames so other tools can edit the tag
+// without rewriting the file.
+const id3PaddingSize = 1024
+
+// Frames that exist in only one version. Kept frames of the other version
+// are dropped when a tag is converted; the dates are rewritten anyway.
+var (
+	id3v23Only = map[string]bool{"TYER": true, "TDAT": true, "TIME": true, "TORY": true,
+		"TRDA": true, "TSIZ": true, "IPLS": true, "EQUA": true, "RVAD": true}
+	id3v24Only = map[string]bool{"TDRC": true, "TDOR": true, "TDRL": true, "TDEN": true, "TDTG": true,
+		"TIPL": true, "TMCL": true, "TMOO": true, "TPRO": true, "TSST": true,
+		"ASPI": true, "EQU2": true, "RVA2": true, "SEEK": true, "SIGN": true}
+)
+
+// id3Encoded are the non-text frames that start with a text encoding byte.
+var id3Encoded = map[string]bool{"WXXX": true, "COMM": true, "USLT": true, "SYLT": true,
+	"APIC": true, "GEOB": true, "USER": true, "OWNE": true, "COMR": true}
+
+type id3Frame struct {
+	id   string
+	body []byte
+}
+
+// writeID3 replaces the ID3v2 tag at the start of an MP3 with one in
+// version --id3-version. Frames streamline does not set are carried over,
+// converted between 2.3 and 2.4 where needed; the audio is copied as-is.
+func writeID3(r *os.File, w io.Writer, t *audioTags) error {
+	br := bufio.NewReader(r)
+	from, old, err := readID3(br)
+	if err != nil {
+		return err
+	}
+	version := byte(opts.id3Version)
+	frames := id3Frames(t, version)
+	replaced := map[string]bool{}
+	for _, f := range frames {
+		replaced[f.id] = true
+	}
+	if t.date != "" {
+		for _, id := range []string{"TYER", "TDAT", "TIME", "TDRC"} {
+			replaced[id] = true
+		}
+	}
+	if t.originalDate != "" {
+		replaced["TORY"], replaced["TDOR"] = true, true
+	}
+	for _, f := range old {
+		if replaced[f.id] && f.id != "TXXX" && f.id != "COMM" && f.id != "APIC" || id3Replaces(f, t) {
+			continue
+		}
+		if f, ok := convertID3Frame(f, from, version); ok {
+			frames = append(frames, f)
+		} else {
+			debugLog("writeID3: dropping %s frame (ID3v2.%d → 2.%d)", f.id, from, version)
+		}
+	}
+
+	tag, err := encodeID3(version, frames)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(tag); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, br)
+	return err
+}
+
+// id3Replaces reports whether an existing TXXX, COMM or APIC frame is one
+// streamline writes: a TXXX of the same name, the unnamed comment, or the
+// front cover.
+func id3Replaces(f id3Frame, t *audioTags) bool {
+	if len(f.body) < 1 {
+		return true
+	}
+	switch f.id {
+	case "TXXX":
+		desc := id3DecodeText(f.body[0], f.body[1:])
+		for _, c := range t.custom {
+			if len(desc) > 0 && strings.EqualFold(desc[0], c.name) {
+				return true
+			}
+		}
+	case "COMM":
+		if t.comment != "" && len(f.body) >= 4 {
+			desc := id3DecodeText(f.body[0], f.body[4:])
+			return len(desc) == 0 || desc[0] == ""
+		}
+	case "APIC":
+		if t.cover != nil {
+			_, rest, ok := bytes.Cut(f.body[1:], []byte{0})
+			return ok && len(rest) > 0 && rest[0] == 3
+		}
+	}
+	return false
+}
+
+// id3Frames maps tags onto frames. ID3v2.3 has only a year (plus day and
+// month in TDAT) and an original release year; 2.4 stores full dates.
+func id3Frames(t *audioTags, version byte) []id3Frame {
+	var frames []id3Frame
+	text := func(id string, values ...string) {
+		if values[len(values)-1] != "" {
+			frames = append(frames, id3Frame{id, id3TextBody(version, values...)})
+		}
+	}
+	text("TIT2", t.title)
+	text("TPE1", t.artist)
+	text("TPE2", t.albumArtist)
+	text("TALB", t.album)
+	if t.track > 0 {
+		text("TRCK", numberPair(t.track, t.trackTotal))
+	}
+	if t.disc > 0 {
+		text("TPOS", numberPair(t.disc, t.discTotal))
+	}
+	if version == 4 {
+		text("TDRC", t.date)
+		text("TDOR", t.originalDate)
+	} else {
+		text("TYER", year(t.date))
+		if len(t.date) == 10 {
+			text("TDAT", t.date[8:10]+t.date[5:7])
+		}
+		text("TORY", year(t.originalDate))
+	}
+	text("TCON", t.genre)
+	if t.comment != "" {
+		// Encoding, language, then an empty description and the text.
+		text := id3TextBody(version, "", t.comment)
+		body := append([]byte{text[0]}, "eng"...)
+		frames = append(frames, id3Frame{"COMM", append(body, text[1:]...)})
+	}
+	for _, f := range t.custom {
+		text("TXXX", f.name, f.value)
+	}
+	if t.cover != nil {
+		body := append([]byte{id3Latin1}, coverMIME(t.cover)+"\x00"...)
+		body = append(body, 3) // front cover
+		body = append(body, "Cover (front)\x00"...)
+		frames = append(frames, id3Frame{"APIC", append(body, t.cover...)})
+	}
+	return frames
+}
+
+// readID3 consumes the ID3v2 tag at the start of r, if there is one, and
+// returns its version and frames. An ID3v2.2 tag is skipped and its frames
+// dropped: its three-letter frames have no direct equivalent.
+func readID3(br *bufio.Reader) (version byte, frames []id3Frame, err error) {
+	head, err := br.Peek(10)
+	if err != nil || string(head[:3]) != "ID3" {
+		return 0, nil, nil
+	}
+	version, flags := head[3], head[5]
+	size := syncsafe(head[6:10])
+	if flags&0x10 != 0 {
+		size += 10 // footer
+	}
+	br.Discard(10)
+	body := make([]byte, size)
+	if _, err := io.ReadFull(br, body); err != nil {
+		return 0, nil, fmt.Errorf("reading ID3 tag: %w", err)
+	}
+	if version != 3 && version != 4 {
+		debugLog("readID3: dropping ID3v2.%d tag", version)
+		return version, nil, nil
+	}
+	if flags&0x10 != 0 {
+		body = body[:len(body)-10]
+	}
+	if version == 3 && flags&0x80 != 0 {
+		body = id3Resync(body)
+	}
+	if flags&0x40 != 0 && len(body) >= 4 {
+		n := int(binary.BigEndian.Uint32(body)) + 4
+		if version == 4 {
+			n = syncsafe(body)
+		}
+		if n > len(body) {
+			return 0, nil, errors.New("bad ID3 extended header")
+		}
+		body = body[n:]
+	}
+	return version, parseID3Frames(body, version, version == 4 && flags&0x80 != 0), nil
+}
+
+// parseID3Frames splits a tag body into frames, undoing per-frame
+// unsynchronisation. Compressed, encrypted or grouped frames are dropped.
+func parseID3Frames(b []byte, version byte, unsynced bool) []id3Frame {
+	var frames []id3Frame
+	for len(b) >= 10 && b[0] != 0 {
+		id := string(b[:4])
+		size := int(binary.BigEndian.Uint32(b[4:]))
+		if version == 4 {
+			size = syncsafe(b[4:])
+		}
+		format := b[9]
+		if size > len(b)-10 {
+			debugLog("parseID3Frames: %s frame overruns the tag", id)
+			break
+		}
+		body := b[10 : 10+size]
+		b = b[10+size:]
+
+		switch {
+		case version == 3 && format&0xe0 != 0, version == 4 && format&0x4c != 0:
+			debugLog("parseID3Frames: dropping %s frame with flags %#x", id, format)
+			continue
+		case version == 4 && format&0x01 != 0 && len(body) >= 4:
+			body = body[4:] // data length indicator
+		}
+		if version == 4 && (unsynced || format&0x02 != 0) {
+			body = id3Resync(body)
+		}
+		frames = append(frames, id3Frame{id, body})
+	}
+	return frames
+}
+
+// convertID3Frame rewrites a frame from one tag version for another. Frames
+// the target version lacks are dropped, as are non-text frames in UTF-8,
+// which ID3v2.3 cannot express; text frames are re-encoded.
+func convertID3Frame(f id3Frame, from, to byte) (id3Frame, bool) {
+	if from == to || from == 0 {
+		return f, true
+	}
+	if to == 3 && id3v24Only[f.id] || to == 4 && id3v23Only[f.id] {
+		return f, false
+	}
+	v24Text := len(f.body) > 0 && (f.body[0] == id3UTF8 || f.body[0] == id3UTF16BE)
+	switch {
+	case f.id == "CHAP" || f.id == "CTOC":
+		return convertID3Chapter(f, from, to)
+	case to == 3 && v24Text && f.id[0] == 'T':
+		return id3Frame{f.id, id3TextBody(to, id3DecodeText(f.body[0], f.body[1:])...)}, true
+	case to == 3 && v24Text && id3Encoded[f.id]:
+		return f, false
+	}
+	return f, true
+}
+
+// convertID3Chapter converts the frames embedded in a CHAP or CTOC frame,
+// whose sizes follow the tag version.
+func convertID3Chapter(f id3Frame, from, to byte) (id3Frame, bool) {
+	elementID, _, ok := bytes.Cut(f.body, []byte{0})
+	n := len(elementID) + 1
+	switch {
+	case !ok:
+		return f, false
+	case f.id == "CHAP":
+		n += 16 // start and end time and offset
+	default: // CTOC: flags, entry count, then the child element IDs
+		if len(f.body) < n+2 {
+			return f, false
+		}
+		count := int(f.body[n+1])
+		n += 2
+		for i := 0; i < count; i++ {
+			child, _, ok := bytes.Cut(f.body[n:], []byte{0})
+			if !ok {
+				return f, false
+			}
+			n += len(child) + 1
+		}
+	}
+	if n > len(f.body) {
+		return f, false
+	}
+	body := append([]byte{}, f.body[:n]...)
+	for _, sub := range parseID3Frames(f.body[n:], from, false) {
+		if sub, ok := convertID3Frame(sub, from, to); ok {
+			body = appendID3Frame(body, to, sub)
+		}
+	}
+	return id3Frame{f.id, body}, true
+}
+
+func encodeID3(version byte, frames []id3Frame) ([]byte, error) {
+	var body []byte
+	for _, f := range frames {
+		if len(f.body) >= 1<<28 {
+			return nil, fmt.Errorf("ID3 %s frame of %d bytes is too large", f.id, len(f.body))
+		}
+		body = appendID3Frame(body, version, f)
+	}
+	body = append(body, make([]byte, id3PaddingSize)...)
+	if len(body) >= 1<<28 {
+		return nil, errors.New("ID3 tag is too large")
+	}
+	tag := append([]byte("ID3"), version, 0, 0)
+	tag = appendSyncsafe(tag, len(body))
+	return append(tag, body...), nil
+}
+
+func appendID3Frame(b []byte, version byte, f id3Frame) []byte {
+	b = append(b, f.id...)
+	if version == 4 {
+		b = appendSyncsafe(b, len(f.body))
+	} else {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(f.body)))
+	}
+	b = append(b, 0, 0)
+	return append(b, f.body...)
+}
+
+// syncsafe decodes a 28-bit integer stored 7 bits per byte.
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+func appendSyncsafe(b []byte, n int) []byte {
+	return append(b, byte(n>>21)&0x7f, byte(n>>14)&0x7f, byte(n>>7)&0x7f, byte(n)&0x7f)
+}
+
+// id3Resync undoes unsynchronisation: every 0xFF 0x00 becomes 0xFF.
+func id3Resync(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xff, 0x00}, []byte{0xff})
+}
+
+// id3Encoding picks the text encoding for values: UTF-8 in ID3v2.4;
+// Latin-1 in 2.3 when it suffices, UTF-16 otherwise.
+func id3Encoding(version byte, values ...string) byte {
+	if version == 4 {
+		return id3UTF8
+	}
+	for _, v := range values {
+		for _, r := range v {
+			if r > 0xff {
+				return id3UTF16
+			}
+		}
+	}
+	return id3Latin1
+}
+
+// id3TextBody encodes a text frame: the encoding byte, then the values
+// separated by terminators (TXXX's description and value, for one).
+func id3TextBody(version byte, values ...string) []byte {
+	enc := id3Encoding(version, values...)
+	body := []byte{enc}
+	for i, v := range values {
+		if i > 0 {
+			body = append(body, id3Terminator(enc)...)
+		}
+		body = append(body, id3EncodeText(enc, v)...)
+	}
+	return body
+}
+
+func id3Terminator(enc byte) []byte {
+	if enc == id3UTF16 || enc == id3UTF16BE {
+		return []byte{0, 0}
+	}
+	return []byte{0}
+}
+
+func id3EncodeText(enc byte, s string) []byte {
+	switch enc {
+	case id3Latin1:
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			b = append(b, byte(r))
+		}
+		return b
+	case id3UTF16:
+		b := []byte{0xff, 0xfe}
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = binary.LittleEndian.AppendUint16(b, u)
+		}
+		return b
+	}
+	return []byte(s)
+}
+
+// id3DecodeText splits text in the given encoding at its terminators.
+func id3DecodeText(enc byte, b []byte) []string {
+	var values []string
+	switch enc {
+	case id3UTF16, id3UTF16BE:
+		for len(b) > 0 {
+			end := len(b) &^ 1
+			for i := 0; i+1 < len(b); i += 2 {
+				if b[i] == 0 && b[i+1] == 0 {
+					end = i
+					break
+				}
+			}
+			values = append(values, decodeUTF16(b[:end], enc == id3UTF16BE))
+			b = b[min(end+2, len(b)):]
+		}
+	default:
+		for _, part := range bytes.Split(bytes.TrimRight(b, "\x00"), []byte{0}) {
+			if enc == id3Latin1 {
+				runes := make([]rune, len(part))
+				for i, c := range part {
+					runes[i] = rune(c)
+				}
+				values = append(values, string(runes))
+			} else {
+				values = append(values, strings.ToValidUTF8(string(part), string(utf8.RuneError)))
+			}
+		}
+	}
+	return values
+}
+
+// decodeUTF16 decodes UTF-16 text, honouring a byte order mark.
+func decodeUTF16(b []byte, bigEndian bool) string {
+	if len(b) >= 2 && (b[0] == 0xff && b[1] == 0xfe || b[0] == 0xfe && b[1] == 0xff) {
+		bigEndian = b[0] == 0xfe
+		b = b[2:]
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = binary.BigEndian.Uint16(b[2*i:])
+		} else {
+			units[i] = binary.LittleEndian.Uint16(b[2*i:])
+		}
+	}
+	return string(utf16.Decode(units))
+}
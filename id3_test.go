@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// rawID3Frame encodes a frame the way a tag of the given version stores it.
+func rawID3Frame(version byte, id string, flags byte, body []byte) []byte {
+	b := []byte(id)
+	if version == 4 {
+		b = appendSyncsafe(b, len(body))
+	} else {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(body)))
+	}
+	b = append(b, 0, flags)
+	return append(b, body...)
+}
+
+// rawID3Tag wraps a tag body, with some padding, in an ID3v2 header.
+func rawID3Tag(version, flags byte, body []byte) []byte {
+	body = append(body, make([]byte, 16)...)
+	tag := append([]byte("ID3"), version, 0, flags)
+	tag = appendSyncsafe(tag, len(body))
+	return append(tag, body...)
+}
+
+// id3Unsync applies unsynchronisation: a zero after every 0xFF, which is
+// more than an encoder needs but decodes the same.
+func id3Unsync(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xff}, []byte{0xff, 0x00})
+}
+
+// readTestID3 splits a written file into its tag's version, flags and
+// frames, and the audio after it.
+func readTestID3(t *testing.T, b []byte) (version, flags byte, frames map[string][]id3Frame, audio []byte) {
+	t.Helper()
+	if len(b) < 10 || string(b[:3]) != "ID3" {
+		t.Fatalf("output does not start with an ID3 tag: % x", b[:min(len(b), 10)])
+	}
+	br := bufio.NewReader(bytes.NewReader(b))
+	version, list, err := readID3(br)
+	if err != nil {
+		t.Fatalf("reading written tag: %v", err)
+	}
+	frames = map[string][]id3Frame{}
+	for _, f := range list {
+		frames[f.id] = append(frames[f.id], f)
+	}
+	audio, _ = io.ReadAll(br)
+	return version, b[5], frames, audio
+}
+
+func TestWriteID3Versions(t *testing.T) {
+	audio := []byte("\xff\xfbAUDIO FRAMES\xff\x00")
+	cover := testCover(t, 0)
+	priv := []byte("owner@example.com\x00\x01\xff\x02")
+	back := append([]byte("\x00image/jpeg\x00\x04Back\x00"), "old back cover"...)
+	front := append([]byte("\x00image/jpeg\x00\x03\x00"), "old front cover"...)
+
+	tests := []struct {
+		from, to   byte
+		kept, gone []string
+	}{
+		{3, 3, []string{"TSIZ", "TYER"}, []string{"TDRC", "TSST"}},
+		{3, 4, []string{"TDRC"}, []string{"TSIZ", "TYER"}},
+		{4, 3, []string{"TYER", "TPUB"}, []string{"TSST", "TDRC", "USLT"}},
+		{4, 4, []string{"TDRC", "TSST", "TPUB", "USLT"}, []string{"TYER"}},
+	}
+	for _, tt := range tests {
+		withOptions(t, func(o *options) { o.id3Version = int(tt.to) })
+		v := tt.from
+		body := rawID3Frame(v, "TIT2", 0, id3TextBody(v, "Old title"))
+		body = append(body, rawID3Frame(v, "PRIV", 0, priv)...)
+		body = append(body, rawID3Frame(v, "XYZW", 0, []byte("unknown frame"))...)
+		body = append(body, rawID3Frame(v, "TXXX", 0, id3TextBody(v, "FOO", "bar"))...)
+		body = append(body, rawID3Frame(v, "APIC", 0, back)...)
+		body = append(body, rawID3Frame(v, "APIC", 0, front)...)
+		if v == 3 {
+			body = append(body, rawID3Frame(v, "TYER", 0, id3TextBody(v, "1999"))...)
+			body = append(body, rawID3Frame(v, "TSIZ", 0, id3TextBody(v, "1234"))...)
+		} else {
+			body = append(body, rawID3Frame(v, "TSST", 0, id3TextBody(v, "Disc one"))...)
+			body = append(body, rawID3Frame(v, "TPUB", 0, []byte("\x03Labél"))...)
+			body = append(body, rawID3Frame(v, "USLT", 0, []byte("\x03engVerse\x00la la"))...)
+		}
+		in := append(rawID3Tag(v, 0, body), audio...)
+
+		tags := &audioTags{title: "Song", artist: "Artist", date: "2024-01-02", cover: cover}
+		version, flags, frames, gotAudio := readTestID3(t, rewrite(t, writeID3, in, tags))
+		name := fmt.Sprintf("ID3v2.%d → 2.%d", tt.from, tt.to)
+
+		if version != tt.to || flags != 0 {
+			t.Errorf("%s: wrote version 2.%d with flags %#x", name, version, flags)
+		}
+		if !bytes.Equal(gotAudio, audio) {
+			t.Errorf("%s: audio = %q, want %q", name, gotAudio, audio)
+		}
+		if f := frames["TIT2"]; len(f) != 1 || id3DecodeText(f[0].body[0], f[0].body[1:])[0] != "Song" {
+			t.Errorf("%s: TIT2 = %q, want one frame with Song", name, f)
+		}
+		if f := frames["PRIV"]; len(f) != 1 || !bytes.Equal(f[0].body, priv) {
+			t.Errorf("%s: PRIV = %q, want %q", name, f, priv)
+		}
+		if f := frames["XYZW"]; len(f) != 1 || string(f[0].body) != "unknown frame" {
+			t.Errorf("%s: unknown frame = %q, want it kept", name, f)
+		}
+		if f := frames["TXXX"]; len(f) != 1 || id3DecodeText(f[0].body[0], f[0].body[1:])[0] != "FOO" {
+			t.Errorf("%s: TXXX = %q, want FOO kept", name, f)
+		}
+		var covers []string
+		for _, f := range frames["APIC"] {
+			covers = append(covers, string(f.body))
+		}
+		wantFront := "\x00image/png\x00\x03Cover (front)\x00" + string(cover)
+		if len(covers) != 2 || covers[0] != wantFront || covers[1] != string(back) {
+			t.Errorf("%s: APIC frames = %q, want the new front cover and the old back cover", name, covers)
+		}
+		for _, id := range tt.kept {
+			if len(frames[id]) == 0 {
+				t.Errorf("%s: %s frame missing", name, id)
+			}
+		}
+		for _, id := range tt.gone {
+			if len(frames[id]) != 0 {
+				t.Errorf("%s: %s frame written, want it dropped", name, id)
+			}
+		}
+		if f := frames["TPUB"]; tt.from == 4 && len(f) == 1 {
+			if got := id3DecodeText(f[0].body[0], f[0].body[1:]); len(got) != 1 || got[0] != "Labél" {
+				t.Errorf("%s: TPUB = %q, want Labél", name, got)
+			}
+		}
+		if f := frames["TYER"]; tt.to == 3 && (len(f) != 1 || id3DecodeText(f[0].body[0], f[0].body[1:])[0] != "2024") {
+			t.Errorf("%s: TYER = %q, want 2024", name, f)
+		}
+	}
+}
+
+func TestWriteID3Unsynchronisation(t *testing.T) {
+	withOptions(t, func(o *options) { o.id3Version = 4 })
+	audio := []byte("\xff\xfbAUDIO")
+	priv := []byte("owner\x00\xff\xe0\xff\x00\xff")
+
+	v24Frame := append(appendSyncsafe(nil, len(priv)), id3Unsync(priv)...)
+	tests := []struct {
+		name string
+		tag  []byte
+	}{
+		{"2.3 whole tag", rawID3Tag(3, 0x80, id3Unsync(rawID3Frame(3, "PRIV", 0, priv)))},
+		{"2.4 whole tag", rawID3Tag(4, 0x80, rawID3Frame(4, "PRIV", 0, id3Unsync(priv)))},
+		{"2.4 frame with data length", rawID3Tag(4, 0, rawID3Frame(4, "PRIV", 0x03, v24Frame))},
+		{"2.4 compressed frame dropped", rawID3Tag(4, 0,
+			append(rawID3Frame(4, "PRIV", 0, priv), rawID3Frame(4, "TXXX", 0x08, []byte("zlib data"))...))},
+	}
+	for _, tt := range tests {
+		in := append(bytes.Clone(tt.tag), audio...)
+		_, flags, frames, gotAudio := readTestID3(t, rewrite(t, writeID3, in, &audioTags{title: "Song"}))
+		if flags != 0 {
+			t.Errorf("%s: written tag has flags %#x, want none", tt.name, flags)
+		}
+		if f := frames["PRIV"]; len(f) != 1 || !bytes.Equal(f[0].body, priv) {
+			t.Errorf("%s: PRIV = % x, want % x", tt.name, f, priv)
+		}
+		if len(frames["TXXX"]) != 0 {
+			t.Errorf("%s: compressed TXXX frame kept", tt.name)
+		}
+		if !bytes.Equal(gotAudio, audio) {
+			t.Errorf("%s: audio = % x, want % x", tt.name, gotAudio, audio)
+		}
+	}
+}
+
+func TestWriteID3NoTag(t *testing.T) {
+	withOptions(t, func(o *options) { o.id3Version = 3 })
+	audio := []byte("\xff\xfbAUDIO")
+	version, _, frames, gotAudio := readTestID3(t, rewrite(t, writeID3, audio, &audioTags{title: "Song", artist: "Ärtist ☃"}))
+	if version != 3 || !bytes.Equal(gotAudio, audio) {
+		t.Errorf("wrote version 2.%d before % x, want 2.3 before % x", version, gotAudio, audio)
+	}
+	f := frames["TPE1"]
+	if len(f) != 1 || f[0].body[0] != id3UTF16 || id3DecodeText(id3UTF16, f[0].body[1:])[0] != "Ärtist ☃" {
+		t.Errorf("TPE1 = %q, want UTF-16 Ärtist ☃", f)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ─── Video Metadata ───────────────────────────────────────────────────────────
+
+// fetchMetadata asks yt-dlp once for everything it knows about j's URL. The
+// JSON is saved in the work directory and handed back with
+// --load-info-json, so the download does not query the site again; the
+// parsed copy feeds the display, the format picker, output naming, conflict
+// checks and the archive. A single URL was already resolved in full while
+// planning, and that JSON is used instead of asking again.
+func fetchMetadata(ytdlpPath string, j *job) error {
+	out := j.prefetched
+	if out == nil {
+		spinner := NewSpinner(j.prefix() + "Fetching video information...")
+		spinner.Start()
+		var err error
+		out, err = outputCommand(newCommand(ytdlpPath, "--dump-single-json", "--no-playlist", "--", j.url))
+		spinner.Stop(err == nil)
+		if err != nil {
+			var ee *exec.ExitError
+			if errors.As(err, &ee) {
+				return ytdlpError(lastLine(string(ee.Stderr)), err)
+			}
+			return classify(classDependency, err)
+		}
+	}
+	j.prefetched = nil
+
+	var info map[string]any
+	var parsed struct {
+		Formats []ytdlpFormat `json:"formats"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return fmt.Errorf("parsing yt-dlp JSON: %w", err)
+	}
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return fmt.Errorf("parsing yt-dlp formats: %w", err)
+	}
+
+	j.infoFile = filepath.Join(j.workDir, "metadata.info.json")
+	if err := os.WriteFile(j.infoFile, out, 0o644); err != nil {
+		return classify(classFilesystem, err)
+	}
+	j.info = info
+	j.formats = parsed.Formats
+	debugLog("fetchMetadata: %d field(s), %d format(s) → %s", len(info), len(j.formats), j.infoFile)
+
+	// Flat playlist entries can lack these; the archive key needs them.
+	if j.id == "" {
+		j.id = infoString(info, "id")
+	}
+	if j.extractor == "" {
+		j.extractor = infoString(info, "extractor_key")
+	}
+	if j.title == "" {
+		j.title = infoString(info, "title")
+	}
+	return nil
+}
+
+func infoString(info map[string]any, key string) string {
+	s, _ := info[key].(string)
+	return s
+}
+
+func infoNumber(info map[string]any, key string) float64 {
+	n, _ := info[key].(float64)
+	return n
+}
+
+// bestAudioFormat approximates yt-dlp's "bestaudio": the audio-only stream
+// with the highest bitrate.
+func bestAudioFormat(formats []ytdlpFormat) *ytdlpFormat {
+	var best *ytdlpFormat
+	for i := range formats {
+		f := &formats[i]
+		if f.hasVideo() || !f.hasAudio() {
+			continue
+		}
+		if best == nil || f.bitrate() > best.bitrate() {
+			best = f
+		}
+	}
+	return best
+}
+
+// estimateSize is the expected download size in bytes, or 0 if unknown. For
+// audio it is the best audio stream; for video, yt-dlp's default selection.
+func estimateSize(j *job, audioOnly bool) float64 {
+	if audioOnly {
+		if f := bestAudioFormat(j.formats); f != nil {
+			size, _ := f.size()
+			return size
+		}
+		return 0
+	}
+	if requested, ok := j.info["requested_formats"].([]any); ok {
+		var total float64
+		for _, r := range requested {
+			if m, ok := r.(map[string]any); ok {
+				size := infoNumber(m, "filesize")
+				if size == 0 {
+					size = infoNumber(m, "filesize_approx")
+				}
+				total += size
+			}
+		}
+		return total
+	}
+	if size := infoNumber(j.info, "filesize"); size > 0 {
+		return size
+	}
+	return infoNumber(j.info, "filesize_approx")
+}
+
+// showMetadata prints what was fetched before the download starts.
+func showMetadata(j *job, audioOnly bool) {
+	line := func(label, value string) {
+		if value != "" {
+			j.status("info", fmt.Sprintf("%-10s %s%s%s", label+":", colorBold, value, colorReset))
+		}
+	}
+	line("Title", infoString(j.info, "title"))
+	uploader := infoString(j.info, "uploader")
+	if uploader == "" {
+		uploader = infoString(j.info, "channel")
+	}
+	line("Uploader", uploader)
+	if d := infoNumber(j.info, "duration"); d > 0 {
+		line("Duration", formatDuration(d))
+	}
+	if d := infoString(j.info, "upload_date"); len(d) == 8 {
+		line("Uploaded", d[:4]+"-"+d[4:6]+"-"+d[6:])
+	}
+	if v, ok := j.info["view_count"].(float64); ok {
+		line("Views", groupThousands(int64(v)))
+	}
+
+	video, audio := splitFormats(j.formats)
+	if len(video)+len(audio) > 0 {
+		summary := fmt.Sprintf("%d video, %d audio", len(video), len(audio))
+		maxHeight := 0
+		for _, f := range video {
+			if f.Height > maxHeight {
+				maxHeight = f.Height
+			}
+		}
+		if maxHeight > 0 {
+			summary += fmt.Sprintf(" (up to %dp)", maxHeight)
+		}
+		line("Formats", summary)
+	}
+	if size := estimateSize(j, audioOnly); size > 0 {
+		const mib = 1024 * 1024
+		line("Size", fmt.Sprintf("~%.1f MB", size/mib))
+	}
+}
+
+// groupThousands renders 1234567 as "1,234,567".
+func groupThousands(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	if n < 0 {
+		return "-" + groupThousands(-n)
+	}
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
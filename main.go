@@ -2,15 +2,16 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
-	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,6 +24,8 @@ var (
 	reProgressPct  = regexp.MustCompile(`\[download\]\s+(\d+\.?\d*)%`)
 	reSizeExtract  = regexp.MustCompile(`of\s+~?\s*([\d.]+\s*[KMGT]i?B?)`)
 	reParseSize    = regexp.MustCompile(`([\d.]+)\s*([KMGT]i?B?)`)
+	reSpeedETA     = regexp.MustCompile(`at\s+~?\s*([\d.]+\s*[KMGT]?i?B)/s(?:\s+ETA\s+([\d:]+))?`)
+	reANSI         = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
 )
 
 // ─── Debug / Verbose Logging ──────────────────────────────────────────────────
@@ -33,18 +36,22 @@ func debugLog(format string, args ...any) {
 	}
 	ts := time.Now().Format("15:04:05.000")
 	msg := fmt.Sprintf(format, args...)
-	fmt.Fprintf(os.Stderr, "%s[DEBUG %s]%s %s\n", colorDim, ts, colorReset, msg)
+	term.writeLine(os.Stderr, fmt.Sprintf("%s[DEBUG %s]%s %s", colorDim, ts, colorReset, msg))
 }
 
 // ─── Progress Bar ─────────────────────────────────────────────────────────────
 
+// ProgressBar draws one live row on the shared terminal. Its methods are safe
+// for concurrent use.
 type ProgressBar struct {
+	mu          sync.Mutex
 	total       float64
 	current     float64
 	width       int
 	description string
 	startTime   time.Time
 	lastUpdate  time.Time
+	row         *termRow
 }
 
 func NewProgressBar(description string, width int) *ProgressBar {
@@ -55,23 +62,37 @@ func NewProgressBar(description string, width int) *ProgressBar {
 		width:       width,
 		startTime:   now,
 		lastUpdate:  now,
+		row:         term.addRow(),
 	}
 }
 
 func (p *ProgressBar) Update(current, total float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	p.current = current
 	p.total = total
 	if time.Since(p.lastUpdate) < 100*time.Millisecond && current < total {
 		return
 	}
 	p.lastUpdate = time.Now()
-	p.Render()
+	p.render()
 }
 
 func (p *ProgressBar) Render() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.render()
+}
+
+func (p *ProgressBar) render() {
 	if p.total == 0 {
 		return
 	}
+	term.setRow(p.row, p.line())
+}
+
+// line formats the bar; the caller holds p.mu.
+func (p *ProgressBar) line() string {
 	percent := (p.current / p.total) * 100
 	if percent > 100 {
 		percent = 100
@@ -94,7 +115,7 @@ func (p *ProgressBar) Render() {
 	}
 
 	const mib = 1024 * 1024
-	fmt.Printf("\r%s%s%s %s%s%s%s%s │ %s%.1f%%%s │ %s%.2f/%.2f MB%s │ %s%.2f MB/s%s │ ETA: %s%s%s    ",
+	return fmt.Sprintf("%s%s%s %s%s%s%s%s │ %s%.1f%%%s │ %s%.2f/%.2f MB%s │ %s%.2f MB/s%s │ ETA: %s%s%s",
 		colorBold, p.description, colorReset,
 		colorGreen, bar, colorDim, empty, colorReset,
 		colorCyan, percent, colorReset,
@@ -103,16 +124,20 @@ func (p *ProgressBar) Render() {
 		colorGreen, formatDuration(remaining), colorReset)
 }
 
+// Complete fills the bar and moves it from the live block into the scrollback.
 func (p *ProgressBar) Complete() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	final := ""
 	if p.total > 0 {
 		p.current = p.total
-		p.Render()
+		final = p.line()
 		const mib = 1024 * 1024
 		debugLog("ProgressBar %q complete: %.2f MB in %s",
 			p.description, p.total/mib,
 			formatDuration(time.Since(p.startTime).Seconds()))
 	}
-	fmt.Println()
+	term.removeRow(p.row, final)
 }
 
 // ─── Spinner ──────────────────────────────────────────────────────────────────
@@ -122,6 +147,8 @@ type Spinner struct {
 	index   int
 	message string
 	stop    chan struct{}
+	done    chan struct{}
+	row     *termRow
 }
 
 func NewSpinner(message string) *Spinner {
@@ -130,33 +157,38 @@ func NewSpinner(message string) *Spinner {
 		frames:  []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"},
 		message: message,
 		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
 	}
 }
 
 func (s *Spinner) Start() {
+	s.row = term.addRow()
 	go func() {
+		defer close(s.done)
 		ticker := time.NewTicker(80 * time.Millisecond)
 		defer ticker.Stop()
 		for {
+			term.setRow(s.row, fmt.Sprintf("%s%s%s %s", colorCyan, s.frames[s.index], colorReset, s.message))
+			s.index = (s.index + 1) % len(s.frames)
 			select {
 			case <-s.stop:
 				return
 			case <-ticker.C:
-				fmt.Printf("\r%s%s%s %s   ", colorCyan, s.frames[s.index], colorReset, s.message)
-				s.index = (s.index + 1) % len(s.frames)
 			}
 		}
 	}()
 }
 
+// Stop waits for the animation goroutine to exit before printing the result,
+// so the final line can never be overwritten by a late frame.
 func (s *Spinner) Stop(success bool) {
 	close(s.stop)
-	time.Sleep(100 * time.Millisecond)
+	<-s.done
 	icon, color := "✓", colorGreen
 	if !success {
 		icon, color = "✗", colorRed
 	}
-	fmt.Printf("\r%s%s%s %s\n", color, icon, colorReset, s.message)
+	term.removeRow(s.row, fmt.Sprintf("%s%s%s %s", color, icon, colorReset, s.message))
 	debugLog("Spinner stopped: %q success=%v", s.message, success)
 }
 
@@ -182,37 +214,47 @@ func usage() {
 ╚═════════════════════════════════════════════╝%s
 
 %sUsage:%s
-  streamline -m <url>          Download audio with metadata and cover
-  streamline -v <url>          Download video, choose quality manually
-  streamline --about           Show author information
-  streamline --debug -m <url>  Enable verbose debug output
-
-%sExamples:%s
-  streamline -m https://youtube.com/watch?v=xxxxx
-  streamline -v https://youtu.be/xxxxx
-  streamline --debug -m https://youtube.com/watch?v=xxxxx
-
-%sFlags:%s
-  %s-m%s          Music/audio mode (MP3 + metadata + cover art)
-  %s-v%s          Video mode (quality selection)
-  %s--about%s     Author information
-  %s--debug%s     Enable verbose debug/diagnostic output
-  %s--verbose%s   Alias for --debug
+  streamline <command> [flags] [args]
+  streamline -m|-v [flags] <url>...   Original form: -m for audio, -v for video
 
+%sCommands:%s
 `,
 		colorCyan, colorBold, colorReset, colorReset,
 		colorYellow, colorReset,
+		colorYellow, colorReset)
+	for _, cmd := range commands {
+		fmt.Printf("  %s%-11s%s %s\n", colorGreen, cmd.name, colorReset, cmd.summary)
+	}
+	fmt.Printf(`
+%sExamples:%s
+  streamline audio https://youtube.com/watch?v=xxxxx
+  streamline video --quality 720p https://youtu.be/xxxxx
+  cat links.txt | streamline audio -i -
+  streamline audio -i links.txt --jobs 4 --dry-run
+  streamline audio --audio-format flac --dir ~/Music -o "{uploader}/{album|Singles}/{track:02d|00} - {title}.{ext}" <url>
+  streamline video --max-height 1080 --prefer-codec av1 -i links.txt
+  streamline --profile podcast <url>
+  streamline formats https://youtu.be/xxxxx
+  streamline -m https://youtube.com/watch?v=xxxxx --debug
+
+Run "streamline <command> --help" for the flags of a command. Every command
+takes %s--debug%s (or %s--verbose%s) for diagnostic output; %s--about%s shows author
+information.
+
+Exit codes: 0 ok, 2 usage, 3 dependency, 4 network, 5 unavailable,
+6 geo-blocked, 7 post-processing, 8 filesystem, 130 cancelled, 1 other.
+
+`,
 		colorYellow, colorReset,
-		colorYellow, colorReset,
-		colorGreen, colorReset,
-		colorGreen, colorReset,
 		colorGreen, colorReset,
 		colorGreen, colorReset,
 		colorGreen, colorReset)
-	os.Exit(0)
 }
 
 func printBanner() {
+	if jsonOutput {
+		return
+	}
 	const banner = `
 ╔═════════════════════════════════════════════╗
 ║ Streamline - YouTube/SoundCloud Downloader  ║
@@ -221,6 +263,10 @@ func printBanner() {
 }
 
 func printStatus(status, message string) {
+	if jsonOutput {
+		emitStatus(nil, status, message)
+		return
+	}
 	type entry struct{ icon, color string }
 	table := map[string]entry{
 		"info":    {"ℹ", colorBlue},
@@ -232,7 +278,7 @@ func printStatus(status, message string) {
 	if !ok {
 		e = entry{"•", colorReset}
 	}
-	fmt.Printf("%s%s%s %s\n", e.color, e.icon, colorReset, message)
+	term.println(fmt.Sprintf("%s%s%s %s", e.color, e.icon, colorReset, message))
 }
 
 func parseSize(sizeStr string) float64 {
@@ -269,19 +315,28 @@ func parseSize(sizeStr string) float64 {
 
 const scannerBufSize = 256 * 1024
 
-func runYTDLPWithProgress(ytdlpPath, ffmpegDir, description string, args ...string) {
-	args = append(args, "--newline", "--progress")
+// runYTDLPWithProgress runs yt-dlp, rendering its download progress and
+// post-processing steps. A non-zero exit from yt-dlp is returned as an error.
+// The options end with "--"; the URL itself comes from --load-info-json.
+func runYTDLPWithProgress(j *job, ytdlpPath, ffmpegDir, description string, args ...string) error {
+	args = append(args, "--newline", "--progress", "--")
 	debugLog("Launching yt-dlp: %s %s", ytdlpPath, strings.Join(args, " "))
 
-	cmd := exec.Command(ytdlpPath, args...)
+	cmd := newCommand(ytdlpPath, args...)
 	cmd.Env = append(os.Environ(),
 		"PATH="+ffmpegDir+string(filepath.ListSeparator)+os.Getenv("PATH"))
 
 	stdout, err := cmd.StdoutPipe()
-	check(err)
+	if err != nil {
+		return err
+	}
 	stderr, err := cmd.StderrPipe()
-	check(err)
-	check(cmd.Start())
+	if err != nil {
+		return err
+	}
+	if err := startCommand(cmd); err != nil {
+		return classify(classDependency, fmt.Errorf("starting yt-dlp: %w", err))
+	}
 	debugLog("yt-dlp PID=%d started", cmd.Process.Pid)
 
 	scanner := bufio.NewScanner(io.MultiReader(stdout, stderr))
@@ -291,6 +346,7 @@ func runYTDLPWithProgress(ytdlpPath, ffmpegDir, description string, args ...stri
 		progressBar *ProgressBar
 		totalSize   float64
 		linesRead   int
+		lastError   string
 	)
 
 	for scanner.Scan() {
@@ -304,17 +360,22 @@ func runYTDLPWithProgress(ytdlpPath, ffmpegDir, description string, args ...stri
 					progressBar.Complete()
 					progressBar = nil
 				}
-				printStatus("info", "Merging video and audio streams...")
+				j.status("info", "Merging video and audio streams...")
+				emit(j, evPostprocess, map[string]any{"step": "merge"})
 			} else if strings.Contains(line, "Extracting audio") {
-				printStatus("info", "Extracting and converting to MP3...")
+				j.status("info", "Extracting and converting to MP3...")
+				emit(j, evPostprocess, map[string]any{"step": "extract_audio"})
 			} else if strings.Contains(line, "[EmbedThumbnail]") {
-				printStatus("info", "Embedding thumbnail via yt-dlp...")
+				j.status("info", "Embedding thumbnail via yt-dlp...")
+				emit(j, evPostprocess, map[string]any{"step": "embed_thumbnail"})
 			} else if strings.Contains(line, "[Metadata]") {
-				printStatus("info", "Writing metadata tags...")
+				j.status("info", "Writing metadata tags...")
+				emit(j, evPostprocess, map[string]any{"step": "metadata"})
 			} else if strings.Contains(line, "ERROR") {
-				printStatus("error", strings.TrimSpace(line))
+				lastError = line
+				j.status("error", strings.TrimSpace(line))
 			} else if strings.Contains(line, "WARNING") {
-				printStatus("warning", strings.TrimSpace(line))
+				j.status("warning", strings.TrimSpace(line))
 			}
 			continue
 		}
@@ -324,7 +385,7 @@ func runYTDLPWithProgress(ytdlpPath, ffmpegDir, description string, args ...stri
 				totalSize = parseSize(m[1])
 				if totalSize > 0 {
 					const mib = 1024 * 1024
-					printStatus("info", fmt.Sprintf("File size: %s%.2f MB%s", colorCyan, totalSize/mib, colorReset))
+					j.status("info", fmt.Sprintf("File size: %s%.2f MB%s", colorCyan, totalSize/mib, colorReset))
 				}
 			}
 		}
@@ -336,11 +397,12 @@ func runYTDLPWithProgress(ytdlpPath, ffmpegDir, description string, args ...stri
 				progressBar = nil
 			}
 			filename := strings.TrimSpace(strings.TrimPrefix(line, "[download] Destination:"))
-			printStatus("info", "Saving to: "+filename)
+			j.status("info", "Saving to: "+filename)
+			emit(j, evDestination, map[string]any{"path": filename})
 			debugLog("Destination file: %s", filename)
 
 		case strings.Contains(line, "has already been downloaded"):
-			printStatus("warning", "File already exists, skipping download.")
+			j.status("warning", "File already exists, skipping download.")
 
 		default:
 			if m := reProgressFull.FindStringSubmatch(line); len(m) >= 3 {
@@ -349,9 +411,10 @@ func runYTDLPWithProgress(ytdlpPath, ffmpegDir, description string, args ...stri
 				if total > 0 {
 					totalSize = total
 					if progressBar == nil {
-						progressBar = NewProgressBar(description, 40)
+						progressBar = NewProgressBar(j.prefix()+description, 40)
 					}
 					progressBar.Update(total*(pct/100), total)
+					emitProgress(j, line, total*(pct/100), total, pct)
 					if pct >= 100 {
 						progressBar.Complete()
 						progressBar = nil
@@ -360,9 +423,10 @@ func runYTDLPWithProgress(ytdlpPath, ffmpegDir, description string, args ...stri
 			} else if m := reProgressPct.FindStringSubmatch(line); len(m) >= 2 && totalSize > 0 {
 				pct, _ := strconv.ParseFloat(m[1], 64)
 				if progressBar == nil {
-					progressBar = NewProgressBar(description, 40)
+					progressBar = NewProgressBar(j.prefix()+description, 40)
 				}
 				progressBar.Update(totalSize*(pct/100), totalSize)
+				emitProgress(j, line, totalSize*(pct/100), totalSize, pct)
 				if pct >= 100 {
 					progressBar.Complete()
 					progressBar = nil
@@ -375,292 +439,436 @@ func runYTDLPWithProgress(ytdlpPath, ffmpegDir, description string, args ...stri
 	if progressBar != nil {
 		progressBar.Complete()
 	}
-	if err := cmd.Wait(); err != nil {
-		fmt.Fprintf(os.Stderr, "%s✗ Download failed:%s %v\n", colorRed, colorReset, err)
+	if err := waitCommand(cmd); err != nil {
 		debugLog("yt-dlp exited with error: %v", err)
-		os.Exit(1)
+		if errors.Is(err, errCancelled) {
+			return err
+		}
+		return ytdlpError(lastError, fmt.Errorf("download failed: %w", err))
 	}
 	debugLog("yt-dlp exited cleanly")
-}
-
-func embedThumbnail(ffmpegPath, mp3File, thumbFile string) {
-	printStatus("info", "Cropping thumbnail to square and embedding...")
-	debugLog("embedThumbnail: mp3=%s thumb=%s ffmpeg=%s", mp3File, thumbFile, ffmpegPath)
-
-	spinner := NewSpinner("Embedding album art (500×500)...")
-	spinner.Start()
-
-	tempFile := mp3File + ".temp"
-	cmd := exec.Command(ffmpegPath,
-		"-i", mp3File,
-		"-i", thumbFile,
-		"-map", "0:0",
-		"-map", "1:0",
-		"-c:a", "copy",
-		"-c:v", "mjpeg",
-		"-vf", "crop=min(iw\\,ih):min(iw\\,ih),scale=500:500",
-		"-q:v", "2",
-		"-id3v2_version", "3",
-		"-metadata:s:v", "title=Album cover",
-		"-metadata:s:v", "comment=Cover (front)",
-		"-y",
-		"-loglevel", "error",
-		"-f", "mp3",
-		tempFile)
-
-	err := cmd.Run()
-	spinner.Stop(err == nil)
-	if err != nil {
-		debugLog("embedThumbnail ffmpeg error: %v", err)
-	}
-	check(err)
-	debugLog("embedThumbnail: replacing %s with temp file", mp3File)
-	check(os.Rename(tempFile, mp3File))
-	printStatus("success", "Album art embedded successfully")
-}
-
-func copyFile(src, dst string) {
-	debugLog("copyFile: %s → %s", src, dst)
-	in, err := os.Open(src)
-	check(err)
-	defer in.Close()
-	out, err := os.Create(dst)
-	check(err)
-	defer out.Close()
-	_, err = io.Copy(out, in)
-	check(err)
-}
-
-func moveFile(src, dst string) {
-	debugLog("moveFile: %s → %s", src, dst)
-	if err := os.Rename(src, dst); err != nil {
-		debugLog("os.Rename failed (%v); falling back to copy+delete", err)
-		copyFile(src, dst)
-		os.Remove(src)
-	}
+	return nil
 }
 
 // ─── Download Commands ────────────────────────────────────────────────────────
 
-func audioDownload(ytdlpPath, ffmpegPath, workDir, url string) {
-	printBanner()
-	printStatus("info", fmt.Sprintf("URL: %s%s%s", colorBlue, url, colorReset))
-	printStatus("info", fmt.Sprintf("Work dir: %s%s%s", colorDim, workDir, colorReset))
-	debugLog("audioDownload called: url=%s workDir=%s", url, workDir)
-
-	spinner := NewSpinner("Fetching video information...")
-	spinner.Start()
-	time.Sleep(500 * time.Millisecond)
-	spinner.Stop(true)
+func audioDownload(ytdlpPath, ffmpegPath string, j *job) (string, error) {
+	j.status("info", fmt.Sprintf("URL: %s%s%s", colorBlue, j.url, colorReset))
+	j.status("info", fmt.Sprintf("Work dir: %s%s%s", colorDim, j.workDir, colorReset))
+	debugLog("audioDownload called: url=%s workDir=%s", j.url, j.workDir)
+	if err := checkArchive(j, "audio"); err != nil {
+		return "", err
+	}
+	if err := fetchMetadata(ytdlpPath, j); err != nil {
+		return "", err
+	}
+	emitMetadata(j, "audio")
+	showMetadata(j, true)
 
-	printStatus("info", "Mode: audio (MP3 + metadata + cover art)")
-	printStatus("info", "Starting audio download...")
-	fmt.Println()
+	j.status("info", fmt.Sprintf("Mode: audio (%s + metadata + cover art)", strings.ToUpper(opts.encoding.format)))
+	j.status("info", fmt.Sprintf("Encoding: %s", opts.encoding.describe()))
+	if j.track > 0 {
+		j.status("info", fmt.Sprintf("Track %d/%d of %s%s%s", j.track, j.trackTotal, colorBold, j.album, colorReset))
+	}
+	if opts.dryRun {
+		path, err := planOutput(j, predictAudioExt(j))
+		if err != nil {
+			return "", err
+		}
+		reportPlan(j, dryRunPlan{mode: "audio", format: "bestaudio", label: opts.encoding.describe(), path: path, tags: plannedTags(j)})
+		return path, nil
+	}
+	if err := checkConflict(j, predictAudioExt(j)); err != nil {
+		return "", err
+	}
+	j.status("info", "Starting audio download...")
+	term.println("")
 
 	ffmpegDir := filepath.Dir(ffmpegPath)
 	debugLog("ffmpegDir resolved to: %s", ffmpegDir)
 
-	runYTDLPWithProgress(ytdlpPath, ffmpegDir, "Downloading audio",
-		url,
+	args := []string{
+		"--load-info-json", j.infoFile,
+		"--no-playlist",
 		"-f", "bestaudio",
 		"--extract-audio",
-		"--audio-format", "mp3",
-		"--convert-thumbnails", "jpg",
-		"--embed-metadata",
+	}
+	args = append(args, opts.encoding.ytdlpArgs()...)
+	args = append(args,
 		"--embed-chapters",
-		"--add-metadata",
-		"-o", filepath.Join(workDir, "%(title)s.%(ext)s"),
-		"--write-thumbnail")
-
-	mp3Files, err := filepath.Glob(filepath.Join(workDir, "*.mp3"))
-	check(err)
-	debugLog("MP3 glob found %d file(s): %v", len(mp3Files), mp3Files)
-
-	if len(mp3Files) == 0 {
-		printStatus("error", "No MP3 file found in work directory")
-		debugLog("workDir contents follow")
-		if entries, e := os.ReadDir(workDir); e == nil {
-			for _, entry := range entries {
-				debugLog("  %s", entry.Name())
-			}
-		}
-		os.Exit(1)
+		"-o", filepath.Join(j.workDir, "%(title)s.%(ext)s"))
+	if opts.coverFile == "" {
+		args = append(args, "--write-thumbnail", "--convert-thumbnails", "jpg")
+	}
+	err := runYTDLPWithProgress(j, ytdlpPath, ffmpegDir, "Downloading audio", args...)
+	if err != nil {
+		return "", err
 	}
 
-	mp3File := mp3Files[0]
-	printStatus("info", fmt.Sprintf("Audio file: %s%s%s", colorBold, filepath.Base(mp3File), colorReset))
+	audioFile, err := findAudioFile(j.workDir, opts.encoding.format)
+	if err != nil {
+		return "", err
+	}
+	format := audioFormatForFile(audioFile)
+	debugLog("Audio file found: %s (format %s)", audioFile, format.name)
+	j.status("info", fmt.Sprintf("Audio file: %s%s%s", colorBold, filepath.Base(audioFile), colorReset))
 
-	if thumbFiles, _ := filepath.Glob(filepath.Join(workDir, "*.jpg")); len(thumbFiles) > 0 {
+	tags := buildTags(j)
+	matchTags(j, tags, true)
+	if opts.coverFile != "" {
+		if err := embedCover(j, ffmpegPath, audioFile, format, opts.coverFile, tags); err != nil {
+			return "", err
+		}
+	} else if thumbFiles, _ := filepath.Glob(filepath.Join(j.workDir, "*.jpg")); len(thumbFiles) > 0 {
 		debugLog("Thumbnail found: %s", thumbFiles[0])
-		embedThumbnail(ffmpegPath, mp3File, thumbFiles[0])
+		if err := embedCover(j, ffmpegPath, audioFile, format, thumbFiles[0], tags); err != nil {
+			return "", err
+		}
 		os.Remove(thumbFiles[0])
 		debugLog("Thumbnail removed after embedding")
 	} else {
-		printStatus("warning", "No thumbnail found; skipping cover art embedding")
+		j.status("warning", "No thumbnail found; skipping cover art embedding")
 		debugLog("No *.jpg files in workDir")
+		if err := writeTags(j, ffmpegPath, audioFile, format, tags); err != nil {
+			return "", err
+		}
 	}
 
-	dest := filepath.Base(mp3File)
-	printStatus("info", fmt.Sprintf("Moving file to current directory: %s", dest))
-	moveFile(mp3File, dest)
+	dest, err := placeOutput(j, audioFile)
+	if err != nil {
+		return "", err
+	}
 
 	fi, err := os.Stat(dest)
 	if err == nil {
 		const mib = 1024 * 1024
-		printStatus("info", fmt.Sprintf("Final file size: %s%.2f MB%s", colorCyan, float64(fi.Size())/mib, colorReset))
+		j.status("info", fmt.Sprintf("Final file size: %s%.2f MB%s", colorCyan, float64(fi.Size())/mib, colorReset))
 	}
 
-	fmt.Println()
-	printStatus("success", fmt.Sprintf("✨ Successfully downloaded: %s%s%s", colorBold, dest, colorReset))
+	term.println("")
+	j.status("success", fmt.Sprintf("✨ Successfully downloaded: %s%s%s", colorBold, dest, colorReset))
 	debugLog("audioDownload finished: output=%s", dest)
+	recordArchive(j, "audio", format.name, dest)
+	return dest, nil
 }
 
-func videoDownload(ytdlpPath, ffmpegPath, workDir, url string) {
-	printBanner()
-	printStatus("info", fmt.Sprintf("URL: %s%s%s", colorBlue, url, colorReset))
-	printStatus("info", fmt.Sprintf("Work dir: %s%s%s", colorDim, workDir, colorReset))
-	debugLog("videoDownload called: url=%s workDir=%s", url, workDir)
-
-	presets := []struct{ label, format string }{
-		{"Best Quality (Auto)", "bestvideo+bestaudio/best"},
-		{"1080p", "bestvideo[height<=1080]+bestaudio/best[height<=1080]"},
-		{"720p", "bestvideo[height<=720]+bestaudio/best[height<=720]"},
-		{"480p", "bestvideo[height<=480]+bestaudio/best[height<=480]"},
-		{"360p", "bestvideo[height<=360]+bestaudio/best[height<=360]"},
-		{"Custom Format (Advanced)", ""},
-	}
-
-	fmt.Printf("%s┌─ Quality Presets ───────────────────────────┐%s\n", colorYellow, colorReset)
-	for i, p := range presets {
-		fmt.Printf("%s│%s %s%d.%s %-40s %s│%s\n",
-			colorYellow, colorReset,
-			colorGreen, i+1, colorReset,
-			p.label,
-			colorYellow, colorReset)
+func videoDownload(ytdlpPath, ffmpegPath string, j *job) (string, error) {
+	j.status("info", fmt.Sprintf("URL: %s%s%s", colorBlue, j.url, colorReset))
+	j.status("info", fmt.Sprintf("Work dir: %s%s%s", colorDim, j.workDir, colorReset))
+	debugLog("videoDownload called: url=%s workDir=%s", j.url, j.workDir)
+	if err := checkArchive(j, "video"); err != nil {
+		return "", err
 	}
-	fmt.Printf("%s└─────────────────────────────────────────────┘%s\n\n", colorYellow, colorReset)
-
-	fmt.Printf("%sChoose quality (1-%d):%s ", colorCyan, len(presets), colorReset)
-	var choice int
-	fmt.Scanln(&choice)
-	fmt.Println()
-	debugLog("User selected quality preset: %d", choice)
+	if err := fetchMetadata(ytdlpPath, j); err != nil {
+		return "", err
+	}
+	emitMetadata(j, "video")
+	showMetadata(j, false)
 
 	ffmpegDir := filepath.Dir(ffmpegPath)
 	debugLog("ffmpegDir resolved to: %s", ffmpegDir)
-	var format string
 
-	switch {
-	case choice > 0 && choice < len(presets):
-		format = presets[choice-1].format
-		printStatus("info", fmt.Sprintf("Selected quality: %s%s%s", colorBold, presets[choice-1].label, colorReset))
-		debugLog("Format string: %s", format)
-	case choice == len(presets):
-		printStatus("info", "Fetching available formats from server...")
-		spinner := NewSpinner("Fetching available formats...")
-		spinner.Start()
-		cmd := exec.Command(ytdlpPath, "-F", url)
-		cmd.Env = append(os.Environ(),
-			"PATH="+ffmpegDir+string(filepath.ListSeparator)+os.Getenv("PATH"))
-		output, err := cmd.CombinedOutput()
-		spinner.Stop(err == nil)
+	format, label, ok := videoFormatFromFlags()
+	var err error
+	if ok {
+		err = checkFormatIDs(j, format)
+	} else {
+		format, label, err = promptVideoFormat(j)
+	}
+	if err != nil {
+		return "", err
+	}
+	j.status("info", fmt.Sprintf("Selected quality: %s%s%s", colorBold, label, colorReset))
+	debugLog("Format string: %s", format)
+	ext := predictVideoExt(j, format)
+	debugLog("Predicted container: %s", ext)
+	if opts.dryRun {
+		path, err := planOutput(j, ext)
 		if err != nil {
-			debugLog("-F command failed: %v", err)
+			return "", err
 		}
-		if err == nil {
-			fmt.Println(string(output))
-		}
-		fmt.Printf("\n%sEnter format ID or combination (e.g., 137+140):%s ", colorCyan, colorReset)
-		fmt.Scanln(&format)
-		fmt.Println()
-		debugLog("Custom format entered: %s", format)
-	default:
-		printStatus("warning", fmt.Sprintf("Invalid choice %d — falling back to best quality", choice))
-		format = "bestvideo+bestaudio/best"
-		debugLog("Invalid choice %d, defaulting to: %s", choice, format)
+		reportPlan(j, dryRunPlan{mode: "video", format: format, label: label, path: path})
+		return path, nil
+	}
+	if err := checkConflict(j, ext); err != nil {
+		return "", err
 	}
 
-	printStatus("info", "Starting video download...")
-	fmt.Println()
+	j.status("info", "Starting video download...")
+	term.println("")
 
-	runYTDLPWithProgress(ytdlpPath, ffmpegDir, "Downloading video",
+	err = runYTDLPWithProgress(j, ytdlpPath, ffmpegDir, "Downloading video",
+		"--no-playlist",
 		"-f", format,
-		"-o", filepath.Join(workDir, "%(title)s.%(ext)s"),
-		url)
-
-	if mp4Files, _ := filepath.Glob(filepath.Join(workDir, "*.mp4")); len(mp4Files) > 0 {
-		debugLog("MP4 file found: %s", mp4Files[0])
-		dest := filepath.Base(mp4Files[0])
-		printStatus("info", fmt.Sprintf("Moving file to current directory: %s", dest))
-		moveFile(mp4Files[0], dest)
-
-		fi, err := os.Stat(dest)
-		if err == nil {
-			const mib = 1024 * 1024
-			printStatus("info", fmt.Sprintf("Final file size: %s%.2f MB%s", colorCyan, float64(fi.Size())/mib, colorReset))
-		}
+		"--merge-output-format", mergeOutputFormats,
+		"-o", filepath.Join(j.workDir, "%(title)s.%(ext)s"),
+		"--load-info-json", j.infoFile)
+	if err != nil {
+		return "", err
+	}
 
-		fmt.Println()
-		printStatus("success", fmt.Sprintf("✨ Successfully downloaded: %s%s%s", colorBold, dest, colorReset))
-		debugLog("videoDownload finished: output=%s", dest)
-	} else {
-		printStatus("warning", "No MP4 file found. The video may have been saved with a different extension.")
-		debugLog("No *.mp4 found in workDir; listing workDir contents")
-		if entries, e := os.ReadDir(workDir); e == nil {
+	videoFile, ok := findVideoFile(j.workDir, ext)
+	if !ok {
+		j.status("warning", "No video file found in the work directory.")
+		debugLog("No video file found in workDir; listing workDir contents")
+		if entries, e := os.ReadDir(j.workDir); e == nil {
 			for _, entry := range entries {
 				debugLog("  %s", entry.Name())
-				printStatus("info", fmt.Sprintf("Found file: %s", entry.Name()))
+				j.status("info", fmt.Sprintf("Found file: %s", entry.Name()))
 			}
 		}
+		return "", classify(classPostprocess, fmt.Errorf("no video file found in work directory"))
+	}
+
+	debugLog("Video file found: %s", videoFile)
+	dest, err := placeOutput(j, videoFile)
+	if err != nil {
+		return "", err
+	}
+
+	fi, err := os.Stat(dest)
+	if err == nil {
+		const mib = 1024 * 1024
+		j.status("info", fmt.Sprintf("Final file size: %s%.2f MB%s", colorCyan, float64(fi.Size())/mib, colorReset))
 	}
+
+	term.println("")
+	j.status("success", fmt.Sprintf("✨ Successfully downloaded: %s%s%s", colorBold, dest, colorReset))
+	debugLog("videoDownload finished: output=%s", dest)
+	recordArchive(j, "video", format, dest)
+	return dest, nil
+}
+
+// promptVideoFormat shows the quality menu. The last entry opens the format
+// picker, built from the formats the server actually offers.
+func promptVideoFormat(j *job) (format, label string, err error) {
+	custom := len(videoPresets) + 1
+
+	var choice int
+	term.hold(func() {
+		w := promptWriter()
+		fmt.Fprintf(w, "%s┌─ Quality Presets ───────────────────────────┐%s\n", colorYellow, colorReset)
+		for i, p := range videoPresets {
+			fmt.Fprintf(w, "%s│%s %s%d.%s %-40s %s│%s\n",
+				colorYellow, colorReset,
+				colorGreen, i+1, colorReset,
+				p.label,
+				colorYellow, colorReset)
+		}
+		fmt.Fprintf(w, "%s│%s %s%d.%s %-40s %s│%s\n",
+			colorYellow, colorReset,
+			colorGreen, custom, colorReset,
+			"Custom Format (Advanced)",
+			colorYellow, colorReset)
+		fmt.Fprintf(w, "%s└─────────────────────────────────────────────┘%s\n\n", colorYellow, colorReset)
+
+		fmt.Fprintf(w, "%s%sChoose quality (1-%d):%s ", j.prefix(), colorCyan, custom, colorReset)
+		fmt.Scanln(&choice)
+		fmt.Fprintln(w)
+	})
+	debugLog("User selected quality preset: %d", choice)
+
+	switch {
+	case choice > 0 && choice < custom:
+		p := videoPresets[choice-1]
+		return buildVideoFormat(p.maxHeight, ""), p.label, nil
+	case choice == custom:
+		term.hold(func() {
+			format, err = pickFormatSpec(j, j.formats)
+			fmt.Fprintln(promptWriter())
+		})
+		debugLog("Custom format built: %s", format)
+		return format, "custom format " + format, err
+	}
+
+	fallback, _ := findVideoPreset(opts.defaultQuality)
+	j.status("warning", fmt.Sprintf("Invalid choice %d — falling back to %s", choice, fallback.label))
+	return buildVideoFormat(fallback.maxHeight, ""), fallback.label, nil
 }
 
 // ─── Entry Point ──────────────────────────────────────────────────────────────
 
 func main() {
-	// Strip --debug / --verbose early so other arg parsing is not affected.
-	args := make([]string, 0, len(os.Args))
-	for _, a := range os.Args {
-		if a == "--debug" || a == "--verbose" {
-			debugMode = true
-		} else {
-			args = append(args, a)
+	os.Exit(run())
+}
+
+// run dispatches to a command and returns the process exit code so that
+// cleanup executes before main calls os.Exit. Without a command name the
+// original flag-only form (-m / -v) applies.
+func run() int {
+	defer runCleanups()
+	handleInterrupts()
+
+	args := os.Args[1:]
+	if len(args) > 0 {
+		if cmd := findCommand(args[0]); cmd != nil {
+			return cmd.run(cmd, args[1:])
+		}
+		if !strings.HasPrefix(args[0], "-") && !strings.ContainsAny(args[0], ".:/") {
+			printStatus("error", fmt.Sprintf("Unknown command %q (see streamline --help)", args[0]))
+			return exitUsage
 		}
 	}
+	return runDownload(nil, args)
+}
 
-	if debugMode {
-		printStatus("info", fmt.Sprintf("%sDebug mode enabled – verbose output is ON%s", colorYellow, colorReset))
-		debugLog("Streamline starting up (GOOS=%s GOARCH=%s)", runtime.GOOS, runtime.GOARCH)
-		debugLog("Args (after flag strip): %v", args[1:])
+// runDownload implements the audio and video commands, and the command-less
+// form where -m, -v or the config file's mode decides.
+func runDownload(cmd *command, args []string) int {
+	name, groups := "streamline", legacyFlags
+	if cmd != nil {
+		name, groups = "streamline "+cmd.name, cmd.flags
+	}
+	fs, cli := newFlagSet(name, groups, &opts)
+	if cmd != nil {
+		fs.Usage = func() { commandUsage(cmd, fs) }
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if err := loadSettings(fs, cli); err != nil {
+		printStatus("error", err.Error())
+		return exitUsage
 	}
 
-	if len(args) == 2 && args[1] == "--about" {
+	if *cli.about {
 		fmt.Printf("\n%s%s%s\n", colorCyan, authorTag, colorReset)
 		fmt.Printf("\n%sGitHub:%s %shttps://github.com/shahil-sk/streamline%s\n\n",
 			colorYellow, colorReset, colorBlue, colorReset)
-		os.Exit(0)
+		return exitOK
+	}
+
+	if err := validateDownloadOptions(cli); err != nil {
+		printStatus("error", err.Error())
+		return exitUsage
 	}
-	if len(args) < 3 {
+
+	mode := ""
+	switch {
+	case cmd != nil:
+		mode = cmd.name
+	case *cli.audioMode && !*cli.videoMode:
+		mode = "audio"
+	case *cli.videoMode && !*cli.audioMode:
+		mode = "video"
+	}
+	var download downloadFunc
+	switch mode {
+	case "audio":
+		download = audioDownload
+	case "video":
+		download = videoDownload
+	default:
 		usage()
+		return exitUsage
 	}
 
-	ytdlpPath, ffmpegPath, cleanup := resolveBinaries()
-	defer cleanup()
+	urls, err := collectURLs(positional, *cli.input)
+	if err != nil {
+		printStatus("error", err.Error())
+		return classOf(err).exitCode()
+	}
+	if len(urls) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	debugLog("%d URL(s) queued", len(urls))
 
-	workDir, err := os.MkdirTemp("", "streamline-work")
-	check(err)
-	debugLog("Temporary work directory created: %s", workDir)
-	defer func() {
-		debugLog("Cleaning up work directory: %s", workDir)
-		os.RemoveAll(workDir)
-	}()
+	ytdlpPath, ffmpegPath, workDir, code, ok := startDownloads(cli)
+	if !ok {
+		return code
+	}
 
-	switch args[1] {
-	case "-m":
-		audioDownload(ytdlpPath, ffmpegPath, workDir, args[2])
-	case "-v":
-		videoDownload(ytdlpPath, ffmpegPath, workDir, args[2])
-	default:
-		usage()
+	jobs, results := planJobs(ytdlpPath, urls)
+	results = append(results, runBatch(jobs, *cli.workers, download, ytdlpPath, ffmpegPath, workDir)...)
+	printSummary(results)
+	if cancelled() {
+		return exitCancelled
 	}
+	return batchExitCode(results)
+}
+
+// loadSettings applies the config file under the flags already parsed into
+// fs, then turns on --debug.
+func loadSettings(fs *flag.FlagSet, cli *cliFlags) error {
+	cfg, err := loadConfig(*cli.configPath)
+	if err != nil {
+		return fmt.Errorf("Reading config: %v", err)
+	}
+	if _, err := applyConfig(fs, cfg, *cli.profile); err != nil {
+		return err
+	}
+	enableDebug(cli)
+	return nil
+}
+
+// validateDownloadOptions checks the settings shared by the download
+// commands and serve, resolving them into opts.
+func validateDownloadOptions(cli *cliFlags) error {
+	if err := parseOutputFormat(*cli.outFormat); err != nil {
+		return err
+	}
+	if jsonOutput {
+		term.setQuiet()
+	}
+	if *cli.workers < 1 {
+		return errors.New("--jobs must be at least 1")
+	}
+	for _, validate := range []func() error{
+		validateConflictPolicy,
+		func() error { return validateOutputTemplate(opts.output) },
+		validateAudioOptions,
+		validateTitleOptions,
+		validateMatchOptions,
+		validateVideoOptions,
+		validateCoverOptions,
+	} {
+		if err := validate(); err != nil {
+			return err
+		}
+	}
+	if opts.id3Version != 3 && opts.id3Version != 4 {
+		return errors.New("--id3-version must be 3 or 4")
+	}
+	return nil
+}
+
+// startDownloads opens the download archive, finds yt-dlp and ffmpeg and
+// creates the temporary work directory, all removed again on exit. ok is
+// false when the caller should return code.
+func startDownloads(cli *cliFlags) (ytdlpPath, ffmpegPath, workDir string, code int, ok bool) {
+	var err error
+	if !*cli.noArchive {
+		if *cli.archivePath == "" {
+			if *cli.archivePath, err = defaultArchivePath(); err != nil {
+				printStatus("error", err.Error())
+				return "", "", "", exitFilesystem, false
+			}
+		}
+		if archive, err = openArchive(*cli.archivePath); err != nil {
+			printStatus("error", fmt.Sprintf("Opening download archive: %v", err))
+			return "", "", "", exitFilesystem, false
+		}
+	}
+
+	printBanner()
+	ytdlpPath, ffmpegPath, cleanup, err := resolveBinaries()
+	atCleanup(cleanup)
+	if err != nil {
+		printStatus("error", err.Error())
+		return "", "", "", classOf(err).exitCode(), false
+	}
+
+	workDir, err = os.MkdirTemp("", "streamline-work")
+	if err != nil {
+		printStatus("error", err.Error())
+		return "", "", "", exitFilesystem, false
+	}
+	debugLog("Temporary work directory created: %s", workDir)
+	atCleanup(func() { os.RemoveAll(workDir) })
+	return ytdlpPath, ffmpegPath, workDir, exitOK, true
 }
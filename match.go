@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ─── Metadata Matching ────────────────────────────────────────────────────────
+
+// Matches scoring at least --match-threshold retag the file. Below that,
+// down to matchFloor under it, candidates are offered for confirmation; a
+// runner-up within matchMargin of a different release also needs asking.
+const (
+	defaultMatchThreshold = 0.85
+	matchFloor            = 0.25
+	matchMargin           = 0.05
+	matchListSize         = 5
+)
+
+// trackQuery is what streamline knows about a downloaded track.
+type trackQuery struct {
+	artist, title string
+	duration      float64 // seconds; 0 when unknown
+}
+
+// trackMatch is a track on a release, as a provider found it.
+type trackMatch struct {
+	id                 string // the provider's ID for the recording or release
+	title, artist      string
+	albumArtist, album string
+	track, trackTotal  int
+	disc, discTotal    int
+	date               string  // "2011" or "2011-03-04"
+	duration           float64 // seconds; 0 when unknown
+	score              float64 // confidence 0–1, set by rankMatches
+}
+
+// metadataProvider looks tracks up in a metadata database. Providers read a
+// local dump or talk to a service on the local network, so matching never
+// depends on a public API being reachable.
+type metadataProvider interface {
+	name() string
+	search(q trackQuery) ([]trackMatch, error)
+}
+
+// validateMatchOptions checks --match-threshold and opens the
+// --metadata-source provider into opts.provider.
+func validateMatchOptions() error {
+	if opts.matchThreshold <= 0 || opts.matchThreshold > 1 {
+		return errors.New("--match-threshold must be above 0 and at most 1")
+	}
+	opts.provider = nil
+	if opts.metadataSource == "" {
+		return nil
+	}
+	p, err := newMetadataProvider(opts.metadataSource)
+	if err != nil {
+		return fmt.Errorf("--metadata-source: %w", err)
+	}
+	debugLog("Metadata provider: %s", p.name())
+	opts.provider = p
+	return nil
+}
+
+// newMetadataProvider picks the provider for source: an http(s) URL is a
+// service speaking the MusicBrainz web service API, anything else a dump
+// file whose format is told from its first byte.
+func newMetadataProvider(source string) (metadataProvider, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return newMusicBrainzServer(source), nil
+	}
+	r, err := openDump(source)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	first, err := r.firstByte()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", source, err)
+	}
+	switch first {
+	case '{':
+		return &musicBrainzDump{path: source}, nil
+	case '<':
+		return &discogsDump{path: source}, nil
+	}
+	return nil, fmt.Errorf("%s is neither a MusicBrainz JSON dump nor a Discogs XML dump", source)
+}
+
+// matchTags looks the track up with the --metadata-source provider and, on
+// a confident match, rewrites tags in place. Ambiguous results are offered
+// for confirmation when interactive and stdin can answer; otherwise they
+// are listed and the tags are left alone. Lookup errors only warn.
+func matchTags(j *job, tags *audioTags, interactive bool) {
+	if opts.provider == nil {
+		return
+	}
+	q := trackQuery{artist: tags.artist, title: tags.title, duration: infoNumber(j.info, "duration")}
+	if longestWord(q.title) == "" {
+		// Nothing to search by: every candidate would match equally.
+		j.status("info", fmt.Sprintf("Title %q has no words to look up; keeping the current tags", q.title))
+		emit(j, evPostprocess, map[string]any{"step": "match", "matched": false})
+		return
+	}
+	start := time.Now()
+	found, err := opts.provider.search(q)
+	debugLog("matchTags: %s found %d candidate(s) for %+v in %s", opts.provider.name(), len(found), q, time.Since(start).Round(time.Millisecond))
+	if err != nil {
+		j.status("warning", fmt.Sprintf("Metadata lookup failed: %v", err))
+		emit(j, evPostprocess, map[string]any{"step": "match", "matched": false})
+		return
+	}
+	candidates := rankMatches(q, found)
+
+	var chosen *trackMatch
+	switch {
+	case len(candidates) == 0:
+		j.status("info", fmt.Sprintf("No %s match for %s – %s", opts.provider.name(), q.artist, q.title))
+	case confident(candidates):
+		chosen = &candidates[0]
+	case interactive && stdinIsTerminal():
+		chosen = askMatch(j, candidates)
+	default:
+		j.status("warning", "Metadata match is ambiguous; keeping the current tags. Candidates:")
+		for _, m := range candidates {
+			j.status("warning", "  "+m.String())
+		}
+	}
+
+	fields := map[string]any{"step": "match", "matched": chosen != nil}
+	if chosen != nil {
+		fields["id"], fields["score"] = chosen.id, math.Round(chosen.score*100)/100
+		j.status("success", "Matched "+chosen.String())
+		chosen.apply(tags, opts.provider.name())
+	}
+	emit(j, evPostprocess, fields)
+}
+
+// rankMatches scores candidates against q, best first, dropping those under
+// the floor. Of the releases a recording appears on, the earliest is kept.
+func rankMatches(q trackQuery, found []trackMatch) []trackMatch {
+	var ranked []trackMatch
+	for _, m := range found {
+		if m.score = scoreMatch(q, m); m.score >= opts.matchThreshold-matchFloor {
+			ranked = append(ranked, m)
+		}
+	}
+	sort.SliceStable(ranked, func(a, b int) bool {
+		if ranked[a].score != ranked[b].score {
+			return ranked[a].score > ranked[b].score
+		}
+		return earlierDate(ranked[a].date, ranked[b].date)
+	})
+
+	seen := map[string]bool{}
+	list := ranked[:0]
+	for _, m := range ranked {
+		if key := m.id + "\x00" + m.title; !seen[key] {
+			seen[key] = true
+			list = append(list, m)
+		}
+	}
+	return list[:min(len(list), matchListSize)]
+}
+
+// confident reports whether the best candidate can be used without asking:
+// it clears the threshold and no runner-up from a different release comes
+// close.
+func confident(candidates []trackMatch) bool {
+	best := candidates[0]
+	if best.score < opts.matchThreshold {
+		return false
+	}
+	for _, m := range candidates[1:] {
+		if best.score-m.score < matchMargin && (m.album != best.album || m.artist != best.artist) {
+			return false
+		}
+	}
+	return true
+}
+
+// scoreMatch weighs title, artist and duration similarity. A duration
+// within 2 seconds counts fully, one 20 seconds off not at all; without a
+// duration on both sides the names carry the whole score.
+func scoreMatch(q trackQuery, m trackMatch) float64 {
+	title := similarity(q.title, m.title)
+	artist := max(similarity(q.artist, m.artist), similarity(mainArtist(q.artist), mainArtist(m.artist)))
+	if q.duration <= 0 || m.duration <= 0 {
+		return 0.6*title + 0.4*artist
+	}
+	length := 1 - (math.Abs(q.duration-m.duration)-2)/18
+	return 0.5*title + 0.3*artist + 0.2*math.Max(0, math.Min(1, length))
+}
+
+// mainArtist drops a featuring credit: "A feat. B" is "A".
+func mainArtist(s string) string {
+	lower := strings.ToLower(s)
+	if len(lower) != len(s) {
+		s = lower // case mapping changed the byte offsets
+	}
+	for _, sep := range []string{" feat. ", " ft. ", " featuring "} {
+		if i := strings.Index(lower, sep); i >= 0 {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// similarity is 1 minus the edit distance between the normalised strings
+// over the longer one's length.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(normalizeName(a)), []rune(normalizeName(b))
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for k := range prev {
+		prev[k] = k
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for k := 1; k <= len(rb); k++ {
+			cost := 1
+			if ra[i-1] == rb[k-1] {
+				cost = 0
+			}
+			cur[k] = min(prev[k]+1, cur[k-1]+1, prev[k-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(max(len(ra), len(rb)))
+}
+
+// normalizeName lowercases s, spells out "&" and reduces punctuation to
+// single spaces, so "AC/DC" and "ac dc" compare equal.
+func normalizeName(s string) string {
+	s = strings.ReplaceAll(strings.ToLower(s), "&", " and ")
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// earlierDate orders dates of differing precision, unknown ones last.
+func earlierDate(a, b string) bool {
+	if a == "" || b == "" {
+		return a != ""
+	}
+	return a < b
+}
+
+// askMatch lists the candidates and reads a choice. An empty answer keeps
+// the current tags.
+func askMatch(j *job, candidates []trackMatch) *trackMatch {
+	var chosen *trackMatch
+	term.hold(func() {
+		w := promptWriter()
+		fmt.Fprintf(w, "%sSeveral %s matches:%s\n", colorYellow, opts.provider.name(), colorReset)
+		for i, m := range candidates {
+			fmt.Fprintf(w, "  %d) %s\n", i+1, m.String())
+		}
+		for {
+			fmt.Fprintf(w, "%s%sUse which [1-%d], or Enter to keep the current tags?%s ", j.prefix(), colorCyan, len(candidates), colorReset)
+			answer, err := readLine()
+			if err != nil || strings.TrimSpace(answer) == "" {
+				break
+			}
+			if n, err := strconv.Atoi(strings.TrimSpace(answer)); err == nil && n >= 1 && n <= len(candidates) {
+				chosen = &candidates[n-1]
+				break
+			}
+		}
+		fmt.Fprintln(w)
+	})
+	return chosen
+}
+
+// String renders a candidate for listing: "Artist – Title · Album (2011) 92%".
+func (m trackMatch) String() string {
+	s := m.artist + " – " + m.title
+	if m.album != "" {
+		s += " · " + m.album
+	}
+	if y := year(m.date); y != "" {
+		s += " (" + y + ")"
+	}
+	return fmt.Sprintf("%s %s%.0f%%%s", s, colorDim, m.score*100, colorReset)
+}
+
+// apply copies what the match knows over tags. The upload date stays the
+// original date; the source and confidence are recorded in
+// STREAMLINE_MATCH.
+func (m trackMatch) apply(t *audioTags, source string) {
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&t.title, m.title)
+	set(&t.artist, m.artist)
+	set(&t.albumArtist, m.albumArtist)
+	set(&t.album, m.album)
+	set(&t.date, m.date)
+	if m.track > 0 {
+		t.track, t.trackTotal = m.track, m.trackTotal
+	}
+	if m.disc > 0 {
+		t.disc, t.discTotal = m.disc, m.discTotal
+	}
+	t.custom = append(t.custom, tagField{"STREAMLINE_MATCH", fmt.Sprintf("%s %s (%.0f%%)", source, m.id, m.score*100)})
+}
+
+// dumpFile reads a dump, gunzipping it when the name ends in .gz.
+type dumpFile struct {
+	*bufio.Reader
+	f *os.File
+}
+
+func openDump(path string) (*dumpFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		r = gz
+	}
+	return &dumpFile{bufio.NewReaderSize(r, 1<<20), f}, nil
+}
+
+func (d *dumpFile) Close() error { return d.f.Close() }
+
+// firstByte skips leading white space and returns the next byte unread.
+func (d *dumpFile) firstByte() (byte, error) {
+	for {
+		b, err := d.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		if !unicode.IsSpace(rune(b[0])) {
+			return b[0], nil
+		}
+		d.Discard(1)
+	}
+}
+
+// dumpIndex holds the tracks of a dump by the words of their titles. A dump
+// is read once, on the first lookup of the run; the workers' lookups wait
+// for that and then share the index.
+type dumpIndex struct {
+	once   sync.Once
+	err    error
+	tracks []trackMatch
+	words  map[string][]int // normalised title word → indices into tracks
+}
+
+// load fills the index by calling read, which passes each track of the
+// dump to add. Later calls return the first call's error.
+func (x *dumpIndex) load(name, path string, read func(add func(trackMatch)) error) error {
+	x.once.Do(func() {
+		printStatus("info", fmt.Sprintf("Indexing %s %s (once per run)...", name, path))
+		start := time.Now()
+		x.words = map[string][]int{}
+		x.err = read(func(m trackMatch) {
+			i := len(x.tracks)
+			x.tracks = append(x.tracks, m)
+			seen := map[string]bool{}
+			for _, w := range strings.Fields(normalizeName(m.title)) {
+				if !seen[w] {
+					seen[w] = true
+					x.words[w] = append(x.words[w], i)
+				}
+			}
+		})
+		debugLog("dumpIndex: %s: %d track(s), %d word(s) in %s", path, len(x.tracks), len(x.words), time.Since(start).Round(time.Millisecond))
+	})
+	return x.err
+}
+
+// lookup returns the tracks whose titles have the longest word of q's,
+// usually its rarest. A title without words finds nothing.
+func (x *dumpIndex) lookup(q trackQuery) []trackMatch {
+	var found []trackMatch
+	for _, i := range x.words[longestWord(q.title)] {
+		found = append(found, x.tracks[i])
+	}
+	return found
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testMusicBrainzDump = `{"id":"r1","title":"Back in Black","length":255000,"artist-credit":[{"name":"AC/DC"}],"releases":[{"title":"Back in Black","date":"1980-07-25","status":"Official","media":[{"position":1,"track-count":10,"tracks":[{"number":"6","position":6}]}]},{"title":"Bootleg","status":"Bootleg"}]}
+{"id":"r2","title":"Hells Bells","length":312000,"artist-credit":[{"name":"AC/DC"}],"releases":[]}
+
+{"id":"r3","title":"Black Dog","artist-credit":[{"name":"Led Zeppelin"}]}
+`
+
+const testDiscogsDump = `<releases>
+<release id="1"><artists><artist><name>AC/DC</name></artist></artists><title>Back in Black</title><released>1980-07-25</released>
+<tracklist>
+<track><position>A1</position><title>Hells Bells</title><duration>5:12</duration></track>
+<track><position></position><title>Side B</title></track>
+<track><position>B1</position><title>Back in Black</title><duration>4:15</duration></track>
+</tracklist></release>
+<release id="2"><artists><artist><name>Nirvana (2)</name><join>&amp;</join></artist><artist><name>Guest</name></artist></artists><title>Sessions</title><released>1999-00-00</released>
+<tracklist><track><position>2-5</position><title>Black Swan</title></track></tracklist></release>
+</releases>`
+
+// writeDump writes a dump file, gzipped when name ends in .gz.
+func writeDump(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if strings.HasSuffix(name, ".gz") {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		_, err = gz.Write([]byte(data))
+	} else {
+		_, err = f.Write([]byte(data))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDumpSearch(t *testing.T) {
+	tests := []struct {
+		name, file, data string
+		queries          map[string][]string // title → "id title/album #track"
+	}{
+		{"MusicBrainz", "recordings.json", testMusicBrainzDump, map[string][]string{
+			"Back In Black": {"r1 Back in Black/Back in Black #6", "r3 Black Dog/ #0"},
+			"Hells Bells":   {"r2 Hells Bells/ #0"},
+			"Thunderstruck": nil,
+			"!!!":           nil,
+		}},
+		{"MusicBrainz gzipped", "recordings.json.gz", testMusicBrainzDump, map[string][]string{
+			"Dog": {"r3 Black Dog/ #0"},
+		}},
+		{"Discogs", "releases.xml.gz", testDiscogsDump, map[string][]string{
+			"Hells Bells": {"1 Hells Bells/Back in Black #1"},
+			"BLACK":       {"1 Back in Black/Back in Black #2", "2 Black Swan/Sessions #5"},
+			"Side B":      nil,
+		}},
+	}
+	for _, tt := range tests {
+		path := writeDump(t, tt.file, tt.data)
+		p, err := newMetadataProvider(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for title, want := range tt.queries {
+			found, err := p.search(trackQuery{title: title})
+			if err != nil {
+				t.Fatalf("%s: search(%q): %v", tt.name, title, err)
+			}
+			var got []string
+			for _, m := range found {
+				got = append(got, m.id+" "+m.title+"/"+m.album+" #"+strconv.Itoa(m.track))
+			}
+			sort.Strings(got)
+			if strings.Join(got, "; ") != strings.Join(want, "; ") {
+				t.Errorf("%s: search(%q) = %q, want %q", tt.name, title, got, want)
+			}
+			// Every search after the first is answered from the index.
+			os.Remove(path)
+		}
+	}
+}
+
+func TestDumpSearchError(t *testing.T) {
+	path := writeDump(t, "recordings.json", "{\"id\":\"r1\",\"title\":\"Song\"}\n{not json\n")
+	p, err := newMetadataProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := p.search(trackQuery{title: "Song"}); err == nil || !strings.Contains(err.Error(), "recordings.json:2:") {
+			t.Errorf("search %d: error %v, want one naming line 2", i+1, err)
+		}
+	}
+}
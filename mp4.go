@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// ─── MP4 (M4A) ────────────────────────────────────────────────────────────────
+
+// mp4Box is a box (atom) held in memory: its four-character type and its
+// body, without the size and type header.
+type mp4Box struct {
+	kind string
+	body []byte
+}
+
+// mp4Span is a top-level box located in the file but not read.
+type mp4Span struct {
+	kind        string
+	start, size int64
+}
+
+// Types of an ilst item's data atom.
+const (
+	mp4Binary = 0
+	mp4UTF8   = 1
+	mp4JPEG   = 13
+	mp4PNG    = 14
+)
+
+// mp4Freeform is the namespace of iTunes "----" items.
+const mp4Freeform = "com.apple.iTunes"
+
+// writeMP4Tags rewrites the iTunes metadata list (moov/udta/meta/ilst) of
+// an MP4 file, merging tags into the items already there. Growing moov
+// moves any media data after it, so the chunk offsets in every track's
+// stco or co64 table are shifted to match. Other boxes are copied as-is.
+func writeMP4Tags(r *os.File, w io.Writer, t *audioTags) error {
+	spans, err := scanMP4(r)
+	if err != nil {
+		return err
+	}
+	moovAt := -1
+	for i, s := range spans {
+		switch s.kind {
+		case "moov":
+			moovAt = i
+		case "moof":
+			return errors.New("fragmented MP4 files are not supported")
+		}
+	}
+	if moovAt < 0 {
+		return errors.New("MP4 file has no moov box")
+	}
+	moovSpan := spans[moovAt]
+	raw := make([]byte, moovSpan.size)
+	if _, err := r.ReadAt(raw, moovSpan.start); err != nil {
+		return fmt.Errorf("reading MP4 moov box: %w", err)
+	}
+	_, body, _, err := nextMP4Box(raw)
+	if err != nil {
+		return err
+	}
+	moov, err := parseMP4Boxes(body)
+	if err != nil {
+		return err
+	}
+	if moov, err = setMP4Items(moov, t); err != nil {
+		return err
+	}
+
+	// The new moov's size does not depend on the offsets in it, so
+	// encode once to learn the shift, then patch and encode again.
+	delta := int64(len(appendMP4Box(nil, "moov", encodeMP4Boxes(moov)))) - moovSpan.size
+	debugLog("writeMP4Tags: moov %d → %d bytes", moovSpan.size, moovSpan.size+delta)
+	if delta != 0 {
+		if err := shiftMP4Offsets(moov, moovSpan.start, delta); err != nil {
+			return err
+		}
+	}
+	newMoov := appendMP4Box(nil, "moov", encodeMP4Boxes(moov))
+
+	for _, s := range spans {
+		if s.kind == "moov" {
+			_, err = w.Write(newMoov)
+		} else {
+			_, err = io.Copy(w, io.NewSectionReader(r, s.start, s.size))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanMP4 lists the top-level boxes of r. A size of 1 means a 64-bit size
+// follows the type; 0 means the box runs to the end of the file.
+func scanMP4(r *os.File) ([]mp4Span, error) {
+	fi, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var spans []mp4Span
+	for pos := int64(0); pos < fi.Size(); {
+		var head [16]byte
+		if _, err := r.ReadAt(head[:8], pos); err != nil {
+			return nil, fmt.Errorf("reading MP4 box header: %w", err)
+		}
+		s := mp4Span{kind: string(head[4:8]), start: pos, size: int64(binary.BigEndian.Uint32(head[:]))}
+		switch s.size {
+		case 0:
+			s.size = fi.Size() - pos
+		case 1:
+			if _, err := r.ReadAt(head[8:], pos+8); err != nil {
+				return nil, fmt.Errorf("reading MP4 box header: %w", err)
+			}
+			s.size = int64(binary.BigEndian.Uint64(head[8:]))
+		}
+		if s.size < 8 || s.size > fi.Size()-pos {
+			return nil, fmt.Errorf("bad MP4 box %q at offset %d", s.kind, pos)
+		}
+		spans = append(spans, s)
+		pos += s.size
+	}
+	return spans, nil
+}
+
+// nextMP4Box splits the first box off b.
+func nextMP4Box(b []byte) (kind string, body, rest []byte, err error) {
+	if len(b) < 8 {
+		return "", nil, nil, errors.New("truncated MP4 box")
+	}
+	size, header := uint64(binary.BigEndian.Uint32(b)), uint64(8)
+	switch size {
+	case 0:
+		size = uint64(len(b))
+	case 1:
+		if len(b) < 16 {
+			return "", nil, nil, errors.New("truncated MP4 box")
+		}
+		size, header = binary.BigEndian.Uint64(b[8:]), 16
+	}
+	if size < header || size > uint64(len(b)) {
+		return "", nil, nil, fmt.Errorf("bad MP4 box %q", b[4:8])
+	}
+	return string(b[4:8]), b[header:size], b[size:], nil
+}
+
+func parseMP4Boxes(b []byte) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for len(b) > 0 {
+		kind, body, rest, err := nextMP4Box(b)
+		if err != nil {
+			return nil, err
+		}
+		boxes = append(boxes, mp4Box{kind, body})
+		b = rest
+	}
+	return boxes, nil
+}
+
+func appendMP4Box(b []byte, kind string, body []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(8+len(body)))
+	b = append(b, kind...)
+	return append(b, body...)
+}
+
+func encodeMP4Boxes(boxes []mp4Box) []byte {
+	var b []byte
+	for _, box := range boxes {
+		b = appendMP4Box(b, box.kind, box.body)
+	}
+	return b
+}
+
+// setMP4Items merges tags into the iTunes meta box under moov/udta,
+// adding udta and meta as needed. Other udta children, and meta boxes of
+// other handlers, are kept.
+func setMP4Items(moov []mp4Box, t *audioTags) ([]mp4Box, error) {
+	udtaAt := -1
+	for i, b := range moov {
+		if b.kind == "udta" {
+			udtaAt = i
+			break
+		}
+	}
+	if udtaAt < 0 {
+		moov = append(moov, mp4Box{kind: "udta"})
+		udtaAt = len(moov) - 1
+	}
+	udta, err := parseMP4Boxes(moov[udtaAt].body)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, b := range udta {
+		if b.kind != "meta" || len(b.body) < 4 {
+			continue
+		}
+		children, err := parseMP4Boxes(b.body[4:]) // after version and flags
+		if err != nil {
+			return nil, err
+		}
+		if !isMP4Directory(children) {
+			continue
+		}
+		if children, err = setMP4List(children, t); err != nil {
+			return nil, err
+		}
+		udta[i].body = append(b.body[:4:4], encodeMP4Boxes(children)...)
+		moov[udtaAt].body = encodeMP4Boxes(udta)
+		return moov, nil
+	}
+
+	// version/flags, pre_defined, handler type, reserved, empty name
+	hdlr := append(make([]byte, 8), "mdirappl"...)
+	hdlr = append(hdlr, make([]byte, 9)...)
+	meta := appendMP4Box(make([]byte, 4), "hdlr", hdlr)
+	meta = appendMP4Box(meta, "ilst", encodeMP4Boxes(mp4Items(t)))
+	udta = append(udta, mp4Box{"meta", meta})
+	moov[udtaAt].body = encodeMP4Boxes(udta)
+	return moov, nil
+}
+
+// setMP4List merges tags into the ilst among an iTunes meta box's
+// children, adding one if there is none.
+func setMP4List(children []mp4Box, t *audioTags) ([]mp4Box, error) {
+	for i, c := range children {
+		if c.kind == "ilst" {
+			items, err := parseMP4Boxes(c.body)
+			if err != nil {
+				return nil, err
+			}
+			children[i].body = encodeMP4Boxes(mergeMP4Items(items, mp4Items(t)))
+			return children, nil
+		}
+	}
+	return append(children, mp4Box{"ilst", encodeMP4Boxes(mp4Items(t))}), nil
+}
+
+// isMP4Directory reports whether a meta box's handler is iTunes' "mdir".
+func isMP4Directory(children []mp4Box) bool {
+	for _, c := range children {
+		if c.kind == "hdlr" {
+			return len(c.body) >= 12 && string(c.body[8:12]) == "mdir"
+		}
+	}
+	return false
+}
+
+// mp4Items maps tags onto iTunes items. Track and disc numbers are binary
+// (number, total) pairs; everything else without an item of its own is a
+// "----" item under com.apple.iTunes.
+func mp4Items(t *audioTags) []mp4Box {
+	var items []mp4Box
+	text := func(kind, value string) {
+		if value != "" {
+			items = append(items, mp4Item(kind, mp4UTF8, []byte(value)))
+		}
+	}
+	text("\xa9nam", t.title)
+	text("\xa9ART", t.artist)
+	text("aART", t.albumArtist)
+	text("\xa9alb", t.album)
+	if t.track > 0 {
+		data := binary.BigEndian.AppendUint16(make([]byte, 2), uint16(t.track))
+		data = binary.BigEndian.AppendUint16(data, uint16(t.trackTotal))
+		items = append(items, mp4Item("trkn", mp4Binary, append(data, 0, 0)))
+	}
+	if t.disc > 0 {
+		data := binary.BigEndian.AppendUint16(make([]byte, 2), uint16(t.disc))
+		items = append(items, mp4Item("disk", mp4Binary, binary.BigEndian.AppendUint16(data, uint16(t.discTotal))))
+	}
+	text("\xa9day", t.date)
+	text("\xa9gen", t.genre)
+	text("\xa9cmt", t.comment)
+	if t.cover != nil {
+		kind := uint32(mp4JPEG)
+		if coverMIME(t.cover) == "image/png" {
+			kind = mp4PNG
+		}
+		items = append(items, mp4Item("covr", kind, t.cover))
+	}
+
+	freeform := t.custom
+	if t.originalDate != "" {
+		freeform = append([]tagField{{"originaldate", t.originalDate}}, freeform...)
+	}
+	for _, f := range freeform {
+		body := appendMP4Box(nil, "mean", append(make([]byte, 4), mp4Freeform...))
+		body = appendMP4Box(body, "name", append(make([]byte, 4), f.name...))
+		body = appendMP4Box(body, "data", mp4Data(mp4UTF8, []byte(f.value)))
+		items = append(items, mp4Box{"----", body})
+	}
+	return items
+}
+
+func mp4Item(kind string, dataType uint32, value []byte) mp4Box {
+	return mp4Box{kind, appendMP4Box(nil, "data", mp4Data(dataType, value))}
+}
+
+// mp4Data is a data atom's body: its type, a zero locale, the value.
+func mp4Data(dataType uint32, value []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, dataType)
+	b = binary.BigEndian.AppendUint32(b, 0)
+	return append(b, value...)
+}
+
+// mergeMP4Items puts items first and keeps the existing items they do not
+// replace. A "----" item is replaced by one of the same name; the numeric
+// genre (gnre) goes whenever a text genre is written.
+func mergeMP4Items(existing, items []mp4Box) []mp4Box {
+	replaced := map[string]bool{}
+	for _, item := range items {
+		if item.kind == "----" {
+			replaced["----:"+strings.ToLower(mp4FreeformName(item))] = true
+		} else {
+			replaced[item.kind] = true
+		}
+	}
+	if replaced["\xa9gen"] {
+		replaced["gnre"] = true
+	}
+	merged := items
+	for _, item := range existing {
+		key := item.kind
+		if key == "----" {
+			key = "----:" + strings.ToLower(mp4FreeformName(item))
+		}
+		if !replaced[key] {
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+// mp4FreeformName is the name of a "----" item; "" if it has none or is
+// outside com.apple.iTunes.
+func mp4FreeformName(item mp4Box) string {
+	children, err := parseMP4Boxes(item.body)
+	if err != nil {
+		return ""
+	}
+	var mean, name string
+	for _, c := range children {
+		if len(c.body) < 4 {
+			continue
+		}
+		switch c.kind {
+		case "mean":
+			mean = string(c.body[4:])
+		case "name":
+			name = string(c.body[4:])
+		}
+	}
+	if mean != mp4Freeform {
+		return ""
+	}
+	return name
+}
+
+// shiftMP4Offsets adds delta to every chunk offset at or after moovStart:
+// the media data that moved along with the end of moov.
+func shiftMP4Offsets(moov []mp4Box, moovStart, delta int64) error {
+	for i, b := range moov {
+		switch b.kind {
+		case "trak", "mdia", "minf", "stbl":
+			children, err := parseMP4Boxes(b.body)
+			if err != nil {
+				return err
+			}
+			if err := shiftMP4Offsets(children, moovStart, delta); err != nil {
+				return err
+			}
+			moov[i].body = encodeMP4Boxes(children)
+		case "stco", "co64":
+			width := 4
+			if b.kind == "co64" {
+				width = 8
+			}
+			if len(b.body) < 8 {
+				return fmt.Errorf("truncated MP4 %s box", b.kind)
+			}
+			count := int(binary.BigEndian.Uint32(b.body[4:]))
+			if count > (len(b.body)-8)/width {
+				return fmt.Errorf("truncated MP4 %s box", b.kind)
+			}
+			body := bytes.Clone(b.body)
+			for k := 0; k < count; k++ {
+				entry := body[8+k*width:]
+				if width == 8 {
+					if off := int64(binary.BigEndian.Uint64(entry)); off >= moovStart {
+						binary.BigEndian.PutUint64(entry, uint64(off+delta))
+					}
+					continue
+				}
+				off := int64(binary.BigEndian.Uint32(entry))
+				if off < moovStart {
+					continue
+				}
+				if off+delta > math.MaxUint32 {
+					return errors.New("MP4 chunk offsets overflow 32 bits")
+				}
+				binary.BigEndian.PutUint32(entry, uint32(off+delta))
+			}
+			moov[i].body = body
+		}
+	}
+	return nil
+}
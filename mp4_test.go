@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// mp4Test builds a box from its children.
+func mp4Test(kind string, children ...[]byte) []byte {
+	return appendMP4Box(nil, kind, bytes.Join(children, nil))
+}
+
+// mp4TestMeta is an iTunes meta box holding items.
+func mp4TestMeta(items ...[]byte) []byte {
+	hdlr := append(make([]byte, 8), "mdirappl"...)
+	hdlr = append(hdlr, make([]byte, 9)...)
+	return mp4Test("meta", make([]byte, 4), mp4Test("hdlr", hdlr), mp4Test("ilst", items...))
+}
+
+func mp4TestItem(kind string, dataType uint32, value string) []byte {
+	return mp4Test(kind, mp4Test("data", mp4Data(dataType, []byte(value))))
+}
+
+func mp4TestFreeform(name, value string) []byte {
+	return mp4Test("----",
+		mp4Test("mean", make([]byte, 4), []byte(mp4Freeform)),
+		mp4Test("name", make([]byte, 4), []byte(name)),
+		mp4Test("data", mp4Data(mp4UTF8, []byte(value))))
+}
+
+// mp4Find returns the body of the box at path below the boxes in b, or nil.
+func mp4Find(b []byte, path ...string) []byte {
+	for _, kind := range path {
+		boxes, err := parseMP4Boxes(b)
+		if err != nil {
+			return nil
+		}
+		b = nil
+		for _, box := range boxes {
+			if box.kind == kind {
+				b = box.body
+				break
+			}
+		}
+		if b == nil {
+			return nil
+		}
+		if kind == "meta" && len(b) >= 4 {
+			b = b[4:]
+		}
+	}
+	return b
+}
+
+// mp4TestOffsets reads a stco or co64 table.
+func mp4TestOffsets(body []byte, width int) []int64 {
+	var offsets []int64
+	for i := 0; i < int(binary.BigEndian.Uint32(body[4:])); i++ {
+		entry := body[8+i*width:]
+		if width == 8 {
+			offsets = append(offsets, int64(binary.BigEndian.Uint64(entry)))
+		} else {
+			offsets = append(offsets, int64(binary.BigEndian.Uint32(entry)))
+		}
+	}
+	return offsets
+}
+
+func TestWriteMP4Tags(t *testing.T) {
+	ftyp := mp4Test("ftyp", []byte("M4A \x00\x00\x02\x00M4A isomiso2"))
+	chunks := []string{"CHUNK-1", "CHUNK-2", "CHUNK-3", "CHUNK-4"}
+	media := []byte("xx" + chunks[0] + "...." + chunks[1] + "...." + chunks[2] + "...." + chunks[3])
+	mdat := mp4Test("mdat", media)
+	largeMdat := binary.BigEndian.AppendUint32(nil, 1)
+	largeMdat = append(largeMdat, "mdat"...)
+	largeMdat = binary.BigEndian.AppendUint64(largeMdat, uint64(16+len(media)))
+	largeMdat = append(largeMdat, media...)
+
+	// moov builds a movie whose first track's stco and second track's co64
+	// point at the chunks, media starting at mediaAt in the file.
+	moov := func(mediaAt int64, udta []byte) []byte {
+		stco := binary.BigEndian.AppendUint32(make([]byte, 4), 2)
+		co64 := binary.BigEndian.AppendUint32(make([]byte, 4), 2)
+		for i, chunk := range chunks {
+			off := mediaAt + int64(bytes.Index(media, []byte(chunk)))
+			if i < 2 {
+				stco = binary.BigEndian.AppendUint32(stco, uint32(off))
+			} else {
+				co64 = binary.BigEndian.AppendUint64(co64, uint64(off))
+			}
+		}
+		track := func(table string, body []byte) []byte {
+			return mp4Test("trak", mp4Test("tkhd", make([]byte, 84)),
+				mp4Test("mdia", mp4Test("mdhd", make([]byte, 24)),
+					mp4Test("minf", mp4Test("stbl", mp4Test("stsd", make([]byte, 8)), mp4Test(table, body)))))
+		}
+		return mp4Test("moov", mp4Test("mvhd", make([]byte, 100)), track("stco", stco), track("co64", co64), udta)
+	}
+	oldMeta := mp4Test("udta", mp4Test("\xa9xyz", []byte("location")), mp4TestMeta(
+		mp4TestItem("\xa9nam", mp4UTF8, "Old title"),
+		mp4TestItem("cprt", mp4UTF8, "(c) Label"),
+		mp4TestItem("gnre", mp4Binary, "\x00\x11"),
+		mp4TestFreeform("originaldate", "1999-01-01"),
+		mp4TestFreeform("iTunNORM", "00000A00"),
+	))
+	oldCover := mp4Test("udta", mp4TestMeta(mp4TestItem("covr", mp4JPEG, string(make([]byte, 5000)))))
+
+	// layout places the boxes, giving moov the media position it will
+	// have; moov's size does not depend on the offsets in it.
+	layout := func(moovFirst, large bool, udta []byte) []byte {
+		media := mdat
+		if large {
+			media = largeMdat
+		}
+		header := int64(len(media) - len(mdat) + 8)
+		if moovFirst {
+			size := int64(len(moov(0, udta)))
+			return bytes.Join([][]byte{ftyp, moov(int64(len(ftyp))+size+header, udta), media}, nil)
+		}
+		return bytes.Join([][]byte{ftyp, media, moov(int64(len(ftyp))+header, udta)}, nil)
+	}
+
+	cover := testCover(t, 0)
+	tests := []struct {
+		name      string
+		in        []byte
+		cover     []byte
+		keepUdta  bool // the \xa9xyz box beside meta survives
+		wantItems []string
+	}{
+		{"moov before mdat, growing", layout(true, false, oldMeta), cover, true,
+			[]string{"\xa9nam", "\xa9ART", "\xa9gen", "covr", "----", "cprt", "----"}},
+		{"moov before a 64-bit mdat, growing", layout(true, true, oldMeta), cover, true,
+			[]string{"\xa9nam", "\xa9ART", "\xa9gen", "covr", "----", "cprt", "----"}},
+		{"moov before mdat, shrinking", layout(true, false, oldCover), cover, false,
+			[]string{"\xa9nam", "\xa9ART", "\xa9gen", "covr", "----"}},
+		{"moov after mdat", layout(false, false, nil), nil, false,
+			[]string{"\xa9nam", "\xa9ART", "\xa9gen", "----"}},
+	}
+	for _, tt := range tests {
+		tags := &audioTags{title: "Song", artist: "Artist", genre: "Rock", originalDate: "2024-01-02", cover: tt.cover}
+		out := rewrite(t, writeMP4Tags, tt.in, tags)
+
+		boxes, err := parseMP4Boxes(out)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		inBoxes, _ := parseMP4Boxes(tt.in)
+		if len(boxes) != len(inBoxes) {
+			t.Fatalf("%s: %d top-level boxes, want %d", tt.name, len(boxes), len(inBoxes))
+		}
+		for i, box := range boxes {
+			if box.kind != inBoxes[i].kind || box.kind != "moov" && !bytes.Equal(box.body, inBoxes[i].body) {
+				t.Errorf("%s: top-level box %d is %q, want %q unchanged", tt.name, i, box.kind, inBoxes[i].kind)
+			}
+		}
+
+		newMoov := mp4Find(out, "moov")
+		var offsets []int64
+		traks, _ := parseMP4Boxes(newMoov)
+		for _, trak := range traks {
+			if trak.kind != "trak" {
+				continue
+			}
+			stbl := mp4Find(trak.body, "mdia", "minf", "stbl")
+			if table := mp4Find(stbl, "stco"); table != nil {
+				offsets = append(offsets, mp4TestOffsets(table, 4)...)
+			}
+			if table := mp4Find(stbl, "co64"); table != nil {
+				offsets = append(offsets, mp4TestOffsets(table, 8)...)
+			}
+		}
+		if len(offsets) != len(chunks) {
+			t.Fatalf("%s: %d chunk offsets, want %d", tt.name, len(offsets), len(chunks))
+		}
+		for i, off := range offsets {
+			if off < 0 || int(off)+len(chunks[i]) > len(out) || string(out[off:int(off)+len(chunks[i])]) != chunks[i] {
+				t.Errorf("%s: chunk offset %d (%d) does not point at %s", tt.name, i, off, chunks[i])
+			}
+		}
+
+		items, err := parseMP4Boxes(mp4Find(newMoov, "udta", "meta", "ilst"))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var kinds []string
+		for _, item := range items {
+			kinds = append(kinds, item.kind)
+		}
+		if !reflect.DeepEqual(kinds, tt.wantItems) {
+			t.Errorf("%s: items %q, want %q", tt.name, kinds, tt.wantItems)
+		}
+		if got := mp4Find(items[0].body, "data"); string(got) != string(mp4Data(mp4UTF8, []byte("Song"))) {
+			t.Errorf("%s: title item = %q", tt.name, got)
+		}
+		if tt.cover != nil {
+			if got := mp4Find(items[3].body, "data"); !bytes.Equal(got, mp4Data(mp4PNG, cover)) {
+				t.Errorf("%s: cover item is not the PNG cover", tt.name)
+			}
+		}
+		if tt.keepUdta && string(mp4Find(newMoov, "udta", "\xa9xyz")) != "location" {
+			t.Errorf("%s: other udta box dropped", tt.name)
+		}
+	}
+}
+
+func TestWriteMP4TagsErrors(t *testing.T) {
+	ftyp := mp4Test("ftyp", []byte("M4A \x00\x00\x02\x00"))
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{"no moov", append(bytes.Clone(ftyp), mp4Test("mdat", []byte("data"))...)},
+		{"fragmented", bytes.Join([][]byte{ftyp, mp4Test("moov", mp4Test("mvhd", make([]byte, 100))), mp4Test("moof")}, nil)},
+		{"box overruns the file", append(bytes.Clone(ftyp), "\x00\x00\x01\x00moov"...)},
+	}
+	for _, tt := range tests {
+		if _, err := runWriter(t, writeMP4Tags, tt.in, &audioTags{title: "Song"}); err == nil {
+			t.Errorf("%s: writeMP4Tags succeeded", tt.name)
+		}
+	}
+}
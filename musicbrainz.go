@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ─── MusicBrainz ──────────────────────────────────────────────────────────────
+
+// mbRecording is a recording in the MusicBrainz web service's JSON, which
+// the JSON data dumps share: one recording per line, with the releases it
+// appears on.
+type mbRecording struct {
+	ID           string      `json:"id"`
+	Title        string      `json:"title"`
+	Length       float64     `json:"length"` // milliseconds
+	ArtistCredit []mbCredit  `json:"artist-credit"`
+	Releases     []mbRelease `json:"releases"`
+}
+
+type mbCredit struct {
+	Name       string `json:"name"`
+	JoinPhrase string `json:"joinphrase"`
+}
+
+type mbRelease struct {
+	Title        string     `json:"title"`
+	Date         string     `json:"date"`
+	Status       string     `json:"status"`
+	ArtistCredit []mbCredit `json:"artist-credit"`
+	MediumCount  int        `json:"medium-count"`
+	Media        []struct {
+		Position   int       `json:"position"`
+		TrackCount int       `json:"track-count"`
+		Track      []mbTrack `json:"track"`
+		Tracks     []mbTrack `json:"tracks"` // the dumps' spelling
+	} `json:"media"`
+}
+
+type mbTrack struct {
+	Number   string `json:"number"` // as printed: "3", "A1"
+	Position int    `json:"position"`
+}
+
+// creditName joins an artist credit as MusicBrainz displays it:
+// "Artist feat. Guest".
+func creditName(credits []mbCredit) string {
+	var b strings.Builder
+	for _, c := range credits {
+		b.WriteString(c.Name + c.JoinPhrase)
+	}
+	return b.String()
+}
+
+// matches lists the recording once per official release it is on, or once
+// without an album when it has none.
+func (r mbRecording) matches() []trackMatch {
+	base := trackMatch{id: r.ID, title: r.Title, artist: creditName(r.ArtistCredit), duration: r.Length / 1000}
+	var list []trackMatch
+	for _, rel := range r.Releases {
+		if rel.Status != "" && rel.Status != "Official" {
+			continue
+		}
+		m := base
+		m.album, m.albumArtist, m.date = rel.Title, creditName(rel.ArtistCredit), rel.Date
+		m.discTotal = rel.MediumCount
+		if len(rel.Media) > 0 {
+			medium := rel.Media[0]
+			m.disc, m.trackTotal = medium.Position, medium.TrackCount
+			tracks := append(medium.Track, medium.Tracks...)
+			if len(tracks) > 0 {
+				m.track = tracks[0].Position
+				if n, err := strconv.Atoi(tracks[0].Number); err == nil {
+					m.track = n
+				}
+			}
+		}
+		if m.discTotal < 2 {
+			m.disc, m.discTotal = 0, 0
+		}
+		list = append(list, m)
+	}
+	if len(list) == 0 {
+		list = append(list, base)
+	}
+	return list
+}
+
+// musicBrainzDump searches a MusicBrainz JSON dump of recordings, one JSON
+// object per line, indexed on the first search.
+type musicBrainzDump struct {
+	path  string
+	index dumpIndex
+}
+
+func (d *musicBrainzDump) name() string { return "MusicBrainz dump" }
+
+func (d *musicBrainzDump) search(q trackQuery) ([]trackMatch, error) {
+	if err := d.index.load(d.name(), d.path, d.read); err != nil {
+		return nil, err
+	}
+	return d.index.lookup(q), nil
+}
+
+// read passes every recording of the dump to add, once per release.
+func (d *musicBrainzDump) read(add func(trackMatch)) error {
+	r, err := openDump(d.path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for n := 1; ; n++ {
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Longer than the buffer: collect the rest of the line.
+			long := append([]byte{}, line...)
+			for err == bufio.ErrBufferFull {
+				line, err = r.ReadSlice('\n')
+				long = append(long, line...)
+			}
+			line = long
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			var rec mbRecording
+			if jerr := json.Unmarshal(line, &rec); jerr != nil {
+				return fmt.Errorf("%s:%d: %v", d.path, n, jerr)
+			}
+			for _, m := range rec.matches() {
+				add(m)
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// longestWord is the longest word of s, normalised: the key dumps are
+// searched by, which survives small spelling differences elsewhere in the
+// title. It is "" when s has no letters or digits.
+func longestWord(s string) string {
+	word := ""
+	for _, w := range strings.Fields(normalizeName(s)) {
+		if len(w) > len(word) {
+			word = w
+		}
+	}
+	return word
+}
+
+// musicBrainzServer queries a service with the MusicBrainz web service API
+// (/ws/2/recording?query=...), such as a local mirror or a test stand-in.
+type musicBrainzServer struct {
+	base   string
+	client *http.Client
+}
+
+func newMusicBrainzServer(base string) musicBrainzServer {
+	return musicBrainzServer{strings.TrimSuffix(base, "/"), &http.Client{Timeout: 15 * time.Second}}
+}
+
+func (s musicBrainzServer) name() string { return "MusicBrainz server" }
+
+func (s musicBrainzServer) search(q trackQuery) ([]trackMatch, error) {
+	query := "recording:" + luceneQuote(q.title)
+	if q.artist != "" {
+		query += " AND artist:" + luceneQuote(mainArtist(q.artist))
+	}
+	u := s.base + "/ws/2/recording?" + url.Values{"query": {query}, "fmt": {"json"}, "limit": {"10"}}.Encode()
+	debugLog("musicBrainzServer: GET %s", u)
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "streamline (https://github.com/shahil-sk/streamline)")
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", s.base, resp.Status)
+	}
+	var body struct {
+		Recordings []mbRecording `json:"recordings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.base, err)
+	}
+	var found []trackMatch
+	for _, r := range body.Recordings {
+		found = append(found, r.matches()...)
+	}
+	return found, nil
+}
+
+// luceneQuote quotes a phrase for the search syntax MusicBrainz uses.
+func luceneQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
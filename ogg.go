@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ─── Ogg (Opus, Vorbis) ───────────────────────────────────────────────────────
+
+// oggPage is one page of an Ogg stream. Header fields are kept decoded;
+// encode recomputes the checksum.
+type oggPage struct {
+	flags    byte // 0x01 continued packet, 0x02 first page, 0x04 last page
+	granule  uint64
+	serial   uint32
+	sequence uint32
+	lacing   []byte
+	body     []byte
+}
+
+const (
+	oggContinued  = 0x01
+	oggNoGranule  = ^uint64(0) // granule of a page on which no packet ends
+	oggMaxSegment = 255
+)
+
+var oggCRCTable = func() (t [256]uint32) {
+	for i := range t {
+		c := uint32(i) << 24
+		for k := 0; k < 8; k++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04c11db7
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return t
+}()
+
+// oggCRC is Ogg's CRC-32: polynomial 0x04c11db7, not reflected, no initial
+// or final XOR.
+func oggCRC(b []byte) uint32 {
+	var crc uint32
+	for _, v := range b {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^v]
+	}
+	return crc
+}
+
+func readOggPage(r io.Reader) (*oggPage, error) {
+	var head [27]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	if string(head[:4]) != "OggS" || head[4] != 0 {
+		return nil, errors.New("bad Ogg page header")
+	}
+	p := &oggPage{
+		flags:    head[5],
+		granule:  binary.LittleEndian.Uint64(head[6:]),
+		serial:   binary.LittleEndian.Uint32(head[14:]),
+		sequence: binary.LittleEndian.Uint32(head[18:]),
+		lacing:   make([]byte, head[26]),
+	}
+	if _, err := io.ReadFull(r, p.lacing); err != nil {
+		return nil, err
+	}
+	size := 0
+	for _, l := range p.lacing {
+		size += int(l)
+	}
+	p.body = make([]byte, size)
+	if _, err := io.ReadFull(r, p.body); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *oggPage) encode() []byte {
+	b := make([]byte, 27, 27+len(p.lacing)+len(p.body))
+	copy(b, "OggS")
+	b[5] = p.flags
+	binary.LittleEndian.PutUint64(b[6:], p.granule)
+	binary.LittleEndian.PutUint32(b[14:], p.serial)
+	binary.LittleEndian.PutUint32(b[18:], p.sequence)
+	b[26] = byte(len(p.lacing))
+	b = append(b, p.lacing...)
+	b = append(b, p.body...)
+	binary.LittleEndian.PutUint32(b[22:], oggCRC(b))
+	return b
+}
+
+// oggPaginate lays packets out on pages of the given stream, numbered from
+// sequence, as libogg would: a page holds at most 255 segments and a
+// packet whose length is a multiple of 255 ends with a zero-length one.
+func oggPaginate(serial, sequence uint32, packets [][]byte) []*oggPage {
+	var pages []*oggPage
+	p := &oggPage{serial: serial, sequence: sequence, granule: oggNoGranule}
+	for _, packet := range packets {
+		for rest, started := packet, false; ; started = true {
+			if len(p.lacing) == oggMaxSegment {
+				pages = append(pages, p)
+				sequence++
+				p = &oggPage{serial: serial, sequence: sequence, granule: oggNoGranule}
+				if started {
+					p.flags = oggContinued
+				}
+			}
+			n := min(len(rest), oggMaxSegment)
+			p.lacing = append(p.lacing, byte(n))
+			p.body = append(p.body, rest[:n]...)
+			rest = rest[n:]
+			if n < oggMaxSegment {
+				// Header packets carry granule position 0.
+				p.granule = 0
+				break
+			}
+		}
+	}
+	return append(pages, p)
+}
+
+// writeOggTags replaces the comment header of an Ogg Opus or Ogg Vorbis
+// file. The header pages are laid out afresh; later pages of the stream
+// are renumbered if the count changed, with their checksums redone. Audio
+// data is copied unchanged.
+func writeOggTags(r *os.File, w io.Writer, t *audioTags) error {
+	br := bufio.NewReader(r)
+	first, err := readOggPage(br)
+	if err != nil {
+		return fmt.Errorf("reading Ogg stream: %w", err)
+	}
+	serial := first.serial
+
+	var magic []byte
+	headerPackets := 0
+	switch {
+	case bytes.HasPrefix(first.body, []byte("OpusHead")):
+		magic, headerPackets = []byte("OpusTags"), 2
+	case bytes.HasPrefix(first.body, []byte("\x01vorbis")):
+		magic, headerPackets = []byte("\x03vorbis"), 3
+	default:
+		return errors.New("Ogg stream is neither Opus nor Vorbis")
+	}
+	if len(first.lacing) == 0 || first.lacing[len(first.lacing)-1] == oggMaxSegment {
+		return errors.New("Ogg identification header does not end its page")
+	}
+
+	// Collect the remaining header packets; they must end on a page
+	// boundary, with audio starting on a fresh page.
+	var (
+		packets   [][]byte
+		packet    []byte
+		oldPages  int
+		lastFlags byte
+	)
+	for len(packets) < headerPackets-1 {
+		p, err := readOggPage(br)
+		if err != nil {
+			return fmt.Errorf("reading Ogg headers: %w", err)
+		}
+		if p.serial != serial {
+			return errors.New("multiplexed Ogg streams are not supported")
+		}
+		oldPages++
+		lastFlags = p.flags
+		off := 0
+		for _, l := range p.lacing {
+			if len(packets) == headerPackets-1 {
+				return errors.New("Ogg audio data shares a page with the headers")
+			}
+			packet = append(packet, p.body[off:off+int(l)]...)
+			off += int(l)
+			if l < oggMaxSegment {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+	}
+	if lastFlags&0x04 != 0 {
+		return errors.New("Ogg stream has no audio")
+	}
+
+	comment := packets[0]
+	if !bytes.HasPrefix(comment, magic) {
+		return errors.New("missing Ogg comment header")
+	}
+	vendor, comments, rest, err := parseVorbisComment(comment[len(magic):])
+	if err != nil {
+		return err
+	}
+	fields := vorbisFields(t)
+	if t.cover != nil {
+		picture, err := pictureComment(t.cover)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, picture)
+	}
+	packets[0] = append(append(append([]byte{}, magic...), encodeVorbisComment(vendor, mergeVorbis(comments, fields))...), rest...)
+
+	newPages := oggPaginate(serial, first.sequence+1, packets)
+	shift := uint32(len(newPages) - oldPages)
+	debugLog("writeOggTags: %d header page(s) → %d", oldPages, len(newPages))
+
+	if _, err := w.Write(first.encode()); err != nil {
+		return err
+	}
+	for _, p := range newPages {
+		if _, err := w.Write(p.encode()); err != nil {
+			return err
+		}
+	}
+	for {
+		p, err := readOggPage(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading Ogg stream: %w", err)
+		}
+		if p.serial == serial {
+			p.sequence += shift
+		}
+		if _, err := w.Write(p.encode()); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestOggCRC(t *testing.T) {
+	// CRC-32/CKSUM's check value without its final XOR.
+	if got := oggCRC([]byte("123456789")); got != 0x89a1897f {
+		t.Errorf("oggCRC(123456789) = %#x, want 0x89a1897f", got)
+	}
+}
+
+// oggLacing is the lacing of a single packet that ends on its page.
+func oggLacing(n int) []byte {
+	lacing := bytes.Repeat([]byte{oggMaxSegment}, n/oggMaxSegment)
+	return append(lacing, byte(n%oggMaxSegment))
+}
+
+// readTestOgg decodes every page of a written stream, failing on a bad
+// checksum, and splits the pages into packets. ends[i] is the page packet
+// i ends on.
+func readTestOgg(t *testing.T, b []byte) (pages []*oggPage, packets [][]byte, ends []int) {
+	t.Helper()
+	r := bytes.NewReader(b)
+	var packet []byte
+	for {
+		start := len(b) - r.Len()
+		p, err := readOggPage(r)
+		if err == io.EOF {
+			return pages, packets, ends
+		}
+		if err != nil {
+			t.Fatalf("page %d: %v", len(pages), err)
+		}
+		raw := bytes.Clone(b[start : len(b)-r.Len()])
+		crc := binary.LittleEndian.Uint32(raw[22:])
+		binary.LittleEndian.PutUint32(raw[22:], 0)
+		if want := oggCRC(raw); crc != want {
+			t.Errorf("page %d: checksum %#x, want %#x", len(pages), crc, want)
+		}
+		off := 0
+		for _, l := range p.lacing {
+			packet = append(packet, p.body[off:off+int(l)]...)
+			off += int(l)
+			if l < oggMaxSegment {
+				packets, ends = append(packets, packet), append(ends, len(pages))
+				packet = nil
+			}
+		}
+		pages = append(pages, p)
+	}
+}
+
+func TestWriteOggTags(t *testing.T) {
+	const serial = 0x1234abcd
+	audio := []*oggPage{
+		{granule: 960, serial: serial, sequence: 2, lacing: []byte{255, 45}, body: bytes.Repeat([]byte{0xa5}, 300)},
+		{granule: 1920, serial: serial, sequence: 3, lacing: []byte{30}, body: bytes.Repeat([]byte{0x5a}, 30)},
+		{flags: 0x04, granule: 2400, serial: serial, sequence: 4, lacing: []byte{10}, body: bytes.Repeat([]byte{0x33}, 10)},
+	}
+	opusHead := []byte("OpusHead\x01\x02\x38\x01\x80\xbb\x00\x00\x00\x00\x00")
+	opusTags := append([]byte("OpusTags"), encodeVorbisComment("libopus 1.4", []string{"ENCODER=Lavf", "TITLE=Old"})...)
+	opusTags = append(opusTags, "\x00padding"...)
+	vorbisID := []byte("\x01vorbis\x00\x00\x00\x00\x02\x44\xac\x00\x00\x00\x00\x00\x00\x00\xee\x02\x00\x00\x00\x00\x00\xb8\x01")
+	vorbisComment := append([]byte("\x03vorbis"), encodeVorbisComment("Xiph.Org libVorbis I 20200704", []string{"TITLE=Old"})...)
+	vorbisComment = append(vorbisComment, 0x01) // framing bit
+	vorbisSetup := append([]byte("\x05vorbis"), bytes.Repeat([]byte{0x42}, 293)...)
+
+	stream := func(id []byte, headers ...[]byte) []byte {
+		first := &oggPage{flags: 0x02, serial: serial, lacing: oggLacing(len(id)), body: id}
+		second := &oggPage{serial: serial, sequence: 1}
+		for _, h := range headers {
+			second.lacing = append(second.lacing, oggLacing(len(h))...)
+			second.body = append(second.body, h...)
+		}
+		b := append(first.encode(), second.encode()...)
+		for _, p := range audio {
+			b = append(b, p.encode()...)
+		}
+		return b
+	}
+	opus := stream(opusHead, opusTags)
+	vorbis := stream(vorbisID, vorbisComment, vorbisSetup)
+
+	tests := []struct {
+		name    string
+		in, id  []byte
+		cover   []byte
+		magic   string
+		vendor  string
+		rest    string
+		setup   []byte
+		headers int // pages holding the comment (and setup) header
+	}{
+		{"opus", opus, opusHead, nil, "OpusTags", "libopus 1.4", "\x00padding", nil, 1},
+		{"opus with a cover over a page", opus, opusHead, testCover(t, 70000), "OpusTags", "libopus 1.4", "\x00padding", nil, 2},
+		{"vorbis", vorbis, vorbisID, nil, "\x03vorbis", "Xiph.Org libVorbis I 20200704", "\x01", vorbisSetup, 1},
+		{"vorbis with a cover over a page", vorbis, vorbisID, testCover(t, 70000), "\x03vorbis", "Xiph.Org libVorbis I 20200704", "\x01", vorbisSetup, 2},
+	}
+	for _, tt := range tests {
+		tags := &audioTags{title: "Song", artist: "Artist", cover: tt.cover}
+		pages, packets, ends := readTestOgg(t, rewrite(t, writeOggTags, tt.in, tags))
+		headerPackets := 2
+		if tt.setup != nil {
+			headerPackets = 3
+		}
+		if want := 1 + tt.headers + len(audio); len(pages) != want {
+			t.Fatalf("%s: %d pages, want %d", tt.name, len(pages), want)
+		}
+
+		for i, p := range pages {
+			if p.serial != serial || p.sequence != uint32(i) {
+				t.Errorf("%s: page %d has serial %#x, sequence %d", tt.name, i, p.serial, p.sequence)
+			}
+		}
+		if pages[0].flags != 0x02 || pages[0].granule != 0 || !bytes.Equal(packets[0], tt.id) {
+			t.Errorf("%s: first page changed: flags %#x, granule %d", tt.name, pages[0].flags, pages[0].granule)
+		}
+		for i, p := range pages[1 : 1+tt.headers] {
+			wantFlags, wantGranule := byte(0), uint64(0)
+			if i > 0 {
+				wantFlags = oggContinued
+			}
+			if i < tt.headers-1 {
+				wantGranule = oggNoGranule // no packet ends here
+			}
+			if p.flags != wantFlags || p.granule != wantGranule {
+				t.Errorf("%s: header page %d has flags %#x, granule %d; want %#x, %d",
+					tt.name, i+1, p.flags, p.granule, wantFlags, int64(wantGranule))
+			}
+		}
+		for i, p := range pages[1+tt.headers:] {
+			want := audio[i]
+			if p.flags != want.flags || p.granule != want.granule || !bytes.Equal(p.body, want.body) {
+				t.Errorf("%s: audio page %d has flags %#x, granule %d; want %#x, %d and the same data",
+					tt.name, i, p.flags, p.granule, want.flags, want.granule)
+			}
+		}
+		for i := 1; i < headerPackets; i++ {
+			if ends[i] != tt.headers {
+				t.Errorf("%s: header packet %d ends on page %d, want %d", tt.name, i, ends[i], tt.headers)
+			}
+		}
+
+		comment := packets[1]
+		if !bytes.HasPrefix(comment, []byte(tt.magic)) {
+			t.Fatalf("%s: comment header starts % x", tt.name, comment[:min(len(comment), 8)])
+		}
+		vendor, comments, rest, err := parseVorbisComment(comment[len(tt.magic):])
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		want := []string{"TITLE=Song", "ARTIST=Artist"}
+		if tt.magic == "OpusTags" {
+			want = append([]string{"ENCODER=Lavf"}, want...)
+		}
+		if tt.cover != nil {
+			picture, err := pictureComment(tt.cover)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, picture.name+"="+picture.value)
+		}
+		if vendor != tt.vendor || string(rest) != tt.rest || !reflect.DeepEqual(comments, want) {
+			t.Errorf("%s: comment header = %q, %.60q, %q; want %q, %.60q, %q",
+				tt.name, vendor, comments, rest, tt.vendor, want, tt.rest)
+		}
+		if tt.setup != nil && !bytes.Equal(packets[2], tt.setup) {
+			t.Errorf("%s: setup header changed", tt.name)
+		}
+	}
+}
+
+func TestWriteOggTagsErrors(t *testing.T) {
+	id := &oggPage{flags: 0x02, serial: 1, lacing: []byte{8}, body: []byte("OpusHead")}
+	tags := &oggPage{serial: 1, sequence: 1, lacing: []byte{16, 4}, body: append(
+		append([]byte("OpusTags"), encodeVorbisComment("", nil)...), "audi"...)}
+	other := &oggPage{serial: 2, sequence: 1, lacing: []byte{4}, body: []byte("data")}
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{"not Ogg", []byte("fLaC\x00\x00\x00\x22")},
+		{"unknown codec", (&oggPage{flags: 0x02, lacing: []byte{4}, body: []byte("Spex")}).encode()},
+		{"audio on the header page", append(id.encode(), tags.encode()...)},
+		{"multiplexed", append(id.encode(), other.encode()...)},
+	}
+	for _, tt := range tests {
+		if _, err := runWriter(t, writeOggTags, tt.in, &audioTags{title: "Song"}); err == nil {
+			t.Errorf("%s: writeOggTags succeeded", tt.name)
+		}
+	}
+}
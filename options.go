@@ -0,0 +1,48 @@
+package main
+
+import "strings"
+
+// ─── Download Options ─────────────────────────────────────────────────────────
+
+// options holds the settings that shape each download. It is filled from the
+// command line once in run() and only read afterwards, so workers share it
+// without locking.
+type options struct {
+	quality        string           // --quality preset name
+	format         string           // --format: raw yt-dlp format spec
+	maxHeight      int              // --max-height cap applied on top of the preset
+	preferCodec    string           // --prefer-codec: avc, hevc, vp9 or av1
+	defaultQuality string           // preset used when stdin cannot answer a prompt
+	audioFormat    string           // --audio-format: an audioFormats name or "best"
+	audioQuality   string           // --audio-quality: V0–V9, a bitrate or a preset name
+	encoding       audioEncoding    // resolved from the two above by validateAudioOptions
+	output         string           // -o/--output file name template
+	dir            string           // --dir destination root; "" is the working directory
+	onConflict     string           // --on-conflict policy for existing outputs
+	dryRun         bool             // --dry-run: plan every download, fetch nothing
+	coverSize      int              // --cover-size: side of the square cover art in pixels
+	coverCrop      string           // --cover-crop: center, smart, pad or none
+	coverFormat    string           // --cover-format: jpeg or png
+	coverQuality   int              // --cover-quality: ffmpeg JPEG quality, 2 (best) to 31
+	coverMaxSize   string           // --cover-max-size: largest cover, e.g. "200K"
+	coverMaxBytes  int64            // parsed from coverMaxSize by validateCoverOptions; 0 for no limit
+	coverFile      string           // --cover-file: image embedded instead of the thumbnail
+	id3Version     int              // --id3-version: 3 or 4, the ID3v2 version of MP3 tags
+	rawTitle       bool             // --raw-title: tag the upload title as-is
+	remastered     string           // --remastered: keep or strip remaster notes in titles
+	titleRules     stringList       // --title-rule: user regexes for parseTitle
+	titleRegexps   []titleRule      // compiled from titleRules by validateTitleOptions
+	metadataSource string           // --metadata-source: dump file or MusicBrainz API URL
+	matchThreshold float64          // --match-threshold: confidence needed to retag unasked
+	provider       metadataProvider // opened from metadataSource by validateMatchOptions
+	exec           stringList       // --exec: shell commands run after each download
+}
+
+var opts options
+
+// stringList is a flag that may be repeated, collecting every value.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, "; ") }
+func (l *stringList) Set(s string) error { *l = append(*l, s); return nil }
+func (l *stringList) Get() any           { return []string(*l) }
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ─── Output Templates ─────────────────────────────────────────────────────────
+
+// defaultOutputTemplate keeps the historical "<title>.<ext>" naming.
+const defaultOutputTemplate = "{title}.{ext}"
+
+// maxComponentBytes is the file-name limit of every common filesystem.
+const maxComponentBytes = 255
+
+// reTemplateField matches {name}, {name:spec} and {name|default}, e.g.
+// {track:02d} or {album|Singles}. spec is a printf verb without the "%".
+var reTemplateField = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)(?::([-+ 0#]*[0-9]*(?:\.[0-9]+)?[dxXofeEgGs]))?(?:\|([^{}]*))?\}`)
+
+// validateOutputTemplate rejects templates with malformed fields up front,
+// rather than after the first download.
+func validateOutputTemplate(tmpl string) error {
+	rest := reTemplateField.ReplaceAllString(tmpl, "")
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("malformed output template %q: fields look like {title}, {track:02d} or {album|Singles}", tmpl)
+	}
+	return nil
+}
+
+// outputFields collects the values a template can use: everything in
+// yt-dlp's metadata, overridden by what streamline knows better (the
+// playlist album and track, the actual extension).
+func outputFields(j *job, file string) map[string]any {
+	fields := map[string]any{}
+	for k, v := range j.info {
+		fields[k] = v
+	}
+
+	base := filepath.Base(file)
+	fields["ext"] = strings.TrimPrefix(filepath.Ext(base), ".")
+	if fields["title"] == nil {
+		fields["title"] = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if fields["uploader"] == nil && fields["channel"] != nil {
+		fields["uploader"] = fields["channel"]
+	}
+	if j.album != "" {
+		fields["album"] = j.album
+	} else if fields["album"] == nil && fields["playlist"] != nil {
+		fields["album"] = fields["playlist"]
+	}
+	if j.track > 0 {
+		fields["track"] = j.track
+		fields["track_total"] = j.trackTotal
+	} else if fields["track"] == nil && fields["track_number"] != nil {
+		fields["track"] = fields["track_number"]
+	}
+	return fields
+}
+
+// renderOutputPath expands tmpl for the downloaded file and places it under
+// dir. Each "/"-separated piece of the template is rendered and sanitised on
+// its own, so a slash inside a title cannot create a directory; pieces that
+// come out empty (say {album} for a single video) are dropped.
+func renderOutputPath(tmpl, dir string, fields map[string]any) string {
+	if !strings.Contains(tmpl, "{ext}") {
+		tmpl += ".{ext}"
+	}
+	seps := "/"
+	if runtime.GOOS == "windows" {
+		seps = `/\`
+	}
+	pieces := strings.FieldsFunc(tmpl, func(r rune) bool { return strings.ContainsRune(seps, r) })
+
+	parts := make([]string, 0, len(pieces)+1)
+	if filepath.IsAbs(tmpl) {
+		dir = string(filepath.Separator)
+		if vol := filepath.VolumeName(tmpl); vol != "" {
+			dir = vol + string(filepath.Separator)
+			pieces = pieces[1:]
+		}
+	}
+	if dir != "" {
+		parts = append(parts, dir)
+	}
+	for i, piece := range pieces {
+		last := i == len(pieces)-1
+		rendered := reTemplateField.ReplaceAllStringFunc(piece, func(field string) string {
+			m := reTemplateField.FindStringSubmatch(field)
+			v := formatField(fields[m[1]], m[2])
+			if v == "" {
+				v = m[3]
+			}
+			return v
+		})
+		if name := sanitizeComponent(rendered, runtime.GOOS, last); name != "" {
+			parts = append(parts, name)
+		}
+	}
+	return filepath.Join(parts...)
+}
+
+// formatField renders one value with an optional printf spec. JSON numbers
+// arrive as float64, so integral values print without a fraction.
+func formatField(v any, spec string) string {
+	if v == nil {
+		return ""
+	}
+	if spec == "" {
+		spec = "v"
+		if f, ok := v.(float64); ok && f == math.Trunc(f) {
+			v = int64(f)
+		}
+	}
+	switch spec[len(spec)-1] {
+	case 'd', 'x', 'X', 'o':
+		n, ok := toInt(v)
+		if !ok {
+			return ""
+		}
+		return fmt.Sprintf("%"+spec, n)
+	case 'f', 'e', 'E', 'g', 'G':
+		f, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+		if err != nil {
+			return ""
+		}
+		return fmt.Sprintf("%"+spec, f)
+	}
+	return fmt.Sprintf("%"+spec, v)
+}
+
+func toInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(n), 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// ─── Path Sanitising ──────────────────────────────────────────────────────────
+
+// windowsReserved are device names Windows refuses as file names, with or
+// without an extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizeComponent makes s safe as one path component on goos: path
+// separators and control characters are replaced everywhere, plus
+// <>:"|?* on Windows and ":" on macOS (Finder shows it as "/"). Windows
+// device names get a trailing "_", and the result is cut to
+// maxComponentBytes, keeping the extension when isFile is set.
+func sanitizeComponent(s, goos string, isFile bool) string {
+	illegal := "/\x00"
+	switch goos {
+	case "windows":
+		illegal = `/\<>:"|?*` + "\x00"
+	case "darwin":
+		illegal = "/:\x00"
+	}
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(illegal, r) {
+			return '_'
+		}
+		return r
+	}, s)
+
+	// Windows drops trailing dots and spaces silently; leading and trailing
+	// space is a nuisance everywhere.
+	s = strings.TrimSpace(s)
+	if goos == "windows" {
+		s = strings.TrimRight(s, ". ")
+	}
+	if s == "." || s == ".." {
+		s = strings.Repeat("_", len(s))
+	}
+	if goos == "windows" {
+		if stem, ext, found := strings.Cut(s, "."); windowsReserved[strings.ToUpper(stem)] {
+			s = stem + "_"
+			if found {
+				s += "." + ext
+			}
+		}
+	}
+	return truncateComponent(s, isFile)
+}
+
+// truncateComponent shortens s to maxComponentBytes on a rune boundary,
+// trimming the stem rather than the extension of a file name.
+func truncateComponent(s string, isFile bool) string {
+	if len(s) <= maxComponentBytes {
+		return s
+	}
+	ext := ""
+	if isFile {
+		ext = filepath.Ext(s)
+		if len(ext) > 16 {
+			ext = ""
+		}
+	}
+	stem := s[:len(s)-len(ext)]
+	limit := maxComponentBytes - len(ext)
+	for limit > 0 && !utf8.RuneStart(stem[limit]) {
+		limit--
+	}
+	return strings.TrimSpace(stem[:limit]) + ext
+}
+
+// ─── Placing Files ────────────────────────────────────────────────────────────
+
+// placeOutput moves the finished file from the work directory to the path
+// the output template names, creating directories on the way. The
+// --on-conflict decision made before the download is reused unless the
+// real file name turned out different from the prediction.
+func placeOutput(j *job, file string) (string, error) {
+	dest := renderOutputPath(opts.output, opts.dir, outputFields(j, file))
+	if j.dest != "" && dest == j.planned {
+		dest = j.dest
+	} else {
+		var err error
+		if dest, err = resolveConflict(j, dest); err != nil {
+			return "", err
+		}
+	}
+	debugLog("placeOutput: %s → %s", file, dest)
+	if parent := filepath.Dir(dest); parent != "." {
+		if err := os.MkdirAll(parent, 0o755); err != nil {
+			return "", classify(classFilesystem, err)
+		}
+	}
+	j.status("info", fmt.Sprintf("Moving file to: %s", dest))
+	emit(j, evPostprocess, map[string]any{"step": "move", "path": dest})
+	if err := finalizeFile(file, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeComponent(t *testing.T) {
+	tests := []struct {
+		goos, in string
+		isFile   bool
+		want     string
+	}{
+		{"linux", "AC/DC: Back in Black?", true, "AC_DC: Back in Black?"},
+		{"linux", "tab\there\x00", false, "tab_here_"},
+		{"linux", "  padded  ", false, "padded"},
+		{"linux", "trailing dot.", false, "trailing dot."},
+		{"linux", "..", false, "__"},
+		{"linux", ".", false, "_"},
+		{"linux", "CON", false, "CON"},
+		{"darwin", "AC/DC: Live", false, "AC_DC_ Live"},
+		{"windows", `AC/DC: Back\in <Black>?"|*`, true, "AC_DC_ Back_in _Black_____"},
+		{"windows", "trailing dots... ", false, "trailing dots"},
+		{"windows", "CON", false, "CON_"},
+		{"windows", "con.mp3", true, "con_.mp3"},
+		{"windows", "Lpt9.tar.gz", true, "Lpt9_.tar.gz"},
+		{"windows", "CONSOLE.mp3", true, "CONSOLE.mp3"},
+		{"windows", "COM0", false, "COM0"},
+		{"windows", "...", false, ""}, // nothing left; renderOutputPath drops the piece
+		{"windows", "bell\x07", false, "bell_"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeComponent(tt.in, tt.goos, tt.isFile); got != tt.want {
+			t.Errorf("sanitizeComponent(%q, %s) = %q, want %q", tt.in, tt.goos, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateComponent(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	if got := truncateComponent(long+".mp3", true); len(got) != maxComponentBytes || !strings.HasSuffix(got, ".mp3") {
+		t.Errorf("file name: got %d bytes %q…, want %d ending in .mp3", len(got), got[:10], maxComponentBytes)
+	}
+	if got := truncateComponent(long+".mp3", false); len(got) != maxComponentBytes || strings.HasSuffix(got, ".mp3") {
+		t.Errorf("directory name: got %d bytes, want %d without the extension kept", len(got), maxComponentBytes)
+	}
+	// A multi-byte rune straddling the limit is dropped whole.
+	runes := strings.Repeat("é", 200) // 400 bytes
+	got := truncateComponent(runes, false)
+	if len(got) > maxComponentBytes || !strings.HasSuffix(got, "é") {
+		t.Errorf("got %d bytes ending %q, want at most %d on a rune boundary", len(got), got[len(got)-2:], maxComponentBytes)
+	}
+	// An over-long "extension" is not one.
+	odd := long + "." + strings.Repeat("x", 20)
+	if got := truncateComponent(odd, true); len(got) != maxComponentBytes {
+		t.Errorf("got %d bytes, want %d", len(got), maxComponentBytes)
+	}
+	if got := truncateComponent("short.mp3", true); got != "short.mp3" {
+		t.Errorf("short name changed to %q", got)
+	}
+}
+
+func TestRenderOutputPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("expectations use POSIX separators and sanitising")
+	}
+	fields := map[string]any{
+		"title":       "AC/DC: Thunder?",
+		"uploader":    "Some Band",
+		"ext":         "mp3",
+		"track":       float64(3),
+		"upload_date": "20240102",
+		"view_count":  float64(1234567),
+		"rating":      4.5,
+	}
+	tests := []struct {
+		tmpl, dir, want string
+	}{
+		{"{title}.{ext}", "", "AC_DC: Thunder?.mp3"},
+		{"{title}", "", "AC_DC: Thunder?.mp3"},
+		{"{uploader}/{track:02d} - {title}.{ext}", "", "Some Band/03 - AC_DC: Thunder?.mp3"},
+		{"{album}/{title}.{ext}", "", "AC_DC: Thunder?.mp3"},
+		{"{album|Singles}/{title}.{ext}", "/music", "/music/Singles/AC_DC: Thunder?.mp3"},
+		{"{view_count}-{rating:.2f}.{ext}", "out", "out/1234567-4.50.mp3"},
+		{"{missing:03d}{title}.{ext}", "", "AC_DC: Thunder?.mp3"},
+		{"/abs/{uploader}/{title}.{ext}", "ignored", "/abs/Some Band/AC_DC: Thunder?.mp3"},
+		{"{uploader}//{title}.{ext}", "", "Some Band/AC_DC: Thunder?.mp3"},
+	}
+	for _, tt := range tests {
+		got := renderOutputPath(tt.tmpl, tt.dir, fields)
+		if got != filepath.FromSlash(tt.want) {
+			t.Errorf("renderOutputPath(%q, %q) = %q, want %q", tt.tmpl, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestFormatField(t *testing.T) {
+	tests := []struct {
+		v    any
+		spec string
+		want string
+	}{
+		{nil, "", ""},
+		{float64(7), "", "7"},
+		{7.25, "", "7.25"},
+		{float64(7), "03d", "007"},
+		{"12", "03d", "012"},
+		{"twelve", "03d", ""},
+		{255, "x", "ff"},
+		{"2.5", ".1f", "2.5"},
+		{"text", "s", "text"},
+		{"text", "-6s", "text  "},
+	}
+	for _, tt := range tests {
+		if got := formatField(tt.v, tt.spec); got != tt.want {
+			t.Errorf("formatField(%v, %q) = %q, want %q", tt.v, tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestValidateOutputTemplate(t *testing.T) {
+	for _, tmpl := range []string{"{title}.{ext}", "{uploader}/{track:02d} - {title}", "{album|Singles}/{title}", "plain"} {
+		if err := validateOutputTemplate(tmpl); err != nil {
+			t.Errorf("validateOutputTemplate(%q) = %v, want nil", tmpl, err)
+		}
+	}
+	for _, tmpl := range []string{"{title", "title}", "{track:02q}", "{}", "{1abc}"} {
+		if err := validateOutputTemplate(tmpl); err == nil {
+			t.Errorf("validateOutputTemplate(%q) = nil, want an error", tmpl)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ─── Playlist Expansion ───────────────────────────────────────────────────────
+
+// maxPlaylistDepth bounds recursion for channels, whose flat listing is a
+// playlist of tabs (Videos, Shorts, …) that are themselves playlists.
+const maxPlaylistDepth = 3
+
+// ytdlpEntry mirrors the subset of yt-dlp's --flat-playlist JSON we use.
+type ytdlpEntry struct {
+	Type         string       `json:"_type"`
+	ID           string       `json:"id"`
+	Title        string       `json:"title"`
+	URL          string       `json:"url"`
+	WebpageURL   string       `json:"webpage_url"`
+	IEKey        string       `json:"ie_key"`
+	ExtractorKey string       `json:"extractor_key"`
+	Entries      []ytdlpEntry `json:"entries"`
+}
+
+func (e *ytdlpEntry) isPlaylist() bool {
+	return e.Type == "playlist" || e.Type == "multi_video" || e.IEKey == "YoutubeTab"
+}
+
+// entryURL prefers the canonical page URL; flat entries often only carry url.
+func (e *ytdlpEntry) entryURL() string {
+	if e.WebpageURL != "" {
+		return e.WebpageURL
+	}
+	return e.URL
+}
+
+// newJob creates a job for a single (non-playlist) entry.
+func (e *ytdlpEntry) newJob(url string) *job {
+	extractor := e.ExtractorKey
+	if extractor == "" {
+		extractor = e.IEKey
+	}
+	return &job{url: url, id: e.ID, extractor: extractor, title: e.Title}
+}
+
+// fetchFlat runs yt-dlp in flat-playlist mode and decodes its JSON. The raw
+// JSON is returned too: for a single video it is the full metadata record.
+func fetchFlat(ytdlpPath, url string) (*ytdlpEntry, []byte, error) {
+	debugLog("fetchFlat: %s", url)
+	out, err := outputCommand(newCommand(ytdlpPath, "--flat-playlist", "-J", "--", url))
+	if err != nil {
+		var ee *exec.ExitError
+		if errors.As(err, &ee) {
+			return nil, nil, ytdlpError(lastLine(string(ee.Stderr)), err)
+		}
+		return nil, nil, classify(classDependency, err)
+	}
+	var info ytdlpEntry
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil, nil, fmt.Errorf("parsing yt-dlp JSON: %w", err)
+	}
+	return &info, out, nil
+}
+
+// expandURL turns a playlist, channel or SoundCloud set URL into one job per
+// entry, numbered by position and tagged with the playlist title as album.
+// Single videos come back as a single untagged job.
+func expandURL(ytdlpPath, url string) ([]*job, error) {
+	info, raw, err := fetchFlat(ytdlpPath, url)
+	if err != nil {
+		return nil, err
+	}
+	if !info.isPlaylist() {
+		j := info.newJob(url)
+		j.prefetched = raw
+		return []*job{j}, nil
+	}
+	return expandEntries(ytdlpPath, info, 1)
+}
+
+func expandEntries(ytdlpPath string, list *ytdlpEntry, depth int) ([]*job, error) {
+	debugLog("expandEntries: %q (%d entries, depth %d)", list.Title, len(list.Entries), depth)
+
+	var jobs, tracks []*job
+	for i := range list.Entries {
+		e := &list.Entries[i]
+		if !e.isPlaylist() {
+			j := e.newJob(e.entryURL())
+			j.album = list.Title
+			jobs = append(jobs, j)
+			tracks = append(tracks, j)
+			continue
+		}
+		if depth >= maxPlaylistDepth {
+			debugLog("Skipping nested playlist %q: depth limit reached", e.Title)
+			continue
+		}
+
+		// Flat listings usually reference nested playlists by URL only.
+		nested := e
+		if len(e.Entries) == 0 {
+			fetched, _, err := fetchFlat(ytdlpPath, e.entryURL())
+			if err != nil {
+				return nil, fmt.Errorf("expanding %s: %w", e.entryURL(), err)
+			}
+			nested = fetched
+		}
+		sub, err := expandEntries(ytdlpPath, nested, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, sub...)
+	}
+
+	// Track numbers follow the order within the innermost playlist.
+	for n, j := range tracks {
+		j.track, j.trackTotal = n+1, len(tracks)
+	}
+	return jobs, nil
+}
+
+// lastLine returns the final non-empty line of s, used to surface yt-dlp's
+// ERROR message rather than its entire stderr.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
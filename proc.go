@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"sync"
+)
+
+// ─── Child Processes ──────────────────────────────────────────────────────────
+
+// procs tracks running yt-dlp / ffmpeg processes so that a Ctrl-C can be
+// forwarded to them. Each child runs in its own process group (see
+// proc_unix.go), so the terminal's SIGINT reaches only streamline, which then
+// decides how to stop them.
+var procs = &procTable{cmds: map[*exec.Cmd]struct{}{}}
+
+type procTable struct {
+	mu   sync.Mutex
+	cmds map[*exec.Cmd]struct{}
+}
+
+// terminateAll signals every tracked process group: politely first, with
+// force on a second interrupt.
+func (t *procTable) terminateAll(force bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for cmd := range t.cmds {
+		debugLog("Terminating PID %d (force=%v)", cmd.Process.Pid, force)
+		if err := terminateProcess(cmd.Process, force); err != nil {
+			debugLog("terminate PID %d: %v", cmd.Process.Pid, err)
+		}
+	}
+}
+
+// newCommand is exec.Command plus the platform process-group setup.
+func newCommand(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	setProcessGroup(cmd)
+	return cmd
+}
+
+// startCommand starts cmd and tracks it until waitCommand. Nothing new is
+// started once the user has cancelled. The check happens under procs.mu,
+// which the signal handler takes after raising the flag, so a child can
+// never slip past both the check and terminateAll.
+func startCommand(cmd *exec.Cmd) error {
+	procs.mu.Lock()
+	defer procs.mu.Unlock()
+	if cancelled() {
+		return errCancelled
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	procs.cmds[cmd] = struct{}{}
+	return nil
+}
+
+// waitCommand waits for cmd and stops tracking it. A process that died
+// because we were cancelled reports errCancelled rather than its exit status.
+func waitCommand(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	procs.mu.Lock()
+	delete(procs.cmds, cmd)
+	procs.mu.Unlock()
+	if err != nil && cancelled() {
+		return errCancelled
+	}
+	return err
+}
+
+// runCommand is cmd.Run with tracking.
+func runCommand(cmd *exec.Cmd) error {
+	if err := startCommand(cmd); err != nil {
+		return err
+	}
+	return waitCommand(cmd)
+}
+
+// outputCommand is cmd.Output with tracking. As with cmd.Output, a non-zero
+// exit returns an *exec.ExitError whose Stderr holds the captured output.
+func outputCommand(cmd *exec.Cmd) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := runCommand(cmd)
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		ee.Stderr = stderr.Bytes()
+	}
+	return stdout.Bytes(), err
+}
+
+// combinedOutputCommand is cmd.CombinedOutput with tracking.
+func combinedOutputCommand(cmd *exec.Cmd) ([]byte, error) {
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := runCommand(cmd)
+	return out.Bytes(), err
+}
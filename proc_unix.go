@@ -0,0 +1,31 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup puts the child in its own process group so the terminal's
+// Ctrl-C is delivered to streamline alone, and so that terminateProcess can
+// reach ffmpeg processes spawned by yt-dlp as well.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateProcess signals the child's whole process group: SIGTERM first,
+// SIGKILL when forced.
+func terminateProcess(p *os.Process, force bool) error {
+	sig := syscall.SIGTERM
+	if force {
+		sig = syscall.SIGKILL
+	}
+	return syscall.Kill(-p.Pid, sig)
+}
+
+// shellCommand runs script through /bin/sh.
+func shellCommand(script string) *exec.Cmd {
+	return newCommand("/bin/sh", "-c", script)
+}
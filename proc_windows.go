@@ -0,0 +1,33 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup detaches the child from the console's Ctrl-C group so that
+// streamline decides how it is stopped.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// terminateProcess kills the child and its descendants. Windows has no
+// SIGTERM equivalent for console programs, so force makes no difference.
+func terminateProcess(p *os.Process, force bool) error {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(p.Pid)).Run(); err != nil {
+		return p.Kill()
+	}
+	return nil
+}
+
+// shellCommand runs script through cmd.exe. The command line is passed
+// verbatim: Go's argument quoting does not match cmd's own rules.
+func shellCommand(script string) *exec.Cmd {
+	cmd := newCommand("cmd.exe")
+	cmd.SysProcAttr.CmdLine = `cmd.exe /S /C "` + script + `"`
+	return cmd
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ─── Video Quality Presets ────────────────────────────────────────────────────
+
+// videoPreset is one entry of the quality menu and of --quality. Presets are
+// described by a height cap rather than a literal format string so that
+// --max-height and --prefer-codec can be folded in; adding a preset is a
+// single line in videoPresets.
+type videoPreset struct {
+	name      string // value accepted by --quality
+	label     string // text shown in the interactive menu
+	maxHeight int    // 0 means no cap
+}
+
+var videoPresets = []videoPreset{
+	{"best", "Best Quality (Auto)", 0},
+	{"1080p", "1080p", 1080},
+	{"720p", "720p", 720},
+	{"480p", "480p", 480},
+	{"360p", "360p", 360},
+}
+
+// videoCodecs maps --prefer-codec values to yt-dlp vcodec prefixes.
+var videoCodecs = map[string][]string{
+	"avc":  {"avc1", "h264"},
+	"h264": {"avc1", "h264"},
+	"hevc": {"hvc1", "hev1", "h265"},
+	"vp9":  {"vp09", "vp9"},
+	"av1":  {"av01"},
+}
+
+// findVideoPreset looks a preset up by its --quality name.
+func findVideoPreset(name string) (videoPreset, bool) {
+	for _, p := range videoPresets {
+		if strings.EqualFold(p.name, name) {
+			return p, true
+		}
+	}
+	return videoPreset{}, false
+}
+
+// videoPresetNames lists the --quality values for help and error messages.
+func videoPresetNames() []string {
+	names := make([]string, len(videoPresets))
+	for i, p := range videoPresets {
+		names[i] = p.name
+	}
+	return names
+}
+
+// buildVideoFormat turns a height cap and codec preference into a yt-dlp
+// format spec. A preferred codec is tried first and falls back to any codec,
+// then to a pre-merged single file, so a preference never makes the
+// download fail.
+func buildVideoFormat(maxHeight int, codec string) string {
+	height := ""
+	if maxHeight > 0 {
+		height = fmt.Sprintf("[height<=%d]", maxHeight)
+	}
+	var alts []string
+	for _, prefix := range videoCodecs[codec] {
+		alts = append(alts, fmt.Sprintf("bestvideo[vcodec^=%s]%s+bestaudio", prefix, height))
+	}
+	alts = append(alts, "bestvideo"+height+"+bestaudio", "best"+height)
+	return strings.Join(alts, "/")
+}
+
+// validateVideoOptions checks the quality flags before any work starts.
+func validateVideoOptions() error {
+	if opts.format != "" && (opts.quality != "" || opts.maxHeight > 0 || opts.preferCodec != "") {
+		return fmt.Errorf("--format cannot be combined with --quality, --max-height or --prefer-codec")
+	}
+	for _, q := range []string{opts.quality, opts.defaultQuality} {
+		if _, ok := findVideoPreset(q); q != "" && !ok {
+			return fmt.Errorf("unknown quality %q (want %s)", q, strings.Join(videoPresetNames(), ", "))
+		}
+	}
+	if opts.maxHeight < 0 {
+		return fmt.Errorf("--max-height must be positive")
+	}
+	if _, ok := videoCodecs[opts.preferCodec]; opts.preferCodec != "" && !ok {
+		return fmt.Errorf("unknown codec %q (want avc, hevc, vp9 or av1)", opts.preferCodec)
+	}
+	return nil
+}
+
+// videoFormatFromFlags resolves the format without prompting. ok is false
+// when nothing on the command line decides it and stdin can take a prompt.
+// A dry run never prompts.
+func videoFormatFromFlags() (format, label string, ok bool) {
+	if opts.format != "" {
+		return opts.format, "custom format " + opts.format, true
+	}
+
+	name := opts.quality
+	if name == "" && (opts.maxHeight > 0 || opts.preferCodec != "") {
+		name = "best"
+	}
+	if name == "" && (opts.dryRun || !stdinIsTerminal()) {
+		name = opts.defaultQuality
+		debugLog("No prompt possible; using default quality %q", name)
+	}
+	if name == "" {
+		return "", "", false
+	}
+
+	preset, _ := findVideoPreset(name)
+	height := preset.maxHeight
+	if opts.maxHeight > 0 && (height == 0 || opts.maxHeight < height) {
+		height = opts.maxHeight
+	}
+	label = preset.label
+	if height != preset.maxHeight {
+		label = fmt.Sprintf("%s, max %dp", label, height)
+	}
+	if opts.preferCodec != "" {
+		label += ", prefer " + opts.preferCodec
+	}
+	return buildVideoFormat(height, opts.preferCodec), label, true
+}
+
+// ─── Video Container ──────────────────────────────────────────────────────────
+
+// mergeOutputFormats is passed to yt-dlp's --merge-output-format: separate
+// video and audio streams are merged into MP4 when both fit it, WebM for
+// VP9/AV1 with Opus or Vorbis, and Matroska otherwise.
+const mergeOutputFormats = "mp4/webm/mkv"
+
+// mergeContainers lists the codecs each merge container holds, in the order
+// yt-dlp tries them.
+var mergeContainers = []struct {
+	ext    string
+	codecs []string
+}{
+	{"mp4", []string{"avc1", "h264", "hvc1", "hev1", "h265", "av01", "mp4a"}},
+	{"webm", []string{"vp09", "vp9", "vp8", "av01", "opus", "vorbis"}},
+}
+
+// videoExtensions are the containers a video download may end up in.
+var videoExtensions = []string{"mp4", "webm", "mkv", "mov", "m4v", "flv", "3gp"}
+
+// predictVideoExt is the extension yt-dlp will give the download of spec:
+// the format's own for a single stream, the merge container for several.
+// Specs whose selection cannot be followed here fall back to the extension
+// of yt-dlp's default pick.
+func predictVideoExt(j *job, spec string) string {
+	for _, alt := range strings.Split(spec, "/") {
+		var streams []*ytdlpFormat
+		for _, part := range strings.Split(alt, "+") {
+			f, known := selectFormat(j.formats, strings.TrimSpace(part))
+			if !known {
+				return infoString(j.info, "ext")
+			}
+			if f == nil {
+				streams = nil
+				break
+			}
+			streams = append(streams, f)
+		}
+		switch len(streams) {
+		case 0:
+			continue
+		case 1:
+			return streams[0].Ext
+		}
+		return mergeExt(streams)
+	}
+	return infoString(j.info, "ext")
+}
+
+// selectFormat follows one part of a format spec: a format ID, or best,
+// bestvideo or bestaudio with vcodec^= and height<= filters, the ones
+// buildVideoFormat writes. It returns nil when nothing matches and known
+// false for a part it cannot follow.
+func selectFormat(formats []ytdlpFormat, part string) (f *ytdlpFormat, known bool) {
+	name, filters, _ := strings.Cut(part, "[")
+	if !formatSelectors[name] {
+		if filters != "" {
+			return nil, false
+		}
+		for i := range formats {
+			if formats[i].ID == name {
+				return &formats[i], true
+			}
+		}
+		return nil, true
+	}
+
+	codec, height := "", 0
+	if filters != "" {
+		for _, filter := range strings.Split(strings.TrimSuffix(filters, "]"), "][") {
+			switch {
+			case strings.HasPrefix(filter, "vcodec^="):
+				codec = strings.TrimPrefix(filter, "vcodec^=")
+			case strings.HasPrefix(filter, "height<="):
+				n, err := strconv.Atoi(strings.TrimPrefix(filter, "height<="))
+				if err != nil {
+					return nil, false
+				}
+				height = n
+			default:
+				return nil, false
+			}
+		}
+	}
+	for i := range formats {
+		c := &formats[i]
+		switch name {
+		case "best", "b":
+			if !c.hasVideo() || !c.hasAudio() {
+				continue
+			}
+		case "bestvideo", "bv":
+			if !c.hasVideo() || c.hasAudio() {
+				continue
+			}
+		case "bestaudio", "ba":
+			if c.hasVideo() || !c.hasAudio() {
+				continue
+			}
+		default:
+			return nil, false
+		}
+		if !strings.HasPrefix(c.VCodec, codec) || (height > 0 && c.Height > height) {
+			continue
+		}
+		if f == nil || c.Height > f.Height || (c.Height == f.Height && c.bitrate() > f.bitrate()) {
+			f = c
+		}
+	}
+	return f, true
+}
+
+// mergeExt picks the first merge container that holds every stream.
+func mergeExt(streams []*ytdlpFormat) string {
+next:
+	for _, c := range mergeContainers {
+		for _, s := range streams {
+			for _, codec := range []string{s.VCodec, s.ACodec} {
+				if codec == "" || codec == "none" {
+					continue
+				}
+				if !hasAnyPrefix(codec, c.codecs) {
+					continue next
+				}
+			}
+		}
+		return c.ext
+	}
+	return "mkv"
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// findVideoFile finds the finished download in dir, preferring a file with
+// the predicted extension.
+func findVideoFile(dir, ext string) (string, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	var found string
+	for _, e := range entries {
+		name := e.Name()
+		got := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+		if e.IsDir() || !containsString(videoExtensions, got) {
+			continue
+		}
+		if got == ext {
+			return filepath.Join(dir, name), true
+		}
+		if found == "" {
+			found = filepath.Join(dir, name)
+		}
+	}
+	return found, found != ""
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestPredictVideoExt(t *testing.T) {
+	j := &job{
+		info: map[string]any{"ext": "mp4"},
+		formats: []ytdlpFormat{
+			{ID: "140", Ext: "m4a", VCodec: "none", ACodec: "mp4a.40.2", ABR: 129.5},
+			{ID: "251", Ext: "webm", VCodec: "none", ACodec: "opus", ABR: 140.1},
+			{ID: "137", Ext: "mp4", VCodec: "avc1.640028", ACodec: "none", Height: 1080, TBR: 4400},
+			{ID: "248", Ext: "webm", VCodec: "vp09.00.40.08", ACodec: "none", Height: 1080, TBR: 2600},
+			{ID: "18", Ext: "mp4", VCodec: "avc1.42001E", ACodec: "mp4a.40.2", Height: 360, TBR: 500},
+		},
+	}
+	tests := []struct {
+		spec, want string
+	}{
+		{"137+140", "mp4"},
+		{"248+251", "webm"},
+		{"137+251", "mkv"},
+		{"248+140", "mkv"},
+		{"18", "mp4"},
+		{"999+140/248+251", "webm"},
+		{buildVideoFormat(0, "vp9"), "webm"},
+		{buildVideoFormat(720, "vp9"), "mp4"},  // nothing under 720p but the muxed 18
+		{buildVideoFormat(0, "avc"), "mkv"},    // bestaudio is the Opus stream
+		{"bestvideo[fps>30]+bestaudio", "mp4"}, // unknown filter: yt-dlp's default
+	}
+	for _, tt := range tests {
+		if got := predictVideoExt(j, tt.spec); got != tt.want {
+			t.Errorf("predictVideoExt(%q) = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ─── Serve ────────────────────────────────────────────────────────────────────
+
+// serve keeps streamline running and takes downloads over a small JSON API,
+// for browser extensions and scripts that would otherwise start a process
+// per URL. There is no authentication, so it listens on loopback unless told
+// otherwise, and turns away web pages: a POST must be JSON, which a page
+// cannot send cross-site without a preflight, and carry no foreign Origin.
+
+const (
+	defaultListen = "127.0.0.1:8765"
+
+	// serveQueueSize is how many requests may wait for the downloader before
+	// POST /downloads answers 503.
+	serveQueueSize = 100
+)
+
+// Request states, in the order a request passes through them.
+const (
+	requestQueued    = "queued"
+	requestRunning   = "running"
+	requestFinished  = "finished"
+	requestFailed    = "failed"
+	requestCancelled = "cancelled"
+)
+
+// serveRequest is one POST /downloads and what became of it. A playlist URL
+// expands into several items.
+type serveRequest struct {
+	ID     int         `json:"id"`
+	URL    string      `json:"url"`
+	Mode   string      `json:"mode"`
+	Status string      `json:"status"`
+	Error  string      `json:"error,omitempty"`
+	Items  []serveItem `json:"items,omitempty"`
+}
+
+type serveItem struct {
+	URL    string `json:"url"`
+	Title  string `json:"title,omitempty"`
+	Status string `json:"status"` // done, skipped or failed
+	Path   string `json:"path,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// server runs the requests one after another, each as a batch on --jobs
+// workers, so the download settings and the terminal are shared the same way
+// as in a single run.
+type server struct {
+	ytdlpPath, ffmpegPath, workDir string
+	workers                        int
+	hosts                          []string // the listen address as a browser may name it
+
+	mu       sync.Mutex
+	requests []*serveRequest
+	queue    chan *serveRequest
+}
+
+func runServe(cmd *command, args []string) int {
+	fs, cli := newFlagSet("streamline "+cmd.name, cmd.flags, &opts)
+	fs.Usage = func() { commandUsage(cmd, fs) }
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if len(positional) > 0 {
+		printStatus("error", "serve takes no URLs; POST them to /downloads")
+		return exitUsage
+	}
+	if err := loadSettings(fs, cli); err != nil {
+		printStatus("error", err.Error())
+		return exitUsage
+	}
+	if err := validateDownloadOptions(cli); err != nil {
+		printStatus("error", err.Error())
+		return exitUsage
+	}
+	host, _, err := net.SplitHostPort(*cli.listen)
+	if err != nil {
+		printStatus("error", fmt.Sprintf("--listen: %v", err))
+		return exitUsage
+	}
+	noPrompts = true
+
+	ytdlpPath, ffmpegPath, workDir, code, ok := startDownloads(cli)
+	if !ok {
+		return code
+	}
+	ln, err := net.Listen("tcp", *cli.listen)
+	if err != nil {
+		printStatus("error", err.Error())
+		return exitNetwork
+	}
+	if !isLoopback(host) {
+		printStatus("warning", fmt.Sprintf("Listening on %s: anyone who can reach it can start downloads", ln.Addr()))
+	}
+
+	s := &server{
+		ytdlpPath: ytdlpPath, ffmpegPath: ffmpegPath, workDir: workDir,
+		workers: *cli.workers,
+		hosts:   []string{*cli.listen, ln.Addr().String()},
+		queue:   make(chan *serveRequest, serveQueueSize),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for req := range s.queue {
+			s.run(req)
+		}
+	}()
+
+	// Serve returns as soon as Shutdown starts; the queue may only close
+	// once Shutdown has seen the last handler out.
+	srv := &http.Server{Handler: s.handler()}
+	stopped := make(chan struct{})
+	go func() {
+		<-interrupted
+		srv.Shutdown(context.Background())
+		close(stopped)
+	}()
+	printStatus("info", fmt.Sprintf("Accepting downloads on %shttp://%s/downloads%s", colorBold, ln.Addr(), colorReset))
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		printStatus("error", err.Error())
+		return exitNetwork
+	}
+	<-stopped
+	close(s.queue)
+	<-done
+	return exitCancelled
+}
+
+// isLoopback reports whether host only accepts connections from this
+// machine. An empty host listens on every interface.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handler routes the API:
+//
+//	POST /downloads       {"url": "...", "mode": "audio"|"video"} → 202 and the request
+//	GET  /downloads       every request so far
+//	GET  /downloads/{id}  one request
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/downloads", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			s.create(w, r)
+		case http.MethodGet:
+			s.mu.Lock()
+			list := make([]serveRequest, len(s.requests))
+			for i, req := range s.requests {
+				list[i] = req.snapshot()
+			}
+			s.mu.Unlock()
+			writeJSON(w, http.StatusOK, list)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+	mux.HandleFunc("/downloads/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/downloads/"))
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err != nil || id < 1 || id > len(s.requests) {
+			writeError(w, http.StatusNotFound, "no such download")
+			return
+		}
+		writeJSON(w, http.StatusOK, s.requests[id-1].snapshot())
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.sameOrigin(r.Header.Get("Origin")) {
+			writeError(w, http.StatusForbidden, "cross-origin requests are not allowed")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin reports whether a request's Origin, set by browsers only, is
+// the API's own address. curl and other tools send none.
+func (s *server) sameOrigin(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Scheme == "http" && slices.Contains(s.hosts, u.Host)
+}
+
+// checkRequestURL accepts absolute web addresses only, so a request can
+// neither pass yt-dlp an option nor point it at a local file.
+func checkRequestURL(raw string) error {
+	if strings.HasPrefix(raw, "-") {
+		return errors.New(`"url" must not start with "-"`)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf(`"url" must be an absolute http or https URL, not %q`, raw)
+	}
+	return nil
+}
+
+func (s *server) create(w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	}
+	var body struct {
+		URL  string `json:"url"`
+		Mode string `json:"mode"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON: %v", err))
+		return
+	}
+	body.URL = strings.TrimSpace(body.URL)
+	if body.URL == "" {
+		writeError(w, http.StatusBadRequest, `"url" is required`)
+		return
+	}
+	if err := checkRequestURL(body.URL); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch body.Mode {
+	case "":
+		body.Mode = "audio"
+	case "audio", "video":
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf(`"mode" must be audio or video, not %q`, body.Mode))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req := &serveRequest{ID: len(s.requests) + 1, URL: body.URL, Mode: body.Mode, Status: requestQueued}
+	select {
+	case s.queue <- req:
+	default:
+		writeError(w, http.StatusServiceUnavailable, "too many downloads waiting; try again later")
+		return
+	}
+	s.requests = append(s.requests, req)
+	debugLog("serve: request %d queued: %s (%s)", req.ID, req.URL, req.Mode)
+	writeJSON(w, http.StatusAccepted, req.snapshot())
+}
+
+// run resolves and downloads one request, in its own work directory so
+// item directories of successive requests never meet.
+func (s *server) run(req *serveRequest) {
+	s.update(func() { req.Status = requestRunning })
+	download := audioDownload
+	if req.Mode == "video" {
+		download = videoDownload
+	}
+
+	jobs, results := planJobs(s.ytdlpPath, []string{req.URL})
+	if len(jobs) > 0 {
+		dir := filepath.Join(s.workDir, fmt.Sprintf("request-%d", req.ID))
+		results = append(results, runBatch(jobs, s.workers, download, s.ytdlpPath, s.ffmpegPath, dir)...)
+	}
+
+	items := make([]serveItem, len(results))
+	failed := 0
+	for i, res := range results {
+		item := serveItem{URL: res.job.url, Title: res.job.title, Status: "done"}
+		if res.output != "" {
+			// Clients may not share serve's working directory.
+			item.Path, _ = filepath.Abs(res.output)
+		}
+		switch {
+		case errors.Is(res.err, errSkipped):
+			item.Status, item.Path = "skipped", ""
+		case res.err != nil:
+			item.Status, item.Error = "failed", stripANSI(res.err.Error())
+			failed++
+		}
+		items[i] = item
+	}
+	s.update(func() {
+		req.Items = items
+		switch {
+		case cancelled():
+			req.Status = requestCancelled
+		case failed > 0 && failed == len(items):
+			req.Status = requestFailed
+			if len(items) == 1 {
+				req.Error = items[0].Error
+			}
+		default:
+			req.Status = requestFinished
+		}
+	})
+	debugLog("serve: request %d %s", req.ID, req.Status)
+}
+
+// update changes request state under the lock the handlers read it with.
+func (s *server) update(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+}
+
+// snapshot copies req for encoding outside the lock. Items are replaced
+// whole, never changed in place, so sharing the slice is safe.
+func (req *serveRequest) snapshot() serveRequest {
+	return *req
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		debugLog("serve: writing response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
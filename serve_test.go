@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeCreate(t *testing.T) {
+	const jsonType = "application/json"
+	tests := []struct {
+		body, contentType, origin string
+		want                      int
+	}{
+		{`{"url": "https://youtu.be/x"}`, jsonType, "", http.StatusAccepted},
+		{`{"url": " http://example.com/v ", "mode": "video"}`, "application/json; charset=utf-8", "", http.StatusAccepted},
+		{`{"url": "https://youtu.be/x"}`, jsonType, "http://127.0.0.1:8765", http.StatusAccepted},
+		{`{"url": "https://youtu.be/x"}`, jsonType, "http://localhost:8765", http.StatusAccepted},
+
+		{`{"url": "https://youtu.be/x"}`, "", "", http.StatusUnsupportedMediaType},
+		{`{"url": "https://youtu.be/x"}`, "text/plain", "", http.StatusUnsupportedMediaType},
+		{`{"url": "https://youtu.be/x"}`, "application/x-www-form-urlencoded", "", http.StatusUnsupportedMediaType},
+		{`{"url": "https://youtu.be/x"}`, jsonType, "https://evil.example", http.StatusForbidden},
+		{`{"url": "https://youtu.be/x"}`, jsonType, "http://127.0.0.1:9000", http.StatusForbidden},
+		{`{"url": "https://youtu.be/x"}`, jsonType, "null", http.StatusForbidden},
+
+		{`{"url": "--exec=touch /tmp/x"}`, jsonType, "", http.StatusBadRequest},
+		{`{"url": "-o/tmp/x"}`, jsonType, "", http.StatusBadRequest},
+		{`{"url": "file:///etc/passwd"}`, jsonType, "", http.StatusBadRequest},
+		{`{"url": "youtu.be/x"}`, jsonType, "", http.StatusBadRequest},
+		{`{"url": "https://"}`, jsonType, "", http.StatusBadRequest},
+		{`{"url": ""}`, jsonType, "", http.StatusBadRequest},
+		{`{"url": "https://youtu.be/x", "mode": "both"}`, jsonType, "", http.StatusBadRequest},
+		{`{"url": `, jsonType, "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		s := &server{queue: make(chan *serveRequest, 1), hosts: []string{"localhost:8765", "127.0.0.1:8765"}}
+		r := httptest.NewRequest(http.MethodPost, "/downloads", strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		w := httptest.NewRecorder()
+		s.handler().ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("POST %s (%q, Origin %q) = %d, want %d: %s", tt.body, tt.contentType, tt.origin, w.Code, tt.want, w.Body)
+		}
+		if queued := len(s.queue) == 1; queued != (tt.want == http.StatusAccepted) {
+			t.Errorf("POST %s (%q, Origin %q): queued = %v", tt.body, tt.contentType, tt.origin, queued)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// ─── Interrupts & Cleanup ─────────────────────────────────────────────────────
+
+// errCancelled is returned by anything stopped because the user interrupted.
+var errCancelled error = &classedError{class: classCancelled, err: errors.New("cancelled by user")}
+
+// interrupts counts SIGINT/SIGTERM deliveries.
+var interrupts atomic.Int32
+
+// interrupted is closed on the first interrupt, for code that waits rather
+// than polls cancelled().
+var interrupted = make(chan struct{})
+
+// cancelled reports whether the user has asked streamline to stop.
+func cancelled() bool {
+	return interrupts.Load() > 0
+}
+
+// cleanups run once, in reverse order of registration, either when run()
+// returns or when a second interrupt forces an immediate exit. They replace
+// plain defers, which os.Exit would skip.
+var cleanups struct {
+	mu   sync.Mutex
+	fns  []func()
+	done bool
+}
+
+// atCleanup registers fn to run on exit.
+func atCleanup(fn func()) {
+	cleanups.mu.Lock()
+	defer cleanups.mu.Unlock()
+	cleanups.fns = append(cleanups.fns, fn)
+}
+
+// runCleanups runs the registered cleanups; later calls do nothing.
+func runCleanups() {
+	cleanups.mu.Lock()
+	defer cleanups.mu.Unlock()
+	if cleanups.done {
+		return
+	}
+	cleanups.done = true
+	for i := len(cleanups.fns) - 1; i >= 0; i-- {
+		cleanups.fns[i]()
+	}
+}
+
+// handleInterrupts installs the SIGINT/SIGTERM handler. The first signal
+// stops new work and asks running children to terminate, letting the
+// download path unwind and clean up normally. A second signal kills the
+// children outright, cleans up and exits at once.
+func handleInterrupts() {
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range ch {
+			if interrupts.Add(1) == 1 {
+				debugLog("Received %v: cancelling", sig)
+				printStatus("warning", "Interrupted – stopping downloads (press Ctrl-C again to force quit)")
+				procs.terminateAll(false)
+				close(interrupted)
+				continue
+			}
+			debugLog("Received %v again: forcing exit", sig)
+			procs.terminateAll(true)
+			runCleanups()
+			term.restore()
+			os.Exit(exitCancelled)
+		}
+	}()
+}
@@ -10,38 +10,41 @@ import (
 	"runtime"
 )
 
+// bundledBuild reports whether yt-dlp and ffmpeg are embedded in the binary.
+const bundledBuild = false
+
 // resolveBinaries locates yt-dlp and ffmpeg on the system PATH.
 // This file is excluded when building with -tags bundled;
 // bins_bundled.go provides an alternative resolveBinaries that extracts
-// embedded binaries instead.
-func resolveBinaries() (ytdlpPath, ffmpegPath string, cleanup func()) {
+// embedded binaries instead. cleanup is always safe to call.
+func resolveBinaries() (ytdlpPath, ffmpegPath string, cleanup func(), err error) {
 	cleanup = func() {}
 
 	printStatus("info", "Resolving dependencies...")
 	debugLog("Looking up yt-dlp on PATH (GOOS=%s)", runtime.GOOS)
 
-	var err error
 	ytdlpPath, err = exec.LookPath(exeName("yt-dlp"))
 	if err != nil {
-		missingDepError("yt-dlp", "https://github.com/yt-dlp/yt-dlp")
+		return "", "", cleanup, missingDepError("yt-dlp", "https://github.com/yt-dlp/yt-dlp")
 	}
 	debugLog("yt-dlp found: %s", ytdlpPath)
 
 	debugLog("Looking up ffmpeg on PATH")
 	ffmpegPath, err = exec.LookPath(exeName("ffmpeg"))
 	if err != nil {
-		missingDepError("ffmpeg", "https://ffmpeg.org/download.html")
+		return "", "", cleanup, missingDepError("ffmpeg", "https://ffmpeg.org/download.html")
 	}
 	debugLog("ffmpeg found: %s", ffmpegPath)
 
 	printStatus("success", fmt.Sprintf("Dependencies OK  %s(yt-dlp: %s | ffmpeg: %s)%s",
 		colorDim, filepath.Base(ytdlpPath), filepath.Base(ffmpegPath), colorReset))
 
-	return ytdlpPath, ffmpegPath, cleanup
+	return ytdlpPath, ffmpegPath, cleanup, nil
 }
 
-// missingDepError prints a helpful install hint and exits.
-func missingDepError(name, installURL string) {
+// missingDepError prints a helpful install hint and returns a dependency
+// error for the caller to exit with.
+func missingDepError(name, installURL string) error {
 	var installHint string
 	switch runtime.GOOS {
 	case "linux":
@@ -94,5 +97,5 @@ func missingDepError(name, installURL string) {
 		colorYellow, colorReset,
 		colorBlue, releasesURL, colorReset,
 	)
-	os.Exit(1)
+	return classify(classDependency, fmt.Errorf("%s not found on PATH", name))
 }
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ─── Audio Tags ───────────────────────────────────────────────────────────────
+
+// audioTags are the fields streamline writes into an audio file. The tag
+// writers for ID3, Vorbis comments and MP4 atoms each map them to their
+// own names and leave any other tags in the file alone.
+type audioTags struct {
+	title, artist, albumArtist, album string
+	track, trackTotal                 int
+	disc, discTotal                   int
+	date                              string // release date: "2024" or "2024-01-02"
+	originalDate                      string // upload date: "2024-01-02"
+	genre                             string
+	comment                           string // source URL
+	custom                            []tagField
+	cover                             []byte // front cover JPEG or PNG; nil for none
+}
+
+// tagField is a free-form tag: a TXXX frame, a Vorbis comment or an iTunes
+// "----" atom.
+type tagField struct{ name, value string }
+
+// buildTags maps yt-dlp's metadata and the playlist the job came from onto
+// audio tags. Music uploads carry track, artist and album fields; for other
+// videos parseTitle finds them in the title, with the uploader as the
+// artist when the title names none.
+func buildTags(j *job) *audioTags {
+	t := &audioTags{
+		title:       infoText(j.info, "track"),
+		artist:      infoText(j.info, "artists", "artist", "creators", "creator"),
+		albumArtist: infoText(j.info, "album_artists", "album_artist"),
+		album:       infoText(j.info, "album"),
+		genre:       infoText(j.info, "genres", "genre"),
+		comment:     infoText(j.info, "webpage_url"),
+		track:       int(infoNumber(j.info, "track_number")),
+		disc:        int(infoNumber(j.info, "disc_number")),
+	}
+	channel := infoText(j.info, "uploader", "channel")
+	if t.title == "" {
+		// No music metadata: the song is in the upload title.
+		raw := infoText(j.info, "title")
+		if raw == "" {
+			raw = j.title
+		}
+		t.title = raw
+		if !opts.rawTitle && !isTopicChannel(channel) {
+			p := parseTitle(raw)
+			debugLog("parseTitle: %q → artist=%q featured=%q title=%q", raw, p.artist, p.featured, p.title)
+			t.title = p.title
+			if t.artist == "" {
+				t.artist = p.credit(channelArtist(channel))
+				if t.albumArtist == "" && j.album == "" {
+					// Guests appear on the track, not on the release.
+					t.albumArtist = p.artist
+					if t.albumArtist == "" {
+						t.albumArtist = channelArtist(channel)
+					}
+				}
+			}
+		}
+	}
+	if t.artist == "" {
+		t.artist = channelArtist(channel)
+	}
+	if t.comment == "" {
+		t.comment = j.url
+	}
+	if j.album != "" {
+		// A playlist's tracks have differing artists; only a single video
+		// can assume its artist is the album artist.
+		t.album, t.track, t.trackTotal = j.album, j.track, j.trackTotal
+	} else if t.albumArtist == "" {
+		t.albumArtist = t.artist
+	}
+
+	upload := infoDate(j.info, "upload_date")
+	switch {
+	case infoDate(j.info, "release_date") != "":
+		t.date = infoDate(j.info, "release_date")
+	case infoNumber(j.info, "release_year") > 0:
+		t.date = strconv.Itoa(int(infoNumber(j.info, "release_year")))
+	default:
+		t.date = upload
+	}
+	t.originalDate = upload
+
+	if opts.encoding.preset != "" {
+		t.custom = append(t.custom, tagField{"STREAMLINE_PRESET", opts.encoding.preset})
+	}
+	t.custom = append(t.custom, tagField{"STREAMLINE_ENCODING", opts.encoding.describe()})
+	return t
+}
+
+// infoText returns the first non-empty string among keys. List fields
+// such as "artists" are joined with commas.
+func infoText(info map[string]any, keys ...string) string {
+	for _, k := range keys {
+		switch v := info[k].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case []any:
+			var parts []string
+			for _, p := range v {
+				if s, ok := p.(string); ok && s != "" {
+					parts = append(parts, s)
+				}
+			}
+			if len(parts) > 0 {
+				return strings.Join(parts, ", ")
+			}
+		}
+	}
+	return ""
+}
+
+// infoDate turns one of yt-dlp's YYYYMMDD dates into YYYY-MM-DD.
+func infoDate(info map[string]any, key string) string {
+	d := infoString(info, key)
+	if len(d) != 8 {
+		return ""
+	}
+	return d[:4] + "-" + d[4:6] + "-" + d[6:]
+}
+
+// numberPair renders a track or disc number as "3/12", or "3" when the
+// total is unknown.
+func numberPair(n, total int) string {
+	if total > 0 {
+		return fmt.Sprintf("%d/%d", n, total)
+	}
+	return strconv.Itoa(n)
+}
+
+// year is the leading year of a "2024-01-02" or "2024" date.
+func year(date string) string {
+	if len(date) >= 4 {
+		return date[:4]
+	}
+	return ""
+}
+
+// fields lists the tags under ffmpeg's generic names, for the dry-run plan
+// and for containers without a native writer.
+func (t *audioTags) fields() []tagField {
+	var list []tagField
+	add := func(name, value string) {
+		if value != "" {
+			list = append(list, tagField{name, value})
+		}
+	}
+	add("title", t.title)
+	add("artist", t.artist)
+	add("album_artist", t.albumArtist)
+	add("album", t.album)
+	if t.track > 0 {
+		add("track", numberPair(t.track, t.trackTotal))
+	}
+	if t.disc > 0 {
+		add("disc", numberPair(t.disc, t.discTotal))
+	}
+	add("date", t.date)
+	add("original_date", t.originalDate)
+	add("genre", t.genre)
+	add("comment", t.comment)
+	return append(list, t.custom...)
+}
+
+// ─── Writing Tags ─────────────────────────────────────────────────────────────
+
+// writeTags writes tags (and the cover, if any) into audioFile, rewriting
+// the file once. MP3, MP4, FLAC and Ogg are tagged in-process; other
+// containers go through an ffmpeg copy that cannot carry the cover, which
+// is then dropped with a warning.
+func writeTags(j *job, ffmpegPath, audioFile string, format audioFormat, tags *audioTags) error {
+	debugLog("writeTags: %s (%s) %v cover=%d bytes", audioFile, format.name, tags.fields(), len(tags.cover))
+	emit(j, evPostprocess, map[string]any{"step": "tags"})
+
+	var write func(r *os.File, w io.Writer, tags *audioTags) error
+	switch format.muxer {
+	case "mp3":
+		write = writeID3
+	case "ipod":
+		write = writeMP4Tags
+	case "flac":
+		write = writeFLACTags
+	case "ogg":
+		write = writeOggTags
+	default:
+		if tags.cover != nil {
+			j.status("warning", fmt.Sprintf("%s files are tagged through ffmpeg, which cannot embed cover art; skipping the cover",
+				strings.ToUpper(format.ext)))
+		}
+		return writeTagsFFmpeg(ffmpegPath, audioFile, format, tags)
+	}
+	err := rewriteFile(audioFile, func(r *os.File, w io.Writer) error { return write(r, w, tags) })
+	if err == nil {
+		return nil
+	}
+	debugLog("native tag writer: %v", err)
+	j.status("warning", fmt.Sprintf("Could not tag %s in place (%v); falling back to ffmpeg without cover art",
+		strings.ToUpper(format.ext), err))
+	return writeTagsFFmpeg(ffmpegPath, audioFile, format, tags)
+}
+
+// rewriteFile streams path through write into a temp file beside it and
+// renames that over path once write succeeds.
+func rewriteFile(path string, write func(r *os.File, w io.Writer) error) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return classify(classFilesystem, err)
+	}
+	defer in.Close()
+	tempFile := path + ".temp"
+	out, err := os.Create(tempFile)
+	if err != nil {
+		return classify(classFilesystem, err)
+	}
+	bw := bufio.NewWriterSize(out, 256*1024)
+	err = write(in, bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	in.Close()
+	if err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	return classify(classFilesystem, os.Rename(tempFile, path))
+}
+
+// writeTagsFFmpeg copies audioFile through ffmpeg with the tags as
+// -metadata options; used for WAV and containers streamline cannot parse.
+// The temporary copy keeps the extension so that ffmpeg can pick the muxer
+// from it when the format has none.
+func writeTagsFFmpeg(ffmpegPath, audioFile string, format audioFormat, tags *audioTags) error {
+	ext := filepath.Ext(audioFile)
+	tempFile := strings.TrimSuffix(audioFile, ext) + ".temp" + ext
+	args := []string{"-i", audioFile, "-map", "0", "-c", "copy"}
+	for _, f := range tags.fields() {
+		args = append(args, "-metadata", f.name+"="+f.value)
+	}
+	args = append(args, format.muxerArgs()...)
+	args = append(args, "-y", "-loglevel", "error")
+	if format.muxer != "" {
+		args = append(args, "-f", format.muxer)
+	}
+	args = append(args, tempFile)
+	if err := runCommand(newCommand(ffmpegPath, args...)); err != nil {
+		debugLog("writeTagsFFmpeg error: %v", err)
+		os.Remove(tempFile)
+		return classify(classPostprocess, fmt.Errorf("writing tags: %w", err))
+	}
+	return classify(classFilesystem, os.Rename(tempFile, audioFile))
+}
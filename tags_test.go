@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// runWriter runs a tag writer over in, as rewriteFile would, and returns
+// what it wrote.
+func runWriter(t *testing.T, write func(r *os.File, w io.Writer, tags *audioTags) error, in []byte, tags *audioTags) ([]byte, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "in")
+	if err := os.WriteFile(path, in, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out bytes.Buffer
+	err = write(f, &out, tags)
+	return out.Bytes(), err
+}
+
+// rewrite is runWriter for input the writer must accept.
+func rewrite(t *testing.T, write func(r *os.File, w io.Writer, tags *audioTags) error, in []byte, tags *audioTags) []byte {
+	t.Helper()
+	out, err := runWriter(t, write, in, tags)
+	if err != nil {
+		t.Fatalf("writing tags: %v", err)
+	}
+	return out
+}
+
+// testCover is a small PNG with pad bytes after it; the writers only read
+// the image header, so pad grows the cover without a bigger image.
+func testCover(t *testing.T, pad int) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewGray(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+	return append(b.Bytes(), make([]byte, pad)...)
+}
+
+func TestAudioTagsFields(t *testing.T) {
+	tags := &audioTags{title: "Song", artist: "Artist", track: 3, trackTotal: 12, disc: 1,
+		date: "2024-01-02", custom: []tagField{{"STREAMLINE_ENCODING", "mp3 V5"}}}
+	want := []tagField{{"title", "Song"}, {"artist", "Artist"}, {"track", "3/12"}, {"disc", "1"},
+		{"date", "2024-01-02"}, {"STREAMLINE_ENCODING", "mp3 V5"}}
+	got := tags.fields()
+	if len(got) != len(want) {
+		t.Fatalf("fields() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("fields()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+// withOptions runs the rest of the test with opts changed by set, restoring
+// them afterwards.
+func withOptions(t *testing.T, set func(o *options)) {
+	t.Helper()
+	saved := opts
+	t.Cleanup(func() { opts = saved })
+	set(&opts)
+}
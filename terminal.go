@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// ─── Terminal Renderer ────────────────────────────────────────────────────────
+
+// renderMode decides how live rows (progress bars, spinners) reach the screen.
+type renderMode int
+
+const (
+	renderPlain    renderMode = iota // not a TTY: only finished rows are printed
+	renderCarriage                   // TTY without ANSI cursor control: \r-rewritten line
+	renderLive                       // ANSI TTY: every row redrawn in place
+	renderQuiet                      // JSON output: rows are never shown
+)
+
+// termRow is one live line owned by a ProgressBar or Spinner.
+type termRow struct{ text string }
+
+// terminal serialises everything written to the screen. Log lines scroll
+// above a block of live rows that is redrawn in place, so several jobs can
+// report progress at once without garbling each other's output.
+type terminal struct {
+	mu      sync.Mutex
+	mode    renderMode
+	rows    []*termRow
+	footer  string // overall batch progress, always drawn last
+	drawn   int    // lines of the live block currently on screen
+	held    bool   // a prompt owns the screen; output is queued
+	pending []pendingLine
+	holdMu  sync.Mutex // serialises prompts
+}
+
+// pendingLine is a log line queued while a prompt holds the screen.
+type pendingLine struct {
+	w    io.Writer
+	line string
+}
+
+var term = newTerminal()
+
+func newTerminal() *terminal {
+	mode := renderPlain
+	if isTerminal() {
+		mode = renderLive
+		if runtime.GOOS == "windows" {
+			mode = renderCarriage
+		}
+	}
+	return &terminal{mode: mode}
+}
+
+// setQuiet stops rows from being drawn; log lines are still written.
+func (t *terminal) setQuiet() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clear()
+	t.mode = renderQuiet
+}
+
+// promptWriter is where interactive menus go: stdout normally, stderr when
+// stdout carries the JSON event stream.
+func promptWriter() io.Writer {
+	if jsonOutput {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// addRow reserves a live line at the bottom of the screen.
+func (t *terminal) addRow() *termRow {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := &termRow{}
+	t.rows = append(t.rows, r)
+	return r
+}
+
+// setRow replaces a row's text and refreshes the screen.
+func (t *terminal) setRow(r *termRow, text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r.text = text
+	if t.held {
+		return
+	}
+	switch t.mode {
+	case renderLive:
+		t.clear()
+		t.redraw()
+	case renderCarriage:
+		fmt.Fprintf(os.Stdout, "\r%s", text)
+		t.drawn = 1
+	}
+}
+
+// removeRow drops a row from the live block. If final is non-empty it is
+// printed as a regular line so the finished state stays in the scrollback.
+func (t *terminal) removeRow(r *termRow, final string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clear()
+	for i, row := range t.rows {
+		if row == r {
+			t.rows = append(t.rows[:i], t.rows[i+1:]...)
+			break
+		}
+	}
+	if final != "" && t.mode != renderQuiet {
+		t.output(os.Stdout, final)
+	}
+	t.redraw()
+}
+
+// setFooter sets the line drawn below all rows; "" hides it.
+func (t *terminal) setFooter(text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.footer = text
+	if t.mode == renderLive && !t.held {
+		t.clear()
+		t.redraw()
+	}
+}
+
+// writeLine prints a log line above the live block.
+func (t *terminal) writeLine(w io.Writer, line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clear()
+	t.output(w, line)
+	t.redraw()
+}
+
+// println prints a log line to stdout above the live block. It is silent in
+// quiet mode, where stdout belongs to the JSON event stream.
+func (t *terminal) println(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.mode == renderQuiet {
+		return
+	}
+	t.clear()
+	t.output(os.Stdout, line)
+	t.redraw()
+}
+
+// hold clears the live block and gives fn the screen, for interactive
+// prompts. Output from other goroutines is queued rather than blocked, so
+// running downloads keep draining yt-dlp's output, and is flushed once fn
+// returns. fn must write with fmt directly, not through the terminal.
+func (t *terminal) hold(fn func()) {
+	t.holdMu.Lock()
+	defer t.holdMu.Unlock()
+
+	t.mu.Lock()
+	t.clear()
+	t.held = true
+	t.mu.Unlock()
+
+	fn()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.held = false
+	for _, p := range t.pending {
+		fmt.Fprintln(p.w, p.line)
+	}
+	t.pending = nil
+	t.redraw()
+}
+
+// restore leaves the screen sane before a forced exit: queued output is
+// flushed, the live block erased, and the cursor and line wrap switched on.
+func (t *terminal) restore() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clear()
+	for _, p := range t.pending {
+		fmt.Fprintln(p.w, p.line)
+	}
+	t.pending = nil
+	if t.mode == renderLive {
+		fmt.Fprint(os.Stdout, "\033[?7h\033[?25h")
+	}
+}
+
+// output writes a line now, or queues it while held; the caller holds t.mu.
+func (t *terminal) output(w io.Writer, line string) {
+	if t.held {
+		t.pending = append(t.pending, pendingLine{w, line})
+		return
+	}
+	fmt.Fprintln(w, line)
+}
+
+// clear erases the live block; the caller holds t.mu.
+func (t *terminal) clear() {
+	if t.drawn == 0 || t.held {
+		return
+	}
+	switch t.mode {
+	case renderLive:
+		fmt.Fprintf(os.Stdout, "\033[%dA\r\033[J", t.drawn)
+	case renderCarriage:
+		fmt.Fprintln(os.Stdout)
+	}
+	t.drawn = 0
+}
+
+// redraw paints the live block below the cursor; the caller holds t.mu.
+// Auto-wrap is switched off while drawing so an over-long row is cut at the
+// screen edge instead of spilling onto a line we would not erase.
+func (t *terminal) redraw() {
+	if t.mode != renderLive || t.held {
+		return
+	}
+	lines := make([]string, 0, len(t.rows)+1)
+	for _, r := range t.rows {
+		if r.text != "" {
+			lines = append(lines, r.text)
+		}
+	}
+	if t.footer != "" {
+		lines = append(lines, t.footer)
+	}
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprint(os.Stdout, "\033[?7l")
+	for _, l := range lines {
+		fmt.Fprintf(os.Stdout, "%s\033[K\n", l)
+	}
+	fmt.Fprint(os.Stdout, "\033[?7h")
+	t.drawn = len(lines)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestTerminalPrintlnRace is for go test -race: workers log while the mode
+// changes under them.
+func TestTerminalPrintlnRace(t *testing.T) {
+	tm := &terminal{mode: renderQuiet}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tm.println("line")
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		tm.setQuiet()
+	}
+	wg.Wait()
+}
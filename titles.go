@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ─── Title Parsing ────────────────────────────────────────────────────────────
+
+// --remastered choices for "(Remastered 2011)" and "- 2009 Remaster" notes.
+const (
+	remasteredKeep  = "keep"
+	remasteredStrip = "strip"
+)
+
+var remasteredModes = []string{remasteredKeep, remasteredStrip}
+
+var (
+	// reTitleNoise matches a bracketed note that says nothing about the
+	// song itself: "(Official Music Video)", "[4K]", "(Lyrics)".
+	reTitleNoise = regexp.MustCompile(`(?i)\s*[(\[]\s*(?:official\b[^()\[\]]*|` +
+		`(?:hd|hq|4k|8k|uhd|1080p|720p)(?:\s+(?:video|audio|version|remaster(?:ed)?))?|` +
+		`lyrics?(?:\s+video)?|(?:music\s+)?video|audio(?:\s+only)?|visuali[sz]er|m/?v|explicit)\s*[)\]]`)
+	// reTrailingNoise matches the same notes written after a separator:
+	// "Song | Official Video", "Song - Lyrics".
+	reTrailingNoise = regexp.MustCompile(`(?i)\s+[-|–—]\s+(?:official\b.*|lyrics?(?:\s+video)?|(?:hd|hq|4k)(?:\s+video)?)$`)
+	// reRemastered matches "(Remastered 2011)", "[2011 Remaster]" and the
+	// unbracketed "- Remastered 2009" streaming services use.
+	reRemastered = regexp.MustCompile(`(?i)\s*(?:[(\[]\s*(?:\d{4}\s+)?(?:digital(?:ly)?\s+)?remaster(?:ed)?(?:\s+(?:version|edition|\d{4}))*\s*[)\]]|` +
+		`\s-\s+(?:\d{4}\s+)?(?:digital(?:ly)?\s+)?remaster(?:ed)?(?:\s+(?:version|edition|\d{4}))*$)`)
+	// reFeatBracket and reFeatTrailing find featured artists:
+	// "Song (feat. Guest)" and "Artist ft. Guest".
+	reFeatBracket  = regexp.MustCompile(`(?i)\s*[(\[]\s*(?:feat\.?|ft\.?|featuring)\s+([^()\[\]]+?)\s*[)\]]`)
+	reFeatTrailing = regexp.MustCompile(`(?i)\s+(?:feat\.?|ft\.?|featuring)\s+(.+)$`)
+	// reTitleSplit is the artist/title separator: a dash with spaces
+	// around it, or the artist followed by the song in quotes.
+	reTitleSplit  = regexp.MustCompile(`\s+(?:-{1,2}|–|—)\s+`)
+	reTitleQuoted = regexp.MustCompile(`^(.+?)\s+["“](.+)["”]$`)
+	reSpaces      = regexp.MustCompile(`\s{2,}`)
+)
+
+// titleRule is a compiled --title-rule. A rule with an "artist" or "title"
+// named group splits titles it matches; any other rule deletes its matches.
+type titleRule struct {
+	re    *regexp.Regexp
+	split bool
+}
+
+// parsedTitle is what parseTitle makes of an upload title.
+type parsedTitle struct {
+	artist   string // "" when the title names none
+	featured []string
+	title    string
+}
+
+// validateTitleOptions checks --remastered and compiles --title-rule into
+// opts.titleRegexps.
+func validateTitleOptions() error {
+	if !containsString(remasteredModes, opts.remastered) {
+		return fmt.Errorf("unknown --remastered mode %q (want %s)", opts.remastered, strings.Join(remasteredModes, ", "))
+	}
+	opts.titleRegexps = nil
+	for _, src := range opts.titleRules {
+		re, err := regexp.Compile(src)
+		if err != nil {
+			return fmt.Errorf("bad --title-rule %q: %v", src, err)
+		}
+		split := re.SubexpIndex("artist") >= 0 || re.SubexpIndex("title") >= 0
+		opts.titleRegexps = append(opts.titleRegexps, titleRule{re, split})
+	}
+	return nil
+}
+
+// parseTitle splits an upload title such as "Artist ft. Guest - Song
+// (Official Audio) [4K]" into artist, featured artists and song. The user's
+// --title-rule patterns run first, in order; a splitting rule that matches
+// takes the place of the built-in separators. Noise notes and, with
+// --remastered strip, remaster notes are removed, and featured artists are
+// collected from both halves.
+func parseTitle(raw string) parsedTitle {
+	var p parsedTitle
+	rest, split := raw, false
+	for _, r := range opts.titleRegexps {
+		switch {
+		case !r.split:
+			rest = r.re.ReplaceAllString(rest, "")
+		case !split:
+			m := r.re.FindStringSubmatch(rest)
+			if m == nil {
+				continue
+			}
+			split = true
+			if i := r.re.SubexpIndex("artist"); i >= 0 {
+				p.artist = m[i]
+			}
+			rest = ""
+			if i := r.re.SubexpIndex("title"); i >= 0 {
+				rest = m[i]
+			}
+		}
+	}
+
+	rest = stripTitleNoise(rest)
+	if !split {
+		if loc := reTitleSplit.FindStringIndex(rest); loc != nil {
+			p.artist, rest = rest[:loc[0]], rest[loc[1]:]
+		} else if m := reTitleQuoted.FindStringSubmatch(rest); m != nil {
+			p.artist, rest = m[1], m[2]
+		}
+	}
+	p.artist, rest = stripTitleNoise(p.artist), stripTitleNoise(rest)
+
+	p.artist, p.featured = takeFeatured(p.artist, p.featured)
+	p.title, p.featured = takeFeatured(rest, p.featured)
+	p.artist = tidyTitle(p.artist)
+	p.title = tidyTitle(p.title)
+	if p.title == "" {
+		// Everything was noise; better the raw title than none.
+		p.title = strings.TrimSpace(raw)
+	}
+	return p
+}
+
+// credit renders the artist with any featured artists: "A feat. B, C".
+// Without an artist in the title it credits fallback, usually the channel.
+func (p parsedTitle) credit(fallback string) string {
+	artist := p.artist
+	if artist == "" {
+		artist = fallback
+	}
+	if len(p.featured) == 0 || artist == "" {
+		return artist
+	}
+	return artist + " feat. " + strings.Join(p.featured, ", ")
+}
+
+func stripTitleNoise(s string) string {
+	s = reTitleNoise.ReplaceAllString(s, "")
+	if opts.remastered == remasteredStrip {
+		s = reRemastered.ReplaceAllString(s, "")
+	}
+	for {
+		stripped := reTrailingNoise.ReplaceAllString(s, "")
+		if stripped == s {
+			return s
+		}
+		s = stripped
+	}
+}
+
+// takeFeatured removes featuring credits from s and appends the names to
+// featured.
+func takeFeatured(s string, featured []string) (string, []string) {
+	for _, m := range reFeatBracket.FindAllStringSubmatch(s, -1) {
+		featured = append(featured, strings.TrimSpace(m[1]))
+	}
+	s = reFeatBracket.ReplaceAllString(s, "")
+	if m := reFeatTrailing.FindStringSubmatchIndex(s); m != nil {
+		featured = append(featured, strings.TrimSpace(s[m[2]:m[3]]))
+		s = s[:m[0]]
+	}
+	return s, featured
+}
+
+// tidyTitle collapses runs of spaces and trims separators left at either
+// end once notes were removed.
+func tidyTitle(s string) string {
+	return strings.Trim(reSpaces.ReplaceAllString(s, " "), " -–—|")
+}
+
+// channelArtist names the artist behind a channel. YouTube's auto-generated
+// music channels are "Artist - Topic".
+func channelArtist(channel string) string {
+	return strings.TrimSuffix(channel, " - Topic")
+}
+
+// isTopicChannel reports whether a channel is auto-generated from a label's
+// catalogue; its titles are clean song names, dashes included.
+func isTopicChannel(channel string) bool {
+	return strings.HasSuffix(channel, " - Topic")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTitle(t *testing.T) {
+	// The rules from the README's config example.
+	readmeRules := []string{`\s*\(Live\)$`, `^(?P<title>.+?) by (?P<artist>.+)$`}
+
+	tests := []struct {
+		raw        string
+		remastered string
+		rules      []string
+		artist     string
+		featured   []string
+		title      string
+		credit     string // p.credit("Channel")
+	}{
+		// README examples.
+		{raw: "Artist ft. Guest - Song (Official Audio) [4K]",
+			artist: "Artist", featured: []string{"Guest"}, title: "Song", credit: "Artist feat. Guest"},
+		{raw: "Song by Artist", rules: readmeRules,
+			artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "Song (Live)", rules: readmeRules,
+			title: "Song", credit: "Channel"},
+		{raw: "Song (Remastered 2011)", remastered: remasteredStrip,
+			title: "Song", credit: "Channel"},
+		{raw: "Artist - Song - 2009 Remaster", remastered: remasteredStrip,
+			artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "Artist - Song (Remastered 2011)",
+			artist: "Artist", title: "Song (Remastered 2011)", credit: "Artist"},
+
+		// Separators.
+		{raw: "Artist - Song", artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "Artist – Song", artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "Artist -- Song", artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "Artist - Song - Extended Mix", artist: "Artist", title: "Song - Extended Mix", credit: "Artist"},
+		{raw: `Artist "Song"`, artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "Artist “Song” (Official Video)", artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "Jay-Z", title: "Jay-Z", credit: "Channel"},
+		{raw: "Just a Song", title: "Just a Song", credit: "Channel"},
+
+		// Featured artists, in either half.
+		{raw: "Artist - Song (feat. Guest)", artist: "Artist", featured: []string{"Guest"}, title: "Song", credit: "Artist feat. Guest"},
+		{raw: "Artist feat. A & B - Song [ft. C]", artist: "Artist", featured: []string{"A & B", "C"}, title: "Song", credit: "Artist feat. A & B, C"},
+		{raw: "Artist - Song featuring Guest", artist: "Artist", featured: []string{"Guest"}, title: "Song", credit: "Artist feat. Guest"},
+		{raw: "Song (ft. Guest)", featured: []string{"Guest"}, title: "Song", credit: "Channel feat. Guest"},
+		{raw: "Artist - Left Foot", artist: "Artist", title: "Left Foot", credit: "Artist"},
+
+		// Junk notes, bracketed or trailing.
+		{raw: "Artist - Song (Official Music Video)", artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "Artist - Song [HD] (Lyrics)", artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "Artist - Song | Official Video", artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "Artist - Song - Lyrics", artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "Artist - Song (Visualizer) [Explicit]", artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "Artist - Song (Acoustic)", artist: "Artist", title: "Song (Acoustic)", credit: "Artist"},
+		{raw: "(Official Video)", title: "(Official Video)", credit: "Channel"},
+
+		// User rules: deleting rules run first, the first splitting rule wins.
+		{raw: "Song by Artist (Live)", rules: readmeRules, artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "Artist - Song", rules: readmeRules, artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "[Label] Artist - Song", rules: []string{`^\[[^\]]*\]\s*`}, artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "Song | Artist", rules: []string{`^(?P<title>.+) \| (?P<artist>.+)$`}, artist: "Artist", title: "Song", credit: "Artist"},
+		{raw: "Song by Artist feat. Guest", rules: readmeRules,
+			artist: "Artist", featured: []string{"Guest"}, title: "Song", credit: "Artist feat. Guest"},
+		{raw: "EP01 - Song", rules: []string{`^EP\d+ - (?P<title>.+)$`}, title: "Song", credit: "Channel"},
+	}
+	for _, tt := range tests {
+		withOptions(t, func(o *options) {
+			o.remastered, o.titleRules = remasteredKeep, tt.rules
+			if tt.remastered != "" {
+				o.remastered = tt.remastered
+			}
+		})
+		if err := validateTitleOptions(); err != nil {
+			t.Fatalf("%q: %v", tt.raw, err)
+		}
+		p := parseTitle(tt.raw)
+		if p.artist != tt.artist || p.title != tt.title || !reflect.DeepEqual(p.featured, tt.featured) {
+			t.Errorf("parseTitle(%q) = %q, %q, %q; want %q, %q, %q",
+				tt.raw, p.artist, p.featured, p.title, tt.artist, tt.featured, tt.title)
+		}
+		if got := p.credit("Channel"); got != tt.credit {
+			t.Errorf("parseTitle(%q).credit() = %q, want %q", tt.raw, got, tt.credit)
+		}
+	}
+}
+
+func TestValidateTitleOptions(t *testing.T) {
+	tests := []struct {
+		remastered string
+		rules      []string
+		want       string
+	}{
+		{remasteredKeep, nil, ""},
+		{remasteredStrip, []string{`x`, `(?P<artist>.+) - (?P<title>.+)`}, ""},
+		{"drop", nil, `unknown --remastered mode "drop" (want keep, strip)`},
+		{remasteredKeep, []string{`(`}, "bad --title-rule \"(\": error parsing regexp: missing closing ): `(`"},
+	}
+	for _, tt := range tests {
+		withOptions(t, func(o *options) { o.remastered, o.titleRules = tt.remastered, tt.rules })
+		got := ""
+		if err := validateTitleOptions(); err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("validateTitleOptions(%q, %q) = %q, want %q", tt.remastered, tt.rules, got, tt.want)
+		}
+	}
+}